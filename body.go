@@ -0,0 +1,296 @@
+package router
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/oarkflow/json"
+)
+
+// Request body encodings recognised by schema validation.
+const (
+	EncodingJSON      = "json"
+	EncodingForm      = "form"
+	EncodingMultipart = "multipart"
+	EncodingXML       = "xml"
+)
+
+// bodyEncoding returns the encoding of the request body from its
+// Content-Type. Bodies without a recognised type are treated as JSON.
+func bodyEncoding(c *fiber.Ctx) string {
+	mediaType, _, _ := mime.ParseMediaType(string(c.Request().Header.ContentType()))
+	switch {
+	case mediaType == fiber.MIMEApplicationForm:
+		return EncodingForm
+	case mediaType == fiber.MIMEMultipartForm:
+		return EncodingMultipart
+	case mediaType == fiber.MIMEApplicationXML, mediaType == fiber.MIMETextXML, strings.HasSuffix(mediaType, "+xml"):
+		return EncodingXML
+	default:
+		return EncodingJSON
+	}
+}
+
+// WithNormalizedBody makes ValidateRequestBySchema replace form, multipart
+// and XML bodies with the validated data encoded as JSON. Without it the
+// handler receives the body in its original encoding. File parts of
+// multipart bodies are represented by their file names.
+func WithNormalizedBody() RouteOption {
+	return func(r *Route) {
+		r.NormalizeBody = true
+	}
+}
+
+// BodyFromCtx returns the request body decoded and coerced by
+// ValidateRequestBySchema, whatever its original encoding.
+func BodyFromCtx(c *fiber.Ctx) any {
+	return c.Locals("request_body")
+}
+
+// decodeBody decodes the request body according to its encoding. Form,
+// multipart and XML values are coerced to the types declared by the schema;
+// file parts are checked against their constraints and returned as
+// violations.
+func decodeBody(c *fiber.Ctx, doc any, encoding string) (any, []Violation, error) {
+	switch encoding {
+	case EncodingForm:
+		values := map[string][]string{}
+		c.Request().PostArgs().VisitAll(func(key, val []byte) {
+			values[string(key)] = append(values[string(key)], string(val))
+		})
+		return coerceForm(doc, values), nil, nil
+	case EncodingMultipart:
+		form, err := c.MultipartForm()
+		if err != nil {
+			return nil, nil, err
+		}
+		data := coerceForm(doc, form.Value)
+		violations := multipartFiles(doc, form.File, data)
+		return data, violations, nil
+	case EncodingXML:
+		value, err := decodeXML(c.Body())
+		if err != nil {
+			return nil, nil, err
+		}
+		return coerceXML(doc, doc, value), nil, nil
+	default:
+		var data any
+		if err := json.Unmarshal(c.Body(), &data); err != nil {
+			return nil, nil, err
+		}
+		return data, nil, nil
+	}
+}
+
+// propertySchema returns the schema of a top-level property.
+func propertySchema(doc any, name string) map[string]any {
+	schema, _ := doc.(map[string]any)
+	props, _ := schema["properties"].(map[string]any)
+	prop, _ := props[name].(map[string]any)
+	return prop
+}
+
+// coerceForm converts form fields to the types their properties declare.
+// Fields declared as arrays collect every value; other fields take the
+// first one.
+func coerceForm(doc any, values map[string][]string) map[string]any {
+	data := make(map[string]any, len(values))
+	for name, vals := range values {
+		prop := propertySchema(doc, name)
+		types := schemaTypes(prop["type"])
+		if len(types) == 1 && types[0] == "array" {
+			items, _ := prop["items"].(map[string]any)
+			itemTypes := schemaTypes(items["type"])
+			list := make([]any, len(vals))
+			for i, v := range vals {
+				list[i] = coerceParameter(v, itemTypes)
+			}
+			data[name] = list
+			continue
+		}
+		if len(vals) > 0 {
+			data[name] = coerceParameter(vals[0], types)
+		}
+	}
+	return data
+}
+
+// multipartFiles adds the file names of the file parts to data and checks
+// each part against the "maxSize", "minSize" and "contentMediaType"
+// keywords of its property, or of the property's items for arrays.
+func multipartFiles(doc any, files map[string][]*multipart.FileHeader, data map[string]any) []Violation {
+	var violations []Violation
+	for name, headers := range files {
+		prop := propertySchema(doc, name)
+		ptr := "/" + escapePointer(name)
+		if types := schemaTypes(prop["type"]); len(types) == 1 && types[0] == "array" {
+			items, _ := prop["items"].(map[string]any)
+			list := make([]any, len(headers))
+			for i, fh := range headers {
+				list[i] = fh.Filename
+				violations = append(violations, fileViolations(items, fh, ptr+"/"+strconv.Itoa(i))...)
+			}
+			data[name] = list
+			continue
+		}
+		if len(headers) > 0 {
+			data[name] = headers[0].Filename
+			violations = append(violations, fileViolations(prop, headers[0], ptr)...)
+		}
+	}
+	return violations
+}
+
+// fileViolations checks a file part against its schema.
+func fileViolations(schema map[string]any, fh *multipart.FileHeader, ptr string) []Violation {
+	var violations []Violation
+	add := func(keyword string, expected, actual any) {
+		violations = append(violations, Violation{Pointer: ptr, In: LocationBody, Keyword: keyword, Expected: expected, Actual: actual})
+	}
+	if n, ok := toNumber(schema["maxSize"]); ok && float64(fh.Size) > n {
+		add("maxSize", n, fh.Size)
+	}
+	if n, ok := toNumber(schema["minSize"]); ok && float64(fh.Size) < n {
+		add("minSize", n, fh.Size)
+	}
+	if allowed, ok := schema["contentMediaType"].(string); ok && allowed != "" {
+		actual, _, _ := mime.ParseMediaType(fh.Header.Get(fiber.HeaderContentType))
+		if !mediaTypeAllowed(allowed, actual) {
+			add("contentMediaType", allowed, actual)
+		}
+	}
+	return violations
+}
+
+// mediaTypeAllowed reports whether actual matches one of the comma-separated
+// media types in allowed, which may use wildcards such as "image/*".
+func mediaTypeAllowed(allowed, actual string) bool {
+	for _, pattern := range strings.Split(allowed, ",") {
+		if ok, _ := path.Match(strings.TrimSpace(strings.ToLower(pattern)), strings.ToLower(actual)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeXML maps an XML document to JSON-like values. The root element
+// stands for the body itself. An element holding only text becomes a
+// string; any other element becomes an object whose attributes are keyed
+// "@name", whose child elements are keyed by their local name, and whose
+// text, if any, is keyed "#text". Repeated child elements become arrays.
+func decodeXML(data []byte) (any, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("XML document has no root element")
+			}
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return decodeXMLElement(dec, start, 1)
+		}
+	}
+}
+
+// maxXMLDepth limits the nesting of XML bodies, which are decoded
+// recursively.
+const maxXMLDepth = 64
+
+func decodeXMLElement(dec *xml.Decoder, start xml.StartElement, depth int) (any, error) {
+	if depth > maxXMLDepth {
+		return nil, fmt.Errorf("XML elements nested deeper than %d levels", maxXMLDepth)
+	}
+	obj := map[string]any{}
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		obj["@"+attr.Name.Local] = attr.Value
+	}
+	var text strings.Builder
+	hasChildren := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			hasChildren = true
+			child, err := decodeXMLElement(dec, t, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			name := t.Name.Local
+			switch existing := obj[name].(type) {
+			case nil:
+				obj[name] = child
+			case []any:
+				obj[name] = append(existing, child)
+			default:
+				obj[name] = []any{existing, child}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			content := strings.TrimSpace(text.String())
+			if !hasChildren && len(obj) == 0 {
+				return content, nil
+			}
+			if content != "" {
+				obj["#text"] = content
+			}
+			return obj, nil
+		}
+	}
+}
+
+// coerceXML converts the strings produced by decodeXML to the types the
+// schema declares, wrapping single elements in arrays where the schema
+// expects a list.
+func coerceXML(root, schema, value any) any {
+	s, _ := schema.(map[string]any)
+	if ref, ok := s["$ref"].(string); ok {
+		if target, ok := resolvePointer(root, ref); ok {
+			s, _ = target.(map[string]any)
+		}
+	}
+	types := schemaTypes(s["type"])
+	if len(types) == 1 && types[0] == "array" {
+		list, ok := value.([]any)
+		if !ok {
+			list = []any{value}
+		}
+		out := make([]any, len(list))
+		for i, item := range list {
+			out[i] = coerceXML(root, s["items"], item)
+		}
+		return out
+	}
+	switch val := value.(type) {
+	case map[string]any:
+		props, _ := s["properties"].(map[string]any)
+		for key, item := range val {
+			val[key] = coerceXML(root, props[key], item)
+		}
+		return val
+	case string:
+		if len(types) == 1 && types[0] == "object" && val == "" {
+			return map[string]any{}
+		}
+		return coerceParameter(val, types)
+	default:
+		return value
+	}
+}
@@ -0,0 +1,128 @@
+package router
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// bodyApp serves POST /items validated by schema, answering with the
+// validated body and the body the handler received.
+func bodyApp(t *testing.T, schema string, opts ...RouteOption) *fiber.App {
+	t.Helper()
+	app := fiber.New()
+	dr := New(app)
+	compiled, err := CompileSchema([]byte(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr.AddRouteWithOptions(fiber.MethodPost, "/items", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"body": BodyFromCtx(c), "raw": string(c.Body())})
+	}, append(opts, WithRequestSchema(compiled)), dr.ValidateRequestBySchema)
+	return app
+}
+
+func post(t *testing.T, app *fiber.App, contentType string, body []byte) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, "/items", bytes.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(got)
+}
+
+func TestFormBodyValidation(t *testing.T) {
+	app := bodyApp(t, `{"type": "object", "required": ["name"], "properties": {
+		"name": {"type": "string"},
+		"count": {"type": "integer", "maximum": 10},
+		"tags": {"type": "array", "items": {"type": "string"}}}}`)
+	for _, tc := range []struct {
+		body   string
+		status int
+		want   string
+	}{
+		{"name=a&count=3&tags=x&tags=y", fiber.StatusOK, `"body":{"count":3,"name":"a","tags":["x","y"]},"raw":"name=a`},
+		{"count=3", fiber.StatusUnprocessableEntity, `"keyword":"required"`},
+		{"name=a&count=11", fiber.StatusUnprocessableEntity, `"keyword":"maximum"`},
+		{"name=a&count=x", fiber.StatusUnprocessableEntity, `"keyword":"type"`},
+	} {
+		status, body := post(t, app, fiber.MIMEApplicationForm, []byte(tc.body))
+		if status != tc.status || !strings.Contains(body, tc.want) {
+			t.Errorf("POST %s = %d %s, want %d with %s", tc.body, status, body, tc.status, tc.want)
+		}
+	}
+}
+
+func TestMultipartBodyValidation(t *testing.T) {
+	app := bodyApp(t, `{"type": "object", "required": ["title", "file"], "properties": {
+		"title": {"type": "string"},
+		"file": {"type": "string", "maxSize": 8, "contentMediaType": "image/*"}}}`, WithNormalizedBody())
+	form := func(title, fileType, content string) (string, []byte) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		if title != "" {
+			w.WriteField("title", title)
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="file"; filename="a.png"`)
+		header.Set(fiber.HeaderContentType, fileType)
+		part, err := w.CreatePart(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(part, content)
+		w.Close()
+		return w.FormDataContentType(), buf.Bytes()
+	}
+	for _, tc := range []struct {
+		name            string
+		title, fileType string
+		content         string
+		status          int
+		want            string
+	}{
+		{"valid", "cat", "image/png", "png", fiber.StatusOK, `"raw":"{\"file\":\"a.png\",\"title\":\"cat\"}"`},
+		{"missing field", "", "image/png", "png", fiber.StatusUnprocessableEntity, `"keyword":"required"`},
+		{"too large", "cat", "image/png", "123456789", fiber.StatusUnprocessableEntity, `"keyword":"maxSize"`},
+		{"media type", "cat", "text/plain", "png", fiber.StatusUnprocessableEntity, `"keyword":"contentMediaType"`},
+	} {
+		contentType, body := form(tc.title, tc.fileType, tc.content)
+		status, got := post(t, app, contentType, body)
+		if status != tc.status || !strings.Contains(got, tc.want) {
+			t.Errorf("%s: POST = %d %s, want %d with %s", tc.name, status, got, tc.status, tc.want)
+		}
+	}
+}
+
+func TestXMLBodyValidation(t *testing.T) {
+	app := bodyApp(t, `{"type": "object", "required": ["name"], "properties": {
+		"@id": {"type": "integer"},
+		"name": {"type": "string"},
+		"tags": {"type": "object", "properties": {"tag": {"type": "array", "items": {"type": "string"}}}}}}`)
+	deep := strings.Repeat("<a>", maxXMLDepth+1) + strings.Repeat("</a>", maxXMLDepth+1)
+	for _, tc := range []struct {
+		body   string
+		status int
+		want   string
+	}{
+		{`<item id="7"><name>a</name><tags><tag>x</tag></tags></item>`, fiber.StatusOK, `"body":{"@id":7,"name":"a","tags":{"tag":["x"]}}`},
+		{`<item id="7"></item>`, fiber.StatusUnprocessableEntity, `"keyword":"required"`},
+		{`<item id="x"><name>a</name></item>`, fiber.StatusUnprocessableEntity, `"keyword":"type"`},
+		{`<item><name>a</item>`, fiber.StatusBadRequest, `"keyword":"syntax"`},
+		{deep, fiber.StatusBadRequest, "nested deeper"},
+	} {
+		status, body := post(t, app, fiber.MIMEApplicationXML, []byte(tc.body))
+		if status != tc.status || !strings.Contains(body, tc.want) {
+			t.Errorf("POST %.40s = %d %s, want %d with %s", tc.body, status, body, tc.status, tc.want)
+		}
+	}
+}
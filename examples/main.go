@@ -7,6 +7,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -15,41 +16,42 @@ import (
 
 	"github.com/oarkflow/router"
 	"github.com/oarkflow/router/utils"
+	"github.com/oarkflow/router/watcher"
 )
 
 type RendererConfig struct {
-	ID        string `json:"id"`
-	Root      string `json:"root"`
-	Prefix    string `json:"prefix"`
-	UseIndex  bool   `json:"use_index"`
-	Compress  bool   `json:"compress"`
-	Index     string `json:"index"`
-	Extension string `json:"extension"`
+	ID        string          `json:"id"`
+	Root      string          `json:"root"`
+	Prefix    string          `json:"prefix"`
+	UseIndex  bool            `json:"use_index"`
+	Compress  bool            `json:"compress"`
+	Index     string          `json:"index"`
+	Extension string          `json:"extension"`
+	Layout    string          `json:"layout,omitempty"`
+	Reload    bool            `json:"reload,omitempty"`
+	Routes    []TemplateRoute `json:"routes,omitempty"`
 }
 
-type APISchema struct {
-	RouteURI    string          `json:"route_uri"`
-	RouteMethod string          `json:"route_method"`
-	Schema      json.RawMessage `json:"schema,omitempty"`
+// viewsKey identifies the views built for the entry across reloads.
+func (rc RendererConfig) viewsKey() string {
+	return fmt.Sprintf("%s|%s|%s|%t", rc.ID, rc.Root, rc.Extension, rc.Reload)
 }
 
-type APIRoute struct {
-	RouteURI    string            `json:"route_uri"`
-	RouteMethod string            `json:"route_method"`
-	Description string            `json:"description"`
-	Model       string            `json:"model"`
-	Operation   string            `json:"operation"`
-	HandlerKey  string            `json:"handler_key"`
-	Schema      json.RawMessage   `json:"schema,omitempty"`
-	Rules       map[string]string `json:"rules,omitempty"`
+// TemplateRoute binds a path below the renderer prefix to a template.
+type TemplateRoute struct {
+	Path string `json:"path"`
+	router.TemplateConfig
 }
 
-type APIEndpoints struct {
-	Prefix string     `json:"prefix"`
-	Routes []APIRoute `json:"routes"`
-}
+// APISchema, APIRoute and APIEndpoints are the formats of schema.json and
+// api.json.
+type (
+	APISchema    = router.SchemaConfig
+	APIRoute     = router.RouteConfig
+	APIEndpoints = router.Manifest
+)
 
-var handlerMapping = map[string]fiber.Handler{
+var handlerMapping = router.HandlerRegistry{
 	"print:check": func(c *fiber.Ctx) error {
 		var data map[string]any
 		err := c.BodyParser(&data)
@@ -59,9 +61,6 @@ var handlerMapping = map[string]fiber.Handler{
 		log.Println("print:check handler invoked", data)
 		return c.SendString("print:check executed")
 	},
-	"view-html": func(c *fiber.Ctx) error {
-		return c.Render("index", fiber.Map{"Title": "HTML View"})
-	},
 	"view-json": func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"message": "JSON View"})
 	},
@@ -77,80 +76,108 @@ var handlerMapping = map[string]fiber.Handler{
 var (
 	dynamicRouter *router.Router
 	app           *fiber.App
+	// schemaRegistry resolves $refs to the shared definitions in ./schemas.
+	schemaRegistry = router.NewSchemaRegistry()
+	// templateViews are the views of renderer.json entries, kept across
+	// reloads so that their templates are watched once.
+	templateViews   = make(map[string]*router.ReloadableViews)
+	templateViewsMu sync.Mutex
 )
 
+// rendererViews returns the views of each renderer.json entry. Views of a
+// previous load are reloaded and reused; those no longer configured stop
+// watching their templates.
+func rendererViews(configs []RendererConfig) map[string]*router.ReloadableViews {
+	templateViewsMu.Lock()
+	defer templateViewsMu.Unlock()
+	current := make(map[string]*router.ReloadableViews)
+	for _, rc := range configs {
+		key := rc.viewsKey()
+		views, ok := templateViews[key]
+		if ok {
+			if err := views.Load(); err != nil {
+				log.Printf("Error reloading templates of %s: %v", rc.ID, err)
+			}
+		} else {
+			views = router.NewReloadableViews(func() fiber.Views {
+				return html.New(utils.AbsPath(rc.Root), rc.Extension)
+			})
+			if rc.Reload {
+				if _, err := views.Watch(filepath.Clean(utils.AbsPath(rc.Root))); err != nil {
+					log.Printf("Error watching templates of %s: %v", rc.ID, err)
+				}
+			}
+		}
+		current[key] = views
+	}
+	for key, views := range templateViews {
+		if _, ok := current[key]; !ok {
+			if err := views.Close(); err != nil {
+				log.Printf("Error stopping template watcher: %v", err)
+			}
+		}
+	}
+	templateViews = current
+	return current
+}
+
 func init() {
 	defaultEngine := html.New(utils.AbsPath("./static/dist"), ".html")
 	app = fiber.New(fiber.Config{
-		Views: defaultEngine,
+		Views: router.RouteViews(defaultEngine),
 	})
 	app.Static("/public", utils.AbsPath("./public"))
 	dynamicRouter = router.New(app)
 	dynamicRouter.Use(dynamicRouter.ValidateRequestBySchema)
-	initAPIEndpointsAndRenderer()
-}
-
-func loadSchemaFile(file string) error {
-	schemaData, err := os.ReadFile(file)
-	if err != nil {
-		return fmt.Errorf("Could not read %s: %v", file, err)
+	if err := initAPIEndpointsAndRenderer(dynamicRouter); err != nil {
+		log.Fatalf("Error loading routes: %v", err)
 	}
-	err = loadSchemaBytes(schemaData)
-	if err != nil {
-		return err
-	}
-	return nil
+	dynamicRouter.ServeOpenAPI(openAPIConfig)
 }
 
-func loadSchemaBytes(items json.RawMessage) error {
-	var entries []APISchema
-	if err := json.Unmarshal(items, &entries); err != nil {
-		return err
-	}
-	for _, entry := range entries {
-		router.CompileSchema(entry.RouteURI, entry.RouteMethod, entry.Schema)
-	}
-	return nil
+var openAPIConfig = router.OpenAPIConfig{
+	Info: router.OpenAPIInfo{Title: "Dynamic Router Example", Version: "1.0.0"},
+	UI:   "swagger",
 }
 
-func loadSchemas(file, dir string) error {
-	err := loadSchemaFile(file)
-	if err != nil {
-		log.Println("Error loading schema file:", err)
+// loadSchemas registers the shared definitions in dir, then reads the route
+// schemas of file, which may reference them with $ref.
+func loadSchemas(file, dir string) ([]APISchema, error) {
+	if _, err := os.Stat(dir); err == nil {
+		if err := schemaRegistry.LoadDir(dir); err != nil {
+			return nil, err
+		}
 	}
-	files, err := os.ReadDir(dir)
+	data, err := os.ReadFile(file)
 	if err != nil {
-		log.Println("Error loading schema dir:", err)
+		return nil, fmt.Errorf("Could not read %s: %v", file, err)
 	}
-	for _, file := range files {
-		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
-			continue
-		}
-		path := filepath.Join(dir, file.Name())
-		err := loadSchemaFile(path)
-		if err != nil {
-			return err
-		}
+	var entries []APISchema
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
 	}
-	return nil
+	return entries, nil
 }
 
-func initAPIEndpointsAndRenderer() {
-	err := loadSchemas(utils.AbsPath("./schema.json"), utils.AbsPath("./schemas"))
+// initAPIEndpointsAndRenderer registers the renderer and API routes on
+// dynamicRouter. API routes are only added when all of them resolve.
+func initAPIEndpointsAndRenderer(dynamicRouter *router.Router) error {
+	routeSchemas, err := loadSchemas(utils.AbsPath("./schema.json"), utils.AbsPath("./schemas"))
 	if err != nil {
 		log.Println("Error loading schemas:", err)
-	} // load compiled schemas at startup
+	}
 	dynamicRouter.SetNotFoundHandler(func(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Custom 404: Route not found"})
 	})
 	rendererJSON, err := os.ReadFile(utils.AbsPath("./renderer.json"))
 	if err != nil {
-		log.Fatalf("Error reading renderer.json: %v", err) // changed from panic
+		return fmt.Errorf("Error reading renderer.json: %v", err)
 	}
 	var rendererConfigs []RendererConfig
 	if err := json.Unmarshal(rendererJSON, &rendererConfigs); err != nil {
-		log.Fatalf("Error parsing renderer JSON: %v", err)
+		return fmt.Errorf("Error parsing renderer JSON: %v", err)
 	}
+	views := rendererViews(rendererConfigs)
 	for _, rc := range rendererConfigs {
 		root := filepath.Clean(utils.AbsPath(rc.Root))
 		err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
@@ -162,78 +189,89 @@ func initAPIEndpointsAndRenderer() {
 				if relativePath != "" {
 					rootPath := filepath.Join(rc.Prefix, relativePath)
 					dynamicRouter.Static(rootPath, path, router.StaticConfig{
-						Compress:     true,
-						CacheControl: "Cache-Control: public, max-age=86400",
+						Compress:      true,
+						Precompressed: true,
+						CacheControl:  "Cache-Control: public, max-age=86400",
 					})
 					dynamicRouter.Static(relativePath, path, router.StaticConfig{
-						Compress:     true,
-						CacheControl: "Cache-Control: public, max-age=86400",
+						Compress:      true,
+						Precompressed: true,
+						CacheControl:  "Cache-Control: public, max-age=86400",
 					})
 				}
 			}
 			return nil
 		})
+		customEngine := views[rc.viewsKey()]
 		if rc.UseIndex {
-			customEngine := html.New(utils.AbsPath(rc.Root), rc.Extension)
-			route := rc.Prefix
-			dynamicRouter.AddRoute("GET", route, func(c *fiber.Ctx) error {
-				c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
-				return customEngine.Render(c, rc.Index, fiber.Map{
-					"Title": "Custom Renderer - " + rc.ID,
-				})
-			})
-			dynamicRouter.SetRenderer("GET", route, customEngine)
+			dynamicRouter.AddRouteWithOptions("GET", rc.Prefix, router.TemplateHandler(rc.Index, map[string]any{
+				"Title": "Custom Renderer - " + rc.ID,
+			}), []router.RouteOption{router.WithRenderer(customEngine), router.WithLayout(rc.Layout)})
+		}
+		for _, tr := range rc.Routes {
+			layout := tr.Layout
+			if layout == "" {
+				layout = rc.Layout
+			}
+			if err := tr.Validate(); err != nil {
+				log.Printf("Skipping template route %s: %v", tr.Path, err)
+				continue
+			}
+			path := strings.TrimSuffix(rc.Prefix, "/") + "/" + strings.TrimPrefix(tr.Path, "/")
+			dynamicRouter.AddRouteWithOptions("GET", path, tr.Handler(),
+				[]router.RouteOption{router.WithRenderer(customEngine), router.WithLayout(layout), router.WithConfig(tr.TemplateConfig)})
 		}
 	}
 	apiBytes, err := os.ReadFile(utils.AbsPath("./api.json"))
 	if err != nil {
-		log.Fatalf("Error reading api.json: %v", err) // changed from panic
+		return fmt.Errorf("Error reading api.json: %v", err)
 	}
 	var apiConfig APIEndpoints
 	if err := json.Unmarshal(apiBytes, &apiConfig); err != nil {
-		log.Fatalf("Error parsing API routes JSON: %v", err)
-	}
-	for _, route := range apiConfig.Routes {
-		var prefix string
-		if apiConfig.Prefix != "" {
-			prefix = "/" + strings.Trim(apiConfig.Prefix, "/")
-		}
-		path := prefix + "/" + strings.Trim(route.RouteURI, "/")
-		handler, exists := handlerMapping[route.HandlerKey]
-		if !exists {
-			log.Printf("Handler not found for key: %s", route.HandlerKey)
-			continue
-		}
-		if route.Schema != nil {
-			router.CompileSchema(path, route.RouteMethod, route.Schema)
-		}
-		dynamicRouter.AddRoute(route.RouteMethod, route.RouteURI, handler)
+		return fmt.Errorf("Error parsing API routes JSON: %v", err)
 	}
+	apiConfig.Schemas = append(apiConfig.Schemas, routeSchemas...)
+	return dynamicRouter.LoadManifest("api.json", apiConfig, handlerMapping, schemaRegistry)
 }
 
 // ReloadRoutes reinitializes the dynamic routes, API endpoints, and schemas.
-func ReloadRoutes() {
+// The new routes are built on a staged router and swapped in only if they
+// all load, so a broken config leaves the running routes untouched.
+func ReloadRoutes() error {
 	log.Println("Reloading routes, schemas, and API endpoints...")
-	// Clear all previously added routes.
-	dynamicRouter.ClearRoutes()
+	staged := dynamicRouter.Stage()
+	if err := loadRoutes(staged); err != nil {
+		return err
+	}
+	dynamicRouter.Swap(staged)
 
+	log.Println("Routes reloaded. Registered routes:", dynamicRouter.ListRoutes())
+	return nil
+}
+
+// loadRoutes registers every dynamic route on a staged router.
+func loadRoutes(staged *router.Router) error {
 	// Reload compiled schemas and API endpoints.
-	initAPIEndpointsAndRenderer()
+	if err := initAPIEndpointsAndRenderer(staged); err != nil {
+		return err
+	}
 
 	// Re-register any additional dynamic routes (e.g. the "/hello" sample route).
-	dynamicRouter.AddRoute("GET", "/hello", func(c *fiber.Ctx) error {
+	staged.AddRoute("GET", "/hello", func(c *fiber.Ctx) error {
 		return c.SendString("Hello from the dynamic router!")
 	})
 
 	// Ensure the reload endpoint is registered.
-	dynamicRouter.AddRoute("GET", "/reload", reloadHandler)
-
-	log.Println("Routes reloaded. Registered routes:", dynamicRouter.ListRoutes())
+	staged.AddRoute("POST", "/reload", reloadHandler)
+	staged.ServeOpenAPI(openAPIConfig)
+	return nil
 }
 
 // reloadHandler is an HTTP handler that triggers a reload.
 func reloadHandler(c *fiber.Ctx) error {
-	ReloadRoutes()
+	if err := ReloadRoutes(); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).SendString("Reload failed: " + err.Error())
+	}
 	return c.SendString("Routes reloaded")
 }
 
@@ -248,6 +286,15 @@ func main() {
 	})
 	// Register the reload endpoint.
 	dynamicRouter.AddRoute("POST", "/reload", reloadHandler)
+	// Reload the routes when their manifests change on disk.
+	stopWatch, err := dynamicRouter.WatchManifests(watcher.Config{
+		Roots:   []string{"."},
+		Include: []string{"api.json", "schema.json", "renderer.json"},
+		Exclude: append(watcher.DefaultExclude, "configs", "static", "website*"),
+	}, loadRoutes)
+	if err != nil {
+		log.Fatalf("Error watching route manifests: %v", err)
+	}
 	go func() {
 		time.Sleep(5 * time.Second)
 		dynamicRouter.UpdateRoute("GET", "/hello", func(c *fiber.Ctx) error {
@@ -264,6 +311,7 @@ func main() {
 		signal.Notify(quit, os.Interrupt)
 		<-quit
 		log.Println("Shutting down gracefully...")
+		stopWatch()
 		if err := app.Shutdown(); err != nil {
 			log.Fatalf("Shutdown error: %v", err)
 		}
@@ -3,22 +3,25 @@ module github.com/oarkflow/router
 go 1.24.2
 
 require (
+	github.com/brianvoe/gofakeit/v6 v6.28.0
 	github.com/fsnotify/fsnotify v1.9.0
 	github.com/gofiber/fiber/v2 v2.52.6
 	github.com/oarkflow/json v0.0.24
 	github.com/oarkflow/log v1.0.82
 	github.com/sergi/go-diff v1.3.1
+	github.com/tinylib/msgp v1.2.5
 	go.etcd.io/bbolt v1.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/brianvoe/gofakeit/v6 v6.28.0 // indirect
 	github.com/goccy/go-reflect v1.2.0 // indirect
 	github.com/gofiber/template v1.8.3 // indirect
 	github.com/gofiber/utils v1.1.0 // indirect
 	github.com/oarkflow/date v0.0.4 // indirect
 	github.com/oarkflow/expr v0.0.11 // indirect
 	github.com/oarkflow/xid v1.2.5 // indirect
+	github.com/philhofer/fwd v1.1.3-0.20240916144458-20a13a1f6b7c // indirect
 )
 
 require (
@@ -30,7 +33,7 @@ require (
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-runewidth v0.0.16 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
-	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	github.com/valyala/fasthttp v1.60.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0
+	github.com/valyala/fasthttp v1.60.0
 	golang.org/x/sys v0.32.0 // indirect
 )
@@ -0,0 +1,182 @@
+package router
+
+import (
+	"fmt"
+	"html/template"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/oarkflow/log"
+)
+
+// DotfilesPolicy controls whether entries starting with a dot are listed.
+type DotfilesPolicy int
+
+const (
+	// DotfilesHide omits dotfiles from directory listings.
+	DotfilesHide DotfilesPolicy = iota
+	// DotfilesShow includes dotfiles in directory listings.
+	DotfilesShow
+)
+
+// ListingEntry describes a single file or directory in a listing.
+type ListingEntry struct {
+	Name    string    `json:"name"`
+	Href    string    `json:"href"`
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Type    string    `json:"type"`
+}
+
+// HumanSize returns the entry size in a human-readable form.
+func (e ListingEntry) HumanSize() string {
+	if e.IsDir {
+		return "-"
+	}
+	const unit = 1024
+	if e.Size < unit {
+		return fmt.Sprintf("%d B", e.Size)
+	}
+	div, exp := int64(unit), 0
+	for n := e.Size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(e.Size)/float64(div), "KMGTPE"[exp])
+}
+
+// DirectoryListing is the data passed to the listing template and
+// returned as JSON when the client asks for application/json.
+type DirectoryListing struct {
+	Path    string         `json:"path"`
+	Parent  string         `json:"parent,omitempty"`
+	Sort    string         `json:"sort"`
+	Order   string         `json:"order"`
+	Entries []ListingEntry `json:"entries"`
+}
+
+// SortLink returns the query string that sorts the listing by key,
+// toggling the order when key is already the active sort column.
+func (l DirectoryListing) SortLink(key string) string {
+	order := "asc"
+	if l.Sort == key && l.Order == "asc" {
+		order = "desc"
+	}
+	return "?sort=" + url.QueryEscape(key) + "&order=" + order
+}
+
+// DefaultListingTemplate renders directory listings when no custom
+// template is configured on the static route.
+var DefaultListingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html><head><meta charset="UTF-8"><title>Index of {{.Path}}</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse}th,td{padding:2px 12px;text-align:left}.dir{font-weight:bold}</style>
+</head><body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th><a href="{{.SortLink "name"}}">Name</a></th><th><a href="{{.SortLink "size"}}">Size</a></th><th><a href="{{.SortLink "modified"}}">Modified</a></th><th><a href="{{.SortLink "type"}}">Type</a></th></tr>
+{{if .Parent}}<tr><td><a href="{{.Parent}}" class="dir">..</a></td><td></td><td></td><td></td></tr>{{end}}
+{{range .Entries}}<tr><td><a href="{{.Href}}"{{if .IsDir}} class="dir"{{end}}>{{.Name}}{{if .IsDir}}/{{end}}</a></td><td>{{.HumanSize}}</td><td>{{.ModTime.Format "2006-01-02 15:04:05"}}</td><td>{{.Type}}</td></tr>
+{{end}}</table>
+</body></html>`))
+
+// serveDirectoryListing writes the listing of dir for the current request.
+func (dr *Router) serveDirectoryListing(c *fiber.Ctx, sr Static, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to read directory: %s", dir)
+		return c.Status(500).SendString("Error reading directory")
+	}
+	urlPath := c.Path()
+	listing := DirectoryListing{
+		Path:    urlPath,
+		Sort:    strings.ToLower(c.Query("sort", "name")),
+		Order:   strings.ToLower(c.Query("order", "asc")),
+		Entries: make([]ListingEntry, 0, len(entries)),
+	}
+	if trimmed := strings.TrimSuffix(urlPath, "/"); trimmed != "" && trimmed != strings.TrimSuffix(sr.Prefix, "/") {
+		listing.Parent = path.Dir(trimmed)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if sr.Dotfiles == DotfilesHide && strings.HasPrefix(name, ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		item := ListingEntry{
+			Name:    name,
+			Href:    path.Join("/", urlPath, url.PathEscape(name)),
+			IsDir:   info.IsDir(),
+			ModTime: info.ModTime(),
+		}
+		if item.IsDir {
+			item.Href += "/"
+			item.Type = "directory"
+		} else {
+			item.Size = info.Size()
+			item.Type = mime.TypeByExtension(filepath.Ext(name))
+			if item.Type == "" {
+				item.Type = "application/octet-stream"
+			}
+		}
+		listing.Entries = append(listing.Entries, item)
+	}
+	sortListing(&listing)
+	c.Vary(fiber.HeaderAccept)
+	if c.Accepts(fiber.MIMETextHTML, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON {
+		return c.JSON(listing)
+	}
+	tmpl := sr.ListingTemplate
+	if tmpl == nil {
+		tmpl = DefaultListingTemplate
+	}
+	var builder strings.Builder
+	if err := tmpl.Execute(&builder, listing); err != nil {
+		log.Error().Err(err).Msgf("Failed to render directory listing: %s", dir)
+		return c.Status(500).SendString("Error rendering directory listing")
+	}
+	c.Response().Header.Set("Content-Type", fiber.MIMETextHTMLCharsetUTF8)
+	return c.SendString(builder.String())
+}
+
+// sortListing orders entries by the listing's sort key and order.
+// Directories are always listed before files.
+func sortListing(listing *DirectoryListing) {
+	var less func(a, b ListingEntry) bool
+	switch listing.Sort {
+	case "size":
+		less = func(a, b ListingEntry) bool { return a.Size < b.Size }
+	case "modified", "mtime", "date":
+		listing.Sort = "modified"
+		less = func(a, b ListingEntry) bool { return a.ModTime.Before(b.ModTime) }
+	case "type":
+		less = func(a, b ListingEntry) bool { return a.Type < b.Type }
+	default:
+		listing.Sort = "name"
+		less = func(a, b ListingEntry) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }
+	}
+	if listing.Order != "desc" {
+		listing.Order = "asc"
+	}
+	desc := listing.Order == "desc"
+	sort.SliceStable(listing.Entries, func(i, j int) bool {
+		a, b := listing.Entries[i], listing.Entries[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		if desc {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+}
@@ -0,0 +1,160 @@
+package router
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// listingDir creates a directory with files of distinct sizes and
+// modification times, a subdirectory, a dotfile and a file whose name
+// needs HTML escaping.
+func listingDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	now := time.Now()
+	for i, file := range []struct {
+		name string
+		size int
+	}{
+		{"b.txt", 30},
+		{"a.html", 10},
+		{"C.json", 20},
+		{".env", 1},
+		{"<i>&.txt", 1},
+	} {
+		name := filepath.Join(dir, file.name)
+		if err := os.WriteFile(name, []byte(strings.Repeat("x", file.size)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(time.Duration(i) * time.Hour)
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// listing requests a directory listing as JSON.
+func listing(t *testing.T, app *fiber.App, target string) DirectoryListing {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodGet, target, nil)
+	req.Header.Set(fiber.HeaderAccept, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get(fiber.HeaderContentType); !strings.HasPrefix(ct, fiber.MIMEApplicationJSON) {
+		t.Fatalf("GET %s: Content-Type = %q, want JSON", target, ct)
+	}
+	if vary := resp.Header.Get(fiber.HeaderVary); !strings.Contains(vary, fiber.HeaderAccept) {
+		t.Errorf("GET %s: Vary = %q, want Accept", target, vary)
+	}
+	var l DirectoryListing
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func entryNames(l DirectoryListing) string {
+	names := make([]string, len(l.Entries))
+	for i, e := range l.Entries {
+		names[i] = e.Name
+	}
+	return strings.Join(names, " ")
+}
+
+func TestDirectoryListingSort(t *testing.T) {
+	app := fiber.New()
+	dr := New(app)
+	dr.Static("/files", listingDir(t), StaticConfig{DirectoryListing: true})
+	for _, tc := range []struct {
+		query       string
+		sort, order string
+		names       string
+	}{
+		{"", "name", "asc", "sub <i>&.txt a.html b.txt C.json"},
+		{"?order=desc", "name", "desc", "sub C.json b.txt a.html <i>&.txt"},
+		{"?sort=size", "size", "asc", "sub <i>&.txt a.html C.json b.txt"},
+		{"?sort=size&order=desc", "size", "desc", "sub b.txt C.json a.html <i>&.txt"},
+		{"?sort=mtime", "modified", "asc", "sub b.txt a.html C.json <i>&.txt"},
+		{"?sort=type&order=DESC", "type", "desc", "sub <i>&.txt b.txt a.html C.json"},
+		{"?sort=bogus&order=bogus", "name", "asc", "sub <i>&.txt a.html b.txt C.json"},
+	} {
+		l := listing(t, app, "/files/"+tc.query)
+		if l.Sort != tc.sort || l.Order != tc.order || entryNames(l) != tc.names {
+			t.Errorf("GET /files/%s = %s %s [%s], want %s %s [%s]", tc.query, l.Sort, l.Order, entryNames(l), tc.sort, tc.order, tc.names)
+		}
+	}
+}
+
+func TestDirectoryListingJSON(t *testing.T) {
+	app := fiber.New()
+	dr := New(app)
+	dr.Static("/files", listingDir(t), StaticConfig{DirectoryListing: true})
+	l := listing(t, app, "/files/")
+	if l.Path != "/files/" {
+		t.Errorf("path = %q, want /files/", l.Path)
+	}
+	for _, e := range l.Entries {
+		switch e.Name {
+		case "sub":
+			if !e.IsDir || e.Href != "/files/sub/" || e.Type != "directory" {
+				t.Errorf("directory entry = %+v", e)
+			}
+		case "C.json":
+			if e.IsDir || e.Size != 20 || e.Href != "/files/C.json" || e.Type != "application/json" {
+				t.Errorf("file entry = %+v", e)
+			}
+		}
+	}
+	if sub := listing(t, app, "/files/sub"); sub.Parent != "/files" || len(sub.Entries) != 0 {
+		t.Errorf("GET /files/sub = %+v", sub)
+	}
+}
+
+func TestDirectoryListingDotfiles(t *testing.T) {
+	app := fiber.New()
+	dr := New(app)
+	dir := listingDir(t)
+	dr.Static("/hidden", dir, StaticConfig{DirectoryListing: true})
+	dr.Static("/shown", dir, StaticConfig{DirectoryListing: true, Dotfiles: DotfilesShow})
+	if names := entryNames(listing(t, app, "/hidden/")); strings.Contains(names, ".env") {
+		t.Errorf("hidden listing = %s", names)
+	}
+	if names := entryNames(listing(t, app, "/shown/")); !strings.Contains(names, ".env") {
+		t.Errorf("shown listing = %s", names)
+	}
+}
+
+func TestDirectoryListingHTML(t *testing.T) {
+	app := fiber.New()
+	dr := New(app)
+	dr.Static("/files", listingDir(t), StaticConfig{DirectoryListing: true})
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/files/?sort=size", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != fiber.MIMETextHTMLCharsetUTF8 {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	page := string(body)
+	if strings.Contains(page, "<i>") || !strings.Contains(page, "&lt;i&gt;&amp;.txt") {
+		t.Errorf("file name not escaped:\n%s", page)
+	}
+	if !strings.Contains(page, `href="?sort=size&amp;order=desc"`) {
+		t.Errorf("size sort link does not toggle the order:\n%s", page)
+	}
+}
@@ -0,0 +1,226 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/oarkflow/json"
+	"github.com/oarkflow/log"
+
+	"github.com/oarkflow/router/watcher"
+)
+
+// Manifest declares API routes in configuration, in the format of api.json.
+type Manifest struct {
+	// Prefix is prepended to the URI of every route.
+	Prefix string        `json:"prefix"`
+	Routes []RouteConfig `json:"routes"`
+	// Schemas binds request schemas to routes that do not declare their
+	// own, in the format of schema.json.
+	Schemas []SchemaConfig `json:"schemas,omitempty"`
+}
+
+// RouteConfig declares a route of a Manifest.
+type RouteConfig struct {
+	RouteURI    string            `json:"route_uri"`
+	RouteMethod string            `json:"route_method"`
+	Description string            `json:"description"`
+	Model       string            `json:"model"`
+	Operation   string            `json:"operation"`
+	HandlerKey  string            `json:"handler_key"`
+	Schema      json.RawMessage   `json:"schema,omitempty"`
+	Rules       map[string]string `json:"rules,omitempty"`
+	// Kind selects a built-in handler instead of HandlerKey, e.g. "template".
+	Kind     string          `json:"kind,omitempty"`
+	Template *TemplateConfig `json:"template,omitempty"`
+}
+
+// SchemaConfig binds a request schema to the route with the same URI and
+// method.
+type SchemaConfig struct {
+	RouteURI    string          `json:"route_uri"`
+	RouteMethod string          `json:"route_method"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+}
+
+// Path returns the path the route is served at.
+func (m Manifest) Path(route RouteConfig) string {
+	var prefix string
+	if m.Prefix != "" {
+		prefix = "/" + strings.Trim(m.Prefix, "/")
+	}
+	return prefix + "/" + strings.Trim(route.RouteURI, "/")
+}
+
+// DecodeManifest decodes a manifest in the format of api.json. Unknown
+// fields are rejected, so that misspelled keys are reported rather than
+// silently ignored.
+func DecodeManifest(data []byte) (Manifest, error) {
+	var m Manifest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
+
+// manifestRoute is a resolved route of a Manifest.
+type manifestRoute struct {
+	method, path string
+	handler      fiber.Handler
+	opts         []RouteOption
+}
+
+// routeShape returns the pattern of a path with parameter names removed,
+// so that "/users/:id" and "/users/:name" have the same shape.
+func routeShape(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = ":"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// resolve binds the handler and compiles the schemas of every route of the
+// manifest, and checks that no two routes are served at the same path.
+func (m Manifest) resolve(source string, registry HandlerRegistry, schemas *SchemaRegistry) ([]manifestRoute, error) {
+	// Each schema is compiled under its own source, e.g. "api.json#routes/POST
+	// /users", as the registry recompiles one schema per source.
+	compile := func(key string, raw json.RawMessage) (*Schema, error) {
+		if schemas != nil {
+			return schemas.Compile(source+"#"+key, raw)
+		}
+		return CompileSchema(raw)
+	}
+	bound := make(map[string]*Schema, len(m.Schemas))
+	var errs []error
+	for _, entry := range m.Schemas {
+		key := strings.ToUpper(entry.RouteMethod) + " " + entry.RouteURI
+		schema, err := compile("schemas/"+key, entry.Schema)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: schema for %s: %w", source, key, err))
+			continue
+		}
+		bound[key] = schema
+	}
+	routes := make([]manifestRoute, 0, len(m.Routes))
+	// shapes maps the shape of each route to its path, to find duplicate
+	// and conflicting routes.
+	shapes := make(map[string]string, len(m.Routes))
+	for i, route := range m.Routes {
+		method := strings.ToUpper(route.RouteMethod)
+		path := m.Path(route)
+		if strings.TrimSpace(route.RouteURI) == "" {
+			errs = append(errs, fmt.Errorf("%s: route %d: route_uri is required", source, i))
+			continue
+		}
+		if !slices.Contains(fiber.DefaultMethods, method) {
+			errs = append(errs, fmt.Errorf("%s: %s: invalid route_method %q", source, path, route.RouteMethod))
+			continue
+		}
+		shape := method + " " + routeShape(path)
+		if other, ok := shapes[shape]; ok {
+			if other == path {
+				errs = append(errs, fmt.Errorf("%s: %s %s: duplicate route", source, method, path))
+			} else {
+				errs = append(errs, fmt.Errorf("%s: %s %s: conflicts with %s", source, method, path, other))
+			}
+			continue
+		}
+		shapes[shape] = path
+		var handler fiber.Handler
+		switch route.Kind {
+		case "":
+			h, ok := registry[route.HandlerKey]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: %s %s: handler not found for key %q", source, method, path, route.HandlerKey))
+				continue
+			}
+			handler = h
+		case HandlerKindTemplate:
+			if route.Template == nil {
+				errs = append(errs, fmt.Errorf("%s: %s %s: template route has no template config", source, method, path))
+				continue
+			}
+			if err := route.Template.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s %s: %w", source, method, path, err))
+				continue
+			}
+			handler = route.Template.Handler()
+		default:
+			errs = append(errs, fmt.Errorf("%s: %s %s: unknown route kind %q", source, method, path, route.Kind))
+			continue
+		}
+		opts := []RouteOption{WithDescription(route.Description), WithConfig(route)}
+		if route.Schema != nil {
+			schema, err := compile("routes/"+method+" "+path, route.Schema)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: schema for %s %s: %w", source, method, path, err))
+				continue
+			}
+			opts = append(opts, WithRequestSchema(schema))
+		} else if schema, ok := bound[method+" "+route.RouteURI]; ok {
+			opts = append(opts, WithRequestSchema(schema))
+		}
+		routes = append(routes, manifestRoute{method: method, path: path, handler: handler, opts: opts})
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return routes, nil
+}
+
+// Validate checks a manifest as LoadManifest does, without registering
+// anything: methods and URIs are valid, handler keys resolve in registry,
+// schemas compile and no two routes are served at the same path.
+func (m Manifest) Validate(source string, registry HandlerRegistry, schemas *SchemaRegistry) error {
+	_, err := m.resolve(source, registry, schemas)
+	return err
+}
+
+// LoadManifest registers the routes of a manifest. Handlers are bound by
+// handler key from registry, or built from the route's kind. Schemas are
+// compiled with schemas so that they may reference shared definitions; it
+// may be nil. source names the manifest in errors, e.g. its file.
+//
+// Every route is resolved and every schema compiled before any route is
+// added, so nothing is registered when an error is returned. Combined with
+// Stage and Swap it checks a manifest without touching the live routes.
+func (dr *Router) LoadManifest(source string, m Manifest, registry HandlerRegistry, schemas *SchemaRegistry) error {
+	routes, err := m.resolve(source, registry, schemas)
+	if err != nil {
+		return err
+	}
+	for _, r := range routes {
+		dr.AddRouteWithOptions(r.method, r.path, r.handler, r.opts)
+	}
+	log.Info().Str("source", source).Int("routes", len(routes)).Msg("Loaded route manifest")
+	return nil
+}
+
+// WatchManifests rebuilds the routes whenever a file watched by cfg, such
+// as an api.json, changes. load registers every route on a staged router,
+// see Stage; the routes are swapped in only if it succeeds, so a broken
+// manifest leaves the running routes untouched. Call the returned function
+// to stop watching.
+func (dr *Router) WatchManifests(cfg watcher.Config, load func(staged *Router) error) (func() error, error) {
+	w, err := watcher.New(cfg, func(events []watcher.Event) {
+		staged := dr.Stage()
+		if err := load(staged); err != nil {
+			log.Error().Err(err).Str("file", events[0].Path).Msg("Route manifest reload failed")
+			return
+		}
+		dr.Swap(staged)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w.Close, nil
+}
@@ -5,31 +5,43 @@ import (
 	"github.com/oarkflow/json"
 )
 
-// ValidateRequestBySchema - validates each request that has schema validation
+// RouteFromCtx returns the dynamic route matched for the request, if any.
+func RouteFromCtx(c *fiber.Ctx) *Route {
+	route, _ := c.Locals("route").(*Route)
+	return route
+}
+
+// ValidateRequestBySchema - validates each request that has schema validation.
+// JSON bodies are replaced by the validated data with defaults applied; form,
+// multipart and XML bodies keep their encoding unless the route was added
+// with WithNormalizedBody. A request is validated once, even when the
+// middleware is both global and on the route.
 func (dr *Router) ValidateRequestBySchema(c *fiber.Ctx) error {
-	route, matched, _ := dr.MatchRoute(c.Method(), c.Path())
-	if !matched {
+	route := RouteFromCtx(c)
+	if route == nil || route.RequestSchema == nil {
 		return Next(c)
 	}
-	key := route.Method + ":" + route.Path
-	compiledSchemas.m.Lock()
-	schema, exists := compiledSchemas.items[key]
-	compiledSchemas.m.Unlock()
-	if !exists {
+	if _, validated := c.Locals("request_params").(*RequestParams); validated {
 		return Next(c)
 	}
-	body := c.Body()
-	if len(body) == 0 {
+	merged, err := route.RequestSchema.ValidateRequest(c)
+	if err != nil {
+		return err
+	}
+	if merged == nil {
 		return Next(c)
 	}
-	var intermediate any
-	if err := schema.UnmarshalFiberCtx(c, &intermediate); err != nil {
-		return err
+	encoding := bodyEncoding(c)
+	if encoding != EncodingJSON && !route.NormalizeBody {
+		return Next(c)
 	}
-	mergedBytes, err := json.Marshal(intermediate)
+	mergedBytes, err := json.Marshal(merged)
 	if err != nil {
 		return err
 	}
 	c.Request().SetBody(mergedBytes)
+	if encoding != EncodingJSON {
+		c.Request().Header.SetContentType(fiber.MIMEApplicationJSON)
+	}
 	return Next(c)
 }
@@ -0,0 +1,688 @@
+package router
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"html/template"
+	"io/fs"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/oarkflow/log"
+	"gopkg.in/yaml.v3"
+)
+
+// OpenAPIInfo describes the API in the generated document.
+type OpenAPIInfo struct {
+	Title       string
+	Version     string
+	Description string
+	// Servers lists the base URLs the API is served from.
+	Servers []string
+}
+
+// SecurityScheme is an OpenAPI security scheme, e.g. http bearer or apiKey.
+type SecurityScheme struct {
+	// Type is one of "http", "apiKey", "oauth2" or "openIdConnect".
+	Type string
+	// Scheme is the HTTP authorization scheme for type "http", e.g. "bearer".
+	Scheme       string
+	BearerFormat string
+	// In and Name locate the key for type "apiKey".
+	In          string
+	Name        string
+	Description string
+}
+
+// Security is a middleware enforcing a security scheme, returned by
+// RegisterSecurity. Routes guarded by it through UseSecurity, Group.Use or
+// WithSecurity list the scheme as a security requirement in the OpenAPI
+// document.
+type Security struct {
+	name    string
+	scheme  SecurityScheme
+	handler fiber.Handler
+}
+
+// OpenAPIConfig configures the endpoints registered by ServeOpenAPI.
+type OpenAPIConfig struct {
+	// Info describes the API.
+	Info OpenAPIInfo
+	// Path serves the document. Path+".json" and Path+".yaml" always return
+	// that format, Path itself negotiates on the Accept header.
+	//
+	// Optional. Default: "/openapi"
+	Path string
+	// UI selects an HTML viewer: "swagger", "redoc" or "" for none.
+	//
+	// Optional. Default: ""
+	UI string
+	// UIPath serves the HTML viewer.
+	//
+	// Optional. Default: "/docs"
+	UIPath string
+	// UIAssets locates the viewer's script and stylesheet, e.g. to serve
+	// them from the app or to check them with Subresource Integrity.
+	//
+	// Optional. Default: a pinned release of the viewer on its CDN
+	UIAssets UIAssets
+	// UIFiles bundles the viewer with the app, e.g. through go:embed. Its
+	// script and stylesheet, swagger-ui-bundle.js and swagger-ui.css from
+	// swagger-ui-dist or redoc.standalone.js from redoc, are served below
+	// UIPath with integrity hashes, in place of UIAssets.
+	//
+	// Optional. Default: nil
+	UIFiles fs.FS
+}
+
+// UIAssets are the files loaded by an OpenAPI viewer. An integrity hash,
+// e.g. "sha384-...", makes the browser refuse a file that does not match.
+type UIAssets struct {
+	Script              string
+	ScriptIntegrity     string
+	Stylesheet          string
+	StylesheetIntegrity string
+}
+
+// WithSummary sets the short summary shown for the route in the OpenAPI document.
+func WithSummary(summary string) RouteOption {
+	return func(r *Route) {
+		r.Summary = summary
+	}
+}
+
+// WithDescription sets the description of the route in the OpenAPI document.
+func WithDescription(description string) RouteOption {
+	return func(r *Route) {
+		r.Description = description
+	}
+}
+
+// WithOperationID sets the OpenAPI operationId of the route. Routes without
+// one get an ID derived from the method and path.
+func WithOperationID(id string) RouteOption {
+	return func(r *Route) {
+		r.OperationID = id
+	}
+}
+
+// WithTags adds OpenAPI tags to the route.
+func WithTags(tags ...string) RouteOption {
+	return func(r *Route) {
+		r.Tags = append(r.Tags, tags...)
+	}
+}
+
+// WithHidden leaves the route out of the OpenAPI document.
+func WithHidden() RouteOption {
+	return func(r *Route) {
+		r.Hidden = true
+	}
+}
+
+// RegisterSecurity returns a handle declaring that mw enforces the named
+// security scheme. Add the handle, not mw, to the routes it guards: the
+// scheme is documented for the handle, so middlewares built by the same
+// function for different schemes are told apart.
+func (dr *Router) RegisterSecurity(name string, scheme SecurityScheme, mw fiber.Handler) *Security {
+	log.Info().Str("name", name).Str("type", scheme.Type).Msg("Registered security middleware")
+	return &Security{name: name, scheme: scheme, handler: mw}
+}
+
+// entry returns the middleware entry of the handle.
+func (s *Security) entry() middlewareEntry {
+	entry := wrapMiddleware(s.handler)
+	entry.security = s
+	return entry
+}
+
+// UseSecurity adds security middlewares to the global middleware chain.
+func (dr *Router) UseSecurity(security ...*Security) {
+	for _, s := range security {
+		dr.GlobalMiddlewares = append(dr.GlobalMiddlewares, s.entry())
+	}
+	log.Info().Int("count", len(security)).Msg("Added security to global middleware")
+}
+
+// WithSecurity guards the route with security middlewares, run before its
+// other middlewares.
+func WithSecurity(security ...*Security) RouteOption {
+	return func(r *Route) {
+		entries := make([]middlewareEntry, 0, len(security)+len(r.Middlewares))
+		for _, s := range security {
+			entries = append(entries, s.entry())
+		}
+		r.Middlewares = append(entries, r.Middlewares...)
+	}
+}
+
+// routeSnapshot returns copies of all dynamic routes sorted by path and method.
+func (dr *Router) routeSnapshot() []Route {
+	var routes []Route
+	dr.table().routes.Range(func(key, value any) bool {
+		mr := value.(*methodRoutes)
+		mr.mu.RLock()
+		for _, route := range mr.exact {
+			routes = append(routes, *route)
+		}
+		for _, route := range mr.params {
+			routes = append(routes, *route)
+		}
+		mr.mu.RUnlock()
+		return true
+	})
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// OpenAPI builds an OpenAPI 3.1 document from the routes currently
+// registered, so it reflects every runtime change.
+func (dr *Router) OpenAPI(info OpenAPIInfo) map[string]any {
+	infoObj := map[string]any{
+		"title":   info.Title,
+		"version": info.Version,
+	}
+	if infoObj["title"] == "" {
+		infoObj["title"] = "API"
+	}
+	if infoObj["version"] == "" {
+		infoObj["version"] = "1.0.0"
+	}
+	if info.Description != "" {
+		infoObj["description"] = info.Description
+	}
+	doc := map[string]any{
+		"openapi": "3.1.0",
+		"info":    infoObj,
+	}
+	if len(info.Servers) > 0 {
+		servers := make([]any, len(info.Servers))
+		for i, url := range info.Servers {
+			servers[i] = map[string]any{"url": url}
+		}
+		doc["servers"] = servers
+	}
+	paths := map[string]any{}
+	schemas := map[string]any{}
+	securitySchemes := map[string]any{}
+	globalSecurity := map[string]any{}
+	addSecurity(globalSecurity, dr.GlobalMiddlewares, securitySchemes)
+	for _, route := range dr.routeSnapshot() {
+		if route.Hidden {
+			continue
+		}
+		path, pathParams := openAPIPath(route.Path)
+		item, _ := paths[path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[path] = item
+		}
+		op := openAPIOperation(route, pathParams, schemas)
+		// Chained security middlewares all apply, so their schemes form a
+		// single requirement rather than alternatives.
+		security := maps.Clone(globalSecurity)
+		addSecurity(security, route.Middlewares, securitySchemes)
+		if len(security) > 0 {
+			op["security"] = []any{security}
+		}
+		item[strings.ToLower(route.Method)] = op
+	}
+	doc["paths"] = paths
+	components := map[string]any{}
+	if len(schemas) > 0 {
+		components["schemas"] = schemas
+	}
+	if len(securitySchemes) > 0 {
+		components["securitySchemes"] = securitySchemes
+	}
+	if len(components) > 0 {
+		doc["components"] = components
+	}
+	return doc
+}
+
+// openAPIOperation describes a single route as an OpenAPI operation.
+func openAPIOperation(route Route, pathParams []string, schemas map[string]any) map[string]any {
+	opID := route.OperationID
+	if opID == "" {
+		opID = operationID(route.Method, route.Path)
+	}
+	op := map[string]any{"operationId": opID}
+	if route.Summary != "" {
+		op["summary"] = route.Summary
+	}
+	if route.Description != "" {
+		op["description"] = route.Description
+	}
+	if len(route.Tags) > 0 {
+		op["tags"] = route.Tags
+	}
+	var parameters []any
+	declared := map[string]bool{}
+	if route.RequestSchema != nil {
+		doc, _ := route.RequestSchema.document().(map[string]any)
+		base := "#/components/schemas/" + opID + "Request"
+		params, body := splitSchemaParameters(doc, base)
+		for _, p := range params {
+			if p["in"] == LocationPath {
+				declared[p["name"].(string)] = true
+			}
+			parameters = append(parameters, p)
+		}
+		if body != nil {
+			schemas[opID+"Request"] = body
+		}
+		if body != nil && route.Method != fiber.MethodGet && route.Method != fiber.MethodHead {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					fiber.MIMEApplicationJSON: map[string]any{
+						"schema": map[string]any{"$ref": base},
+					},
+				},
+			}
+		}
+	}
+	for _, name := range pathParams {
+		if declared[name] {
+			continue
+		}
+		parameters = append(parameters, map[string]any{
+			"name":     name,
+			"in":       LocationPath,
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+	if len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+	responses := map[string]any{}
+	statuses := make([]int, 0, len(route.ResponseSchemas))
+	for status := range route.ResponseSchemas {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		key, desc, name := strconv.Itoa(status), http.StatusText(status), opID+"Response"+strconv.Itoa(status)
+		if status == 0 {
+			key, desc, name = "default", "Default response", opID+"ResponseDefault"
+		}
+		resp := map[string]any{"description": desc}
+		if schema := route.ResponseSchemas[status]; schema != nil {
+			base := "#/components/schemas/" + name
+			schemas[name] = rewriteRefs(stripParameterKeywords(schema.document()), base)
+			resp["content"] = map[string]any{
+				fiber.MIMEApplicationJSON: map[string]any{
+					"schema": map[string]any{"$ref": base},
+				},
+			}
+		}
+		responses[key] = resp
+	}
+	if len(responses) == 0 {
+		responses["200"] = map[string]any{"description": http.StatusText(fiber.StatusOK)}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// addSecurity adds the scheme of every security handle in chain to the
+// requirement and to securitySchemes.
+func addSecurity(requirement map[string]any, chain []middlewareEntry, securitySchemes map[string]any) {
+	for _, m := range chain {
+		sec := m.security
+		if sec == nil {
+			continue
+		}
+		securitySchemes[sec.name] = sec.scheme.object()
+		requirement[sec.name] = []any{}
+	}
+}
+
+// object returns the scheme as an OpenAPI security scheme object.
+func (s SecurityScheme) object() map[string]any {
+	obj := map[string]any{"type": s.Type}
+	for key, val := range map[string]string{
+		"scheme":       s.Scheme,
+		"bearerFormat": s.BearerFormat,
+		"in":           s.In,
+		"name":         s.Name,
+		"description":  s.Description,
+	} {
+		if val != "" {
+			obj[key] = val
+		}
+	}
+	return obj
+}
+
+// splitSchemaParameters separates the path, query, header and cookie
+// parameters of a request schema from the properties of its body.
+func splitSchemaParameters(doc map[string]any, base string) ([]map[string]any, map[string]any) {
+	if doc == nil {
+		return nil, nil
+	}
+	props, _ := doc["properties"].(map[string]any)
+	required := map[string]bool{}
+	if list, ok := doc["required"].([]any); ok {
+		for _, name := range list {
+			if s, ok := name.(string); ok {
+				required[s] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var params []map[string]any
+	bodyProps := map[string]any{}
+	var bodyRequired []any
+	for _, name := range names {
+		prop, _ := props[name].(map[string]any)
+		in, _ := prop["in"].(string)
+		location := normalizeLocation(in)
+		if in == "" || location == LocationBody {
+			bodyProps[name] = rewriteRefs(stripParameterKeywords(props[name]), base)
+			if required[name] {
+				bodyRequired = append(bodyRequired, name)
+			}
+			continue
+		}
+		field := name
+		if f, ok := prop["field"].(string); ok && f != "" {
+			field = f
+		}
+		param := map[string]any{
+			"name":     field,
+			"in":       location,
+			"required": required[name] || location == LocationPath,
+			"schema":   rewriteRefs(stripParameterKeywords(prop), base),
+		}
+		if desc, ok := prop["description"].(string); ok {
+			param["description"] = desc
+		}
+		if types := schemaTypes(prop["type"]); len(types) == 1 && types[0] == "array" {
+			param["style"] = "form"
+			param["explode"] = false
+		}
+		params = append(params, param)
+	}
+	if props == nil {
+		return params, rewriteRefs(stripParameterKeywords(doc), base).(map[string]any)
+	}
+	if len(bodyProps) == 0 {
+		return params, nil
+	}
+	body := map[string]any{}
+	for key, val := range doc {
+		switch key {
+		case "properties", "required", "$schema", "$id":
+		default:
+			body[key] = rewriteRefs(stripParameterKeywords(val), base)
+		}
+	}
+	body["properties"] = bodyProps
+	if len(bodyRequired) > 0 {
+		body["required"] = bodyRequired
+	}
+	return params, body
+}
+
+// stripParameterKeywords returns a copy of a schema without the "in" and
+// "field" keywords used to declare request parameters.
+func stripParameterKeywords(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for key, item := range val {
+			if key == "in" || key == "field" {
+				if _, isString := item.(string); isString {
+					continue
+				}
+			}
+			out[key] = stripParameterKeywords(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = stripParameterKeywords(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// rewriteRefs points local "$ref"s of a schema moved to base at their new
+// location in the OpenAPI document.
+func rewriteRefs(v any, base string) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for key, item := range val {
+			if ref, ok := item.(string); ok && key == "$ref" && strings.HasPrefix(ref, "#") {
+				out[key] = base + strings.TrimPrefix(ref, "#")
+				continue
+			}
+			out[key] = rewriteRefs(item, base)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = rewriteRefs(item, base)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// openAPIPath converts a route pattern to an OpenAPI path template and
+// returns the names of its path parameters.
+func openAPIPath(pattern string) (string, []string) {
+	segments := strings.Split(strings.Trim(pattern, "/"), "/")
+	var params []string
+	for i, seg := range segments {
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			name := strings.TrimSuffix(seg[1:], "?")
+			params = append(params, name)
+			segments[i] = "{" + name + "}"
+		case seg == "*":
+			params = append(params, "wildcard")
+			segments[i] = "{wildcard}"
+			segments = segments[:i+1]
+		}
+	}
+	return "/" + strings.Join(segments, "/"), params
+}
+
+// operationID derives an operationId such as "getUsersById" from a route.
+func operationID(method, pattern string) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(method))
+	for _, seg := range strings.Split(pattern, "/") {
+		if seg == "" {
+			continue
+		}
+		if strings.HasPrefix(seg, ":") {
+			sb.WriteString("By")
+			seg = strings.TrimSuffix(seg[1:], "?")
+		} else if seg == "*" {
+			seg = "wildcard"
+		}
+		for _, word := range strings.FieldsFunc(seg, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+		}) {
+			sb.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return sb.String()
+}
+
+// ServeOpenAPI registers hidden routes that serve the OpenAPI document as
+// JSON and YAML and, optionally, an HTML viewer. The document is rebuilt on
+// every request. Call it again after ClearRoutes.
+func (dr *Router) ServeOpenAPI(cfg ...OpenAPIConfig) {
+	var config OpenAPIConfig
+	if len(cfg) > 0 {
+		config = cfg[0]
+	}
+	if config.Path == "" {
+		config.Path = "/openapi"
+	}
+	if config.UIPath == "" {
+		config.UIPath = "/docs"
+	}
+	sendJSON := func(c *fiber.Ctx) error {
+		return c.JSON(dr.OpenAPI(config.Info))
+	}
+	sendYAML := func(c *fiber.Ctx) error {
+		out, err := yaml.Marshal(dr.OpenAPI(config.Info))
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, "application/yaml; charset=utf-8")
+		return c.Send(out)
+	}
+	dr.AddRouteWithOptions(fiber.MethodGet, config.Path+".json", sendJSON, []RouteOption{WithHidden()})
+	dr.AddRouteWithOptions(fiber.MethodGet, config.Path+".yaml", sendYAML, []RouteOption{WithHidden()})
+	dr.AddRouteWithOptions(fiber.MethodGet, config.Path, func(c *fiber.Ctx) error {
+		c.Vary(fiber.HeaderAccept)
+		if c.Accepts(fiber.MIMEApplicationJSON, "application/yaml", "application/x-yaml", "text/yaml") == fiber.MIMEApplicationJSON {
+			return sendJSON(c)
+		}
+		return sendYAML(c)
+	}, []RouteOption{WithHidden()})
+	ui := strings.ToLower(config.UI)
+	tmpl, ok := openAPIUITemplates[ui]
+	assets := config.UIAssets
+	if assets.Script == "" {
+		assets = openAPIUIAssets[ui]
+	}
+	if ok && config.UIFiles != nil {
+		bundled, files, err := bundleUIAssets(config.UIFiles, openAPIUIFiles[ui], config.UIPath)
+		if err != nil {
+			log.Error().Err(err).Str("ui", config.UI).Msg("Failed to bundle OpenAPI viewer")
+			return
+		}
+		assets = bundled
+		for name, data := range files {
+			dr.AddRouteWithOptions(fiber.MethodGet, config.UIPath+"/"+name, func(c *fiber.Ctx) error {
+				c.Type(filepath.Ext(name))
+				c.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+				return c.Send(data)
+			}, []RouteOption{WithHidden()})
+		}
+	}
+	if ok {
+		dr.AddRouteWithOptions(fiber.MethodGet, config.UIPath, func(c *fiber.Ctx) error {
+			c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+			title := config.Info.Title
+			if title == "" {
+				title = "API"
+			}
+			return tmpl.Execute(c.Response().BodyWriter(), map[string]any{
+				"Title":   title,
+				"SpecURL": config.Path + ".json",
+				"Assets":  assets,
+			})
+		}, []RouteOption{WithHidden()})
+	}
+	log.Info().Str("path", config.Path).Str("ui", config.UI).Msg("Serving OpenAPI document")
+}
+
+// openAPIUIAssets are the default assets of the viewers, pinned to a
+// release so that the page does not change under a deployed app. Set
+// OpenAPIConfig.UIFiles to serve them from the app with integrity hashes.
+var openAPIUIAssets = map[string]UIAssets{
+	"swagger": {
+		Script:     "https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui-bundle.js",
+		Stylesheet: "https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui.css",
+	},
+	"redoc": {
+		Script: "https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js",
+	},
+}
+
+// openAPIUIFiles name the files of each viewer read from
+// OpenAPIConfig.UIFiles.
+var openAPIUIFiles = map[string]UIAssets{
+	"swagger": {Script: "swagger-ui-bundle.js", Stylesheet: "swagger-ui.css"},
+	"redoc":   {Script: "redoc.standalone.js"},
+}
+
+// bundleUIAssets reads the named viewer files from files and returns the
+// assets serving them below base, with their integrity hashes, and the
+// file contents by name.
+func bundleUIAssets(files fs.FS, names UIAssets, base string) (UIAssets, map[string][]byte, error) {
+	contents := make(map[string][]byte)
+	read := func(name string) (url, integrity string, err error) {
+		if name == "" {
+			return "", "", nil
+		}
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return "", "", err
+		}
+		contents[name] = data
+		sum := sha512.Sum384(data)
+		return base + "/" + name, "sha384-" + base64.StdEncoding.EncodeToString(sum[:]), nil
+	}
+	var assets UIAssets
+	var err error
+	if assets.Script, assets.ScriptIntegrity, err = read(names.Script); err != nil {
+		return UIAssets{}, nil, err
+	}
+	if assets.Stylesheet, assets.StylesheetIntegrity, err = read(names.Stylesheet); err != nil {
+		return UIAssets{}, nil, err
+	}
+	return assets, contents, nil
+}
+
+// openAPIUITemplates render the HTML viewers offered by ServeOpenAPI with
+// the configured assets.
+var openAPIUITemplates = map[string]*template.Template{
+	"swagger": template.Must(template.New("swagger").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+{{with .Assets}}{{if .Stylesheet}}<link rel="stylesheet" href="{{.Stylesheet}}"{{if .StylesheetIntegrity}} integrity="{{.StylesheetIntegrity}}" crossorigin="anonymous"{{end}}>{{end}}{{end}}
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.Assets.Script}}"{{if .Assets.ScriptIntegrity}} integrity="{{.Assets.ScriptIntegrity}}" crossorigin="anonymous"{{end}}></script>
+<script>window.ui = SwaggerUIBundle({url: "{{.SpecURL}}", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`)),
+	"redoc": template.Must(template.New("redoc").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+{{with .Assets}}{{if .Stylesheet}}<link rel="stylesheet" href="{{.Stylesheet}}"{{if .StylesheetIntegrity}} integrity="{{.StylesheetIntegrity}}" crossorigin="anonymous"{{end}}>{{end}}{{end}}
+</head>
+<body>
+<redoc spec-url="{{.SpecURL}}"></redoc>
+<script src="{{.Assets.Script}}"{{if .Assets.ScriptIntegrity}} integrity="{{.Assets.ScriptIntegrity}}" crossorigin="anonymous"{{end}}></script>
+</body>
+</html>
+`)),
+}
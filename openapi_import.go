@@ -0,0 +1,577 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/gofiber/fiber/v2"
+	"github.com/oarkflow/json"
+	"github.com/oarkflow/log"
+	"gopkg.in/yaml.v3"
+)
+
+// HandlerRegistry maps OpenAPI operationIds, or manifest handler keys, to the
+// handlers implementing them.
+type HandlerRegistry map[string]fiber.Handler
+
+// openAPIMethods are the operation keys of an OpenAPI path item.
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// ImportOpenAPI registers every operation of an OpenAPI 3 document, given as
+// JSON or YAML, as a dynamic route. Handlers are bound by operationId from
+// registry. Operations without a handler are served by a mock that returns
+// the documented example, or a fake generated from the response schema.
+// Request and response schemas are compiled and attached to the routes, and
+// requests are validated against theirs with ValidateRequestBySchema.
+func (dr *Router) ImportOpenAPI(spec []byte, registry HandlerRegistry) error {
+	doc, err := decodeOpenAPI(spec)
+	if err != nil {
+		return err
+	}
+	paths, _ := doc["paths"].(map[string]any)
+	if paths == nil {
+		return fmt.Errorf("openapi: document has no paths")
+	}
+	components, _ := doc["components"].(map[string]any)
+	pathKeys := make([]string, 0, len(paths))
+	for p := range paths {
+		pathKeys = append(pathKeys, p)
+	}
+	sort.Strings(pathKeys)
+	type pending struct {
+		method, path string
+		handler      fiber.Handler
+		opts         []RouteOption
+		middlewares  []fiber.Handler
+	}
+	var routes []pending
+	for _, p := range pathKeys {
+		item, _ := paths[p].(map[string]any)
+		if ref, ok := item["$ref"].(string); ok {
+			resolved, _ := resolvePointer(doc, ref)
+			item, _ = resolved.(map[string]any)
+		}
+		if item == nil {
+			continue
+		}
+		routePath := routePattern(p)
+		for _, method := range openAPIMethods {
+			op, ok := item[method].(map[string]any)
+			if !ok {
+				continue
+			}
+			method = strings.ToUpper(method)
+			opts, validate, err := importOperation(doc, components, item, op)
+			if err != nil {
+				return fmt.Errorf("openapi: %s %s: %w", method, p, err)
+			}
+			opID, _ := op["operationId"].(string)
+			handler, bound := registry[opID]
+			if !bound || opID == "" {
+				handler = mockHandler(doc, op)
+			}
+			log.Info().Str("method", method).Str("path", routePath).Str("operationId", opID).Bool("mock", !bound).Msg("Imported OpenAPI operation")
+			r := pending{method: method, path: routePath, handler: handler, opts: opts}
+			if validate {
+				r.middlewares = []fiber.Handler{dr.ValidateRequestBySchema}
+			}
+			routes = append(routes, r)
+		}
+	}
+	for _, r := range routes {
+		dr.AddRouteWithOptions(r.method, r.path, r.handler, r.opts, r.middlewares...)
+	}
+	return nil
+}
+
+// decodeOpenAPI parses a JSON or YAML document into JSON-compatible values.
+func decodeOpenAPI(spec []byte) (map[string]any, error) {
+	var doc map[string]any
+	trimmed := bytes.TrimSpace(spec)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, fmt.Errorf("openapi: parse JSON: %w", err)
+		}
+		return doc, nil
+	}
+	var raw any
+	if err := yaml.Unmarshal(spec, &raw); err != nil {
+		return nil, fmt.Errorf("openapi: parse YAML: %w", err)
+	}
+	data, err := json.Marshal(normalizeYAML(raw))
+	if err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	return doc, nil
+}
+
+// normalizeYAML converts the map[any]any values produced for YAML mappings
+// with non-string keys, such as response codes, into map[string]any.
+func normalizeYAML(v any) any {
+	switch val := v.(type) {
+	case map[any]any:
+		out := make(map[string]any, len(val))
+		for key, item := range val {
+			out[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return out
+	case map[string]any:
+		for key, item := range val {
+			val[key] = normalizeYAML(item)
+		}
+		return val
+	case []any:
+		for i, item := range val {
+			val[i] = normalizeYAML(item)
+		}
+		return val
+	case time.Time:
+		return val.Format(time.RFC3339)
+	default:
+		return v
+	}
+}
+
+// routePattern converts an OpenAPI path template to a route pattern.
+func routePattern(p string) string {
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			segments[i] = ":" + seg[1:len(seg)-1]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// importOperation returns the route options describing an operation and
+// whether it has a request schema to validate.
+func importOperation(doc, components, item, op map[string]any) ([]RouteOption, bool, error) {
+	var opts []RouteOption
+	if s, ok := op["operationId"].(string); ok {
+		opts = append(opts, WithOperationID(s))
+	}
+	if s, ok := op["summary"].(string); ok {
+		opts = append(opts, WithSummary(s))
+	}
+	if s, ok := op["description"].(string); ok {
+		opts = append(opts, WithDescription(s))
+	}
+	if tags, ok := op["tags"].([]any); ok {
+		for _, t := range tags {
+			if s, ok := t.(string); ok {
+				opts = append(opts, WithTags(s))
+			}
+		}
+	}
+	requestDoc, err := requestSchemaDocument(doc, components, item, op)
+	if err != nil {
+		return nil, false, err
+	}
+	if requestDoc != nil {
+		schema, err := compileDocument(requestDoc)
+		if err != nil {
+			return nil, false, fmt.Errorf("request schema: %w", err)
+		}
+		opts = append(opts, WithRequestSchema(schema))
+	}
+	responses, _ := op["responses"].(map[string]any)
+	for code, resp := range responses {
+		status, ok := responseStatus(code)
+		if !ok {
+			continue
+		}
+		schemaDoc, ok := jsonContentSchema(doc, resp)
+		if !ok {
+			continue
+		}
+		schema, err := compileDocument(withComponents(schemaDoc, components))
+		if err != nil {
+			return nil, false, fmt.Errorf("response %s schema: %w", code, err)
+		}
+		opts = append(opts, WithResponseSchema(status, schema))
+	}
+	return opts, requestDoc != nil, nil
+}
+
+// requestSchemaDocument combines the parameters and JSON request body of an
+// operation into a single request schema, declaring each parameter's
+// location with "in". It returns nil when the operation takes no input.
+func requestSchemaDocument(doc, components, item, op map[string]any) (any, error) {
+	props := map[string]any{}
+	var required []any
+	var params []any
+	if list, ok := item["parameters"].([]any); ok {
+		params = append(params, list...)
+	}
+	if list, ok := op["parameters"].([]any); ok {
+		params = append(params, list...)
+	}
+	for _, p := range params {
+		param, ok := resolveRef(doc, p).(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid parameter %v", p)
+		}
+		name, _ := param["name"].(string)
+		in, _ := param["in"].(string)
+		if name == "" || in == "" {
+			return nil, fmt.Errorf("parameter without name or location")
+		}
+		prop := map[string]any{}
+		if s, ok := param["schema"].(map[string]any); ok {
+			for key, val := range s {
+				prop[key] = val
+			}
+		}
+		prop["in"] = in
+		if desc, ok := param["description"].(string); ok {
+			prop["description"] = desc
+		}
+		props[name] = prop
+		if req, _ := param["required"].(bool); req || in == "path" {
+			required = append(required, name)
+		}
+	}
+	root := map[string]any{"type": "object"}
+	if body, ok := resolveRef(doc, op["requestBody"]).(map[string]any); ok {
+		bodySchema, hasSchema := jsonContentSchema(doc, body)
+		if hasSchema {
+			resolved, _ := resolveRef(doc, bodySchema).(map[string]any)
+			if bodyProps, ok := resolved["properties"].(map[string]any); ok {
+				for key, val := range resolved {
+					switch key {
+					case "properties", "required", "type":
+					default:
+						root[key] = val
+					}
+				}
+				for name, val := range bodyProps {
+					if _, isParam := props[name]; !isParam {
+						props[name] = val
+					}
+				}
+				if list, ok := resolved["required"].([]any); ok {
+					required = append(required, list...)
+				}
+			} else {
+				root["allOf"] = []any{bodySchema}
+			}
+		}
+	}
+	if len(props) == 0 && root["allOf"] == nil {
+		return nil, nil
+	}
+	root["properties"] = props
+	if len(required) > 0 {
+		root["required"] = required
+	}
+	return withComponents(root, components), nil
+}
+
+// jsonContentSchema returns the schema of the JSON media type of a request
+// body or response object.
+func jsonContentSchema(doc map[string]any, obj any) (any, bool) {
+	resolved, _ := resolveRef(doc, obj).(map[string]any)
+	media, ok := jsonMediaType(resolved)
+	if !ok {
+		return nil, false
+	}
+	schema, ok := media["schema"]
+	return schema, ok
+}
+
+// jsonMediaType returns the first JSON media type object of a content map.
+func jsonMediaType(obj map[string]any) (map[string]any, bool) {
+	content, _ := obj["content"].(map[string]any)
+	if media, ok := content[fiber.MIMEApplicationJSON].(map[string]any); ok {
+		return media, true
+	}
+	keys := make([]string, 0, len(content))
+	for key := range content {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.Contains(key, "json") {
+			media, ok := content[key].(map[string]any)
+			return media, ok
+		}
+	}
+	return nil, false
+}
+
+// withComponents copies the document components into a schema so that its
+// "#/components/..." references resolve against the schema root.
+func withComponents(schema any, components map[string]any) any {
+	s, ok := schema.(map[string]any)
+	if !ok || components == nil {
+		return schema
+	}
+	out := make(map[string]any, len(s)+1)
+	for key, val := range s {
+		out[key] = val
+	}
+	out["components"] = components
+	return out
+}
+
+// resolveRef follows a "$ref" to a local definition of the document.
+func resolveRef(doc map[string]any, v any) any {
+	for i := 0; i < 32; i++ {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return v
+		}
+		ref, ok := obj["$ref"].(string)
+		if !ok {
+			return v
+		}
+		if v, ok = resolvePointer(doc, ref); !ok {
+			return nil
+		}
+	}
+	return nil
+}
+
+// compileDocument compiles a decoded schema document.
+func compileDocument(doc any) (*Schema, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return CompileSchema(data)
+}
+
+// responseStatus converts a response key to a status code. "default" maps
+// to 0; ranges such as "2XX" are not supported.
+func responseStatus(code string) (int, bool) {
+	if code == "default" {
+		return 0, true
+	}
+	status, err := strconv.Atoi(code)
+	return status, err == nil
+}
+
+// mockHandler answers an operation with its documented success response,
+// using the documented example or a fake generated from its schema.
+func mockHandler(doc, op map[string]any) fiber.Handler {
+	responses, _ := op["responses"].(map[string]any)
+	status, resp := fiber.StatusOK, any(nil)
+	best := 0
+	for code, r := range responses {
+		s, ok := responseStatus(code)
+		if !ok || (s != 0 && (s < 200 || s > 299)) {
+			continue
+		}
+		if resp == nil || (s != 0 && (best == 0 || s < best)) {
+			best, resp = s, r
+		}
+	}
+	if best != 0 {
+		status = best
+	}
+	resolved, _ := resolveRef(doc, resp).(map[string]any)
+	media, hasContent := jsonMediaType(resolved)
+	return func(c *fiber.Ctx) error {
+		c.Set("X-Mock-Response", "true")
+		if !hasContent {
+			return c.SendStatus(status)
+		}
+		if example, ok := mediaExample(doc, media); ok {
+			return c.Status(status).JSON(example)
+		}
+		return c.Status(status).JSON(fakeValue(doc, media["schema"], 0))
+	}
+}
+
+// mediaExample returns the example documented on a media type or its schema.
+func mediaExample(doc, media map[string]any) (any, bool) {
+	if example, ok := media["example"]; ok {
+		return example, true
+	}
+	if examples, ok := media["examples"].(map[string]any); ok {
+		keys := make([]string, 0, len(examples))
+		for key := range examples {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if ex, ok := resolveRef(doc, examples[key]).(map[string]any); ok {
+				if val, ok := ex["value"]; ok {
+					return val, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// maxFakeDepth bounds recursion through self-referencing schemas.
+const maxFakeDepth = 6
+
+// fakeValue generates a value satisfying the common keywords of a schema.
+func fakeValue(doc map[string]any, schema any, depth int) any {
+	s, ok := resolveRef(doc, schema).(map[string]any)
+	if !ok || depth > maxFakeDepth {
+		return nil
+	}
+	if example, ok := s["example"]; ok {
+		return example
+	}
+	if examples, ok := s["examples"].([]any); ok && len(examples) > 0 {
+		return examples[0]
+	}
+	if val, ok := s["const"]; ok {
+		return val
+	}
+	if enum, ok := s["enum"].([]any); ok && len(enum) > 0 {
+		return enum[gofakeit.Number(0, len(enum)-1)]
+	}
+	if val, ok := s["default"]; ok {
+		return val
+	}
+	if all, ok := s["allOf"].([]any); ok {
+		merged := map[string]any{}
+		for _, sub := range all {
+			if obj, ok := fakeValue(doc, sub, depth+1).(map[string]any); ok {
+				for key, val := range obj {
+					merged[key] = val
+				}
+			}
+		}
+		return merged
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if list, ok := s[key].([]any); ok && len(list) > 0 {
+			return fakeValue(doc, list[0], depth+1)
+		}
+	}
+	types := schemaTypes(s["type"])
+	typ := ""
+	for _, t := range types {
+		if t != "null" {
+			typ = t
+			break
+		}
+	}
+	if typ == "" {
+		if _, ok := s["properties"]; ok {
+			typ = "object"
+		} else if _, ok := s["items"]; ok {
+			typ = "array"
+		}
+	}
+	switch typ {
+	case "object":
+		obj := map[string]any{}
+		props, _ := s["properties"].(map[string]any)
+		for name, prop := range props {
+			obj[name] = fakeValue(doc, prop, depth+1)
+		}
+		return obj
+	case "array":
+		minItems, maxItems := 1, 3
+		if n, ok := toNumber(s["minItems"]); ok {
+			minItems = int(n)
+		}
+		if n, ok := toNumber(s["maxItems"]); ok && int(n) < maxItems {
+			maxItems = int(n)
+		}
+		if maxItems < minItems {
+			maxItems = minItems
+		}
+		list := make([]any, gofakeit.Number(minItems, maxItems))
+		for i := range list {
+			list[i] = fakeValue(doc, s["items"], depth+1)
+		}
+		return list
+	case "integer":
+		lo, hi := numberRange(s, 1, 1000, true)
+		return gofakeit.Number(int(lo), int(hi))
+	case "number":
+		lo, hi := numberRange(s, 0, 1000, false)
+		return gofakeit.Float64Range(lo, hi)
+	case "boolean":
+		return gofakeit.Bool()
+	case "string":
+		return fakeString(s)
+	}
+	return nil
+}
+
+// numberRange returns the inclusive bounds declared by a numeric schema.
+// Exclusive bounds move to the next integer for integers and to the next
+// representable float64 for numbers.
+func numberRange(s map[string]any, lo, hi float64, integer bool) (float64, float64) {
+	if n, ok := toNumber(s["minimum"]); ok {
+		lo = n
+	}
+	if n, ok := toNumber(s["exclusiveMinimum"]); ok {
+		lo = math.Nextafter(n, math.Inf(1))
+		if integer {
+			lo = math.Floor(n) + 1
+		}
+	}
+	if n, ok := toNumber(s["maximum"]); ok {
+		hi = n
+	}
+	if n, ok := toNumber(s["exclusiveMaximum"]); ok {
+		hi = math.Nextafter(n, math.Inf(-1))
+		if integer {
+			hi = math.Ceil(n) - 1
+		}
+	}
+	if integer {
+		lo, hi = math.Ceil(lo), math.Floor(hi)
+	}
+	if hi < lo {
+		hi = lo
+	}
+	return lo, hi
+}
+
+// fakeString generates a string honouring format, pattern and length.
+func fakeString(s map[string]any) string {
+	format, _ := s["format"].(string)
+	switch format {
+	case "email":
+		return gofakeit.Email()
+	case "uuid":
+		return gofakeit.UUID()
+	case "date-time":
+		return gofakeit.Date().UTC().Format(time.RFC3339)
+	case "date":
+		return gofakeit.Date().Format(time.DateOnly)
+	case "time":
+		return gofakeit.Date().Format(time.TimeOnly)
+	case "uri", "url":
+		return gofakeit.URL()
+	case "hostname":
+		return gofakeit.DomainName()
+	case "ipv4":
+		return gofakeit.IPv4Address()
+	case "ipv6":
+		return gofakeit.IPv6Address()
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		return gofakeit.Regex(pattern)
+	}
+	str := gofakeit.Word()
+	if n, ok := toNumber(s["minLength"]); ok {
+		for len([]rune(str)) < int(n) {
+			str += " " + gofakeit.Word()
+		}
+	}
+	if n, ok := toNumber(s["maxLength"]); ok && len([]rune(str)) > int(n) {
+		str = string([]rune(str)[:int(n)])
+	}
+	return str
+}
@@ -0,0 +1,132 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestNumberRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  map[string]any
+		integer bool
+		lo, hi  float64
+	}{
+		{"defaults", map[string]any{}, false, 0, 1000},
+		{"inclusive", map[string]any{"minimum": 0.5, "maximum": 1.5}, false, 0.5, 1.5},
+		{"exclusive number", map[string]any{"exclusiveMinimum": 0.5, "exclusiveMaximum": 0.75}, false,
+			math.Nextafter(0.5, 1), math.Nextafter(0.75, 0)},
+		{"exclusive integer", map[string]any{"exclusiveMinimum": 3, "exclusiveMaximum": 6}, true, 4, 5},
+		{"exclusive fractional integer", map[string]any{"exclusiveMinimum": 3.5, "exclusiveMaximum": 5.5}, true, 4, 5},
+		{"fractional integer", map[string]any{"minimum": 1.2, "maximum": 3.8}, true, 2, 3},
+	}
+	for _, tt := range tests {
+		lo, hi := numberRange(tt.schema, 0, 1000, tt.integer)
+		if lo != tt.lo || hi != tt.hi {
+			t.Errorf("%s: range = [%v, %v], want [%v, %v]", tt.name, lo, hi, tt.lo, tt.hi)
+		}
+	}
+}
+
+const importSpec = `
+openapi: 3.0.3
+info: {title: Pets, version: "1"}
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      summary: List pets
+      tags: [pets]
+      parameters:
+        - {name: limit, in: query, required: true, schema: {type: integer, minimum: 1}}
+      responses:
+        "200": {description: ok}
+    post:
+      operationId: createPet
+      requestBody:
+        content:
+          application/json:
+            schema: {$ref: "#/components/schemas/Pet"}
+      responses:
+        "201":
+          description: created
+          content:
+            application/json:
+              example: {name: Rex}
+  /pets/{id}:
+    get:
+      operationId: getPet
+      parameters:
+        - {name: id, in: path, schema: {type: integer}}
+      responses:
+        "200": {description: ok}
+components:
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        name: {type: string}
+`
+
+func TestImportOpenAPI(t *testing.T) {
+	app := fiber.New()
+	dr := New(app)
+	err := dr.ImportOpenAPI([]byte(importSpec), HandlerRegistry{
+		"listPets": func(c *fiber.Ctx) error {
+			limit, _ := ParamsFromCtx(c).Get("limit")
+			return c.SendString(fmt.Sprint("limit ", limit))
+		},
+		"getPet": text("pet"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	route, ok, _ := dr.MatchRoute(fiber.MethodGet, "/pets")
+	if !ok || route.Summary != "List pets" || !slices.Equal(route.Tags, []string{"pets"}) || route.RequestSchema == nil {
+		t.Fatalf("GET /pets not imported with its documentation: %+v", route)
+	}
+	for _, tc := range []struct {
+		method, path, body string
+		status             int
+		want               string
+	}{
+		{fiber.MethodGet, "/pets?limit=5", "", fiber.StatusOK, "limit 5"},
+		{fiber.MethodGet, "/pets?limit=abc", "", fiber.StatusUnprocessableEntity, ""},
+		{fiber.MethodGet, "/pets", "", fiber.StatusUnprocessableEntity, ""},
+		{fiber.MethodGet, "/pets/7", "", fiber.StatusOK, "pet"},
+		{fiber.MethodGet, "/pets/x", "", fiber.StatusUnprocessableEntity, ""},
+		{fiber.MethodPost, "/pets", `{"name": "Rex"}`, fiber.StatusCreated, `{"name":"Rex"}`},
+		{fiber.MethodPost, "/pets", `{"name": 1}`, fiber.StatusUnprocessableEntity, ""},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != tc.status || tc.want != "" && string(body) != tc.want {
+			t.Errorf("%s %s = %d %s, want %d %s", tc.method, tc.path, resp.StatusCode, body, tc.status, tc.want)
+		}
+	}
+}
+
+func TestImportOpenAPIRejectsInvalidDocuments(t *testing.T) {
+	dr := New(fiber.New())
+	for _, spec := range []string{`{"openapi": "3.0.3"}`, "paths: [", `{"paths": {"/a": {"get": {"parameters": [{"in": "query"}]}}}}`} {
+		if err := dr.ImportOpenAPI([]byte(spec), nil); err == nil {
+			t.Errorf("ImportOpenAPI(%s) succeeded", spec)
+		}
+	}
+	if routes := dr.table().routeMap(); len(routes) != 0 {
+		t.Errorf("routes added from invalid documents: %v", routes)
+	}
+}
@@ -0,0 +1,106 @@
+package router
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requireHeader returns a middleware rejecting requests without header.
+func requireHeader(header string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Get(header) == "" {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		return c.Next()
+	}
+}
+
+func TestSecurityHandles(t *testing.T) {
+	app := fiber.New()
+	dr := New(app)
+	bearer := dr.RegisterSecurity("bearer", SecurityScheme{Type: "http", Scheme: "bearer"}, requireHeader("Authorization"))
+	apiKey := dr.RegisterSecurity("apiKey", SecurityScheme{Type: "apiKey", In: "header", Name: "X-API-Key"}, requireHeader("X-API-Key"))
+	dr.AddRouteWithOptions(fiber.MethodGet, "/users", text("users"), []RouteOption{WithSecurity(bearer)})
+	dr.AddRouteWithOptions(fiber.MethodGet, "/both", text("both"), []RouteOption{WithSecurity(bearer, apiKey)})
+	admin := dr.Group("/admin")
+	admin.Use(apiKey)
+	admin.Get("/stats", text("stats"))
+	dr.AddRoute(fiber.MethodGet, "/open", text("open"), requireHeader("Authorization"))
+	for _, path := range []string{"/users", "/admin/stats"} {
+		if status, _ := get(t, app, path); status != fiber.StatusUnauthorized {
+			t.Errorf("GET %s without credentials = %d", path, status)
+		}
+	}
+
+	security := func(path string) string {
+		paths := dr.OpenAPI(OpenAPIInfo{})["paths"].(map[string]any)
+		return fmt.Sprint(paths[path].(map[string]any)["get"].(map[string]any)["security"])
+	}
+	for path, want := range map[string]string{
+		"/users":       "[map[bearer:[]]]",
+		"/both":        "[map[apiKey:[] bearer:[]]]",
+		"/admin/stats": "[map[apiKey:[]]]",
+		"/open":        "<nil>",
+	} {
+		if got := security(path); got != want {
+			t.Errorf("%s security = %s, want %s", path, got, want)
+		}
+	}
+	// Global security is required together with the route's.
+	dr.UseSecurity(bearer)
+	if got, want := security("/admin/stats"), "[map[apiKey:[] bearer:[]]]"; got != want {
+		t.Errorf("/admin/stats security = %s, want %s", got, want)
+	}
+}
+
+func TestOpenAPIUIAssets(t *testing.T) {
+	app := fiber.New()
+	dr := New(app)
+	dr.ServeOpenAPI(OpenAPIConfig{UI: "redoc"})
+	dr.ServeOpenAPI(OpenAPIConfig{UI: "swagger", UIPath: "/swagger", UIAssets: UIAssets{
+		Script:          "/assets/swagger-ui-bundle.js",
+		ScriptIntegrity: "sha384-abc",
+		Stylesheet:      "/assets/swagger-ui.css",
+	}})
+	_, body := get(t, app, "/docs")
+	if !strings.Contains(body, `src="https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js"`) {
+		t.Errorf("redoc page does not load the pinned release:\n%s", body)
+	}
+	_, body = get(t, app, "/swagger")
+	for _, want := range []string{
+		`<script src="/assets/swagger-ui-bundle.js" integrity="sha384-abc" crossorigin="anonymous">`,
+		`<link rel="stylesheet" href="/assets/swagger-ui.css">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("swagger page lacks %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestOpenAPIUIFiles(t *testing.T) {
+	app := fiber.New()
+	dr := New(app)
+	dr.ServeOpenAPI(OpenAPIConfig{UI: "swagger", UIFiles: fstest.MapFS{
+		"swagger-ui-bundle.js": {Data: []byte("bundle")},
+		"swagger-ui.css":       {Data: []byte("style")},
+	}})
+	_, body := get(t, app, "/docs")
+	sum := sha512.Sum384([]byte("bundle"))
+	want := `<script src="/docs/swagger-ui-bundle.js" integrity="sha384-` + base64.StdEncoding.EncodeToString(sum[:]) + `" crossorigin="anonymous">`
+	if !strings.Contains(html.UnescapeString(body), want) || strings.Contains(body, "unpkg.com") {
+		t.Errorf("viewer page does not load the bundled files:\n%s", body)
+	}
+	if status, body := get(t, app, "/docs/swagger-ui.css"); status != fiber.StatusOK || body != "style" {
+		t.Errorf("GET /docs/swagger-ui.css = %d %q", status, body)
+	}
+	if status, _ := get(t, app, "/docs/other.js"); status != fiber.StatusNotFound {
+		t.Errorf("GET /docs/other.js = %d", status)
+	}
+}
@@ -0,0 +1,290 @@
+package router
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestParams holds the path, query, header and cookie parameters declared
+// by a route schema, validated and coerced to their declared types.
+type RequestParams struct {
+	values    map[string]any
+	locations map[string]string
+}
+
+var emptyParams = &RequestParams{}
+
+// ParamsFromCtx returns the parameters extracted by ValidateRequestBySchema.
+// It never returns nil; lookups on a request without a schema find nothing.
+func ParamsFromCtx(c *fiber.Ctx) *RequestParams {
+	if params, ok := c.Locals("request_params").(*RequestParams); ok {
+		return params
+	}
+	return emptyParams
+}
+
+// Get returns the coerced value of the named parameter.
+func (p *RequestParams) Get(name string) (any, bool) {
+	val, ok := p.values[name]
+	return val, ok
+}
+
+// Location returns where the named parameter was declared to come from.
+func (p *RequestParams) Location(name string) string {
+	return p.locations[name]
+}
+
+// In returns all parameters declared for the given location.
+func (p *RequestParams) In(location string) map[string]any {
+	out := make(map[string]any)
+	for name, loc := range p.locations {
+		if loc != location {
+			continue
+		}
+		if val, ok := p.values[name]; ok {
+			out[name] = val
+		}
+	}
+	return out
+}
+
+// String returns the named parameter as a string.
+func (p *RequestParams) String(name string) (string, bool) {
+	val, ok := p.values[name]
+	if !ok {
+		return "", false
+	}
+	if s, ok := val.(string); ok {
+		return s, true
+	}
+	return formatMessageValue(val), true
+}
+
+// Int returns the named parameter as an integer.
+func (p *RequestParams) Int(name string) (int64, bool) {
+	switch val := p.values[name].(type) {
+	case int64:
+		return val, true
+	case string:
+		i, err := strconv.ParseInt(val, 10, 64)
+		return i, err == nil
+	default:
+		if n, ok := toNumber(val); ok && n == float64(int64(n)) {
+			return int64(n), true
+		}
+	}
+	return 0, false
+}
+
+// Float returns the named parameter as a floating point number.
+func (p *RequestParams) Float(name string) (float64, bool) {
+	switch val := p.values[name].(type) {
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	default:
+		return toNumber(val)
+	}
+}
+
+// Bool returns the named parameter as a boolean.
+func (p *RequestParams) Bool(name string) (bool, bool) {
+	switch val := p.values[name].(type) {
+	case bool:
+		return val, true
+	case string:
+		b, err := strconv.ParseBool(val)
+		return b, err == nil
+	}
+	return false, false
+}
+
+// Strings returns the named parameter as a list of strings. Scalar values
+// are returned as a single-element list.
+func (p *RequestParams) Strings(name string) ([]string, bool) {
+	val, ok := p.values[name]
+	if !ok {
+		return nil, false
+	}
+	if items, ok := val.([]any); ok {
+		out := make([]string, len(items))
+		for i, item := range items {
+			out[i] = formatMessageValue(item)
+		}
+		return out, true
+	}
+	s, _ := p.String(name)
+	return []string{s}, true
+}
+
+// collect refreshes parameter values from data after defaults are applied.
+func (p *RequestParams) collect(data map[string]any) {
+	for name := range p.locations {
+		if val, ok := data[name]; ok {
+			p.values[name] = val
+		}
+	}
+}
+
+// declared reports whether the schema declares any parameters outside the
+// body, so that bodyless requests still have them validated.
+func (p *RequestParams) declared() bool {
+	return len(p.locations) > 0
+}
+
+// without returns a copy of the body data without the parameters merged in
+// for validation.
+func (p *RequestParams) without(data any) any {
+	obj, ok := data.(map[string]any)
+	if !ok || len(p.locations) == 0 {
+		return data
+	}
+	body := make(map[string]any, len(obj))
+	for key, val := range obj {
+		if _, isParam := p.locations[key]; !isParam {
+			body[key] = val
+		}
+	}
+	return body
+}
+
+// requiresBody reports whether the schema requires properties that are not
+// parameters, so that a request without a body is invalid.
+func requiresBody(doc any, params *RequestParams) bool {
+	schema, _ := doc.(map[string]any)
+	required, _ := schema["required"].([]any)
+	for _, r := range required {
+		name, _ := r.(string)
+		if _, isParam := params.locations[name]; !isParam {
+			return true
+		}
+	}
+	return false
+}
+
+// extractParameters reads every top-level property declared with an "in"
+// location other than body from the request and coerces it to its type.
+func extractParameters(c *fiber.Ctx, doc any) *RequestParams {
+	params := &RequestParams{
+		values:    make(map[string]any),
+		locations: make(map[string]string),
+	}
+	schema, _ := doc.(map[string]any)
+	props, _ := schema["properties"].(map[string]any)
+	for key, propSchema := range props {
+		ps, ok := propSchema.(map[string]any)
+		if !ok {
+			continue
+		}
+		in, _ := ps["in"].(string)
+		location := normalizeLocation(in)
+		if in == "" || location == LocationBody {
+			continue
+		}
+		params.locations[key] = location
+		field := key
+		if f, ok := ps["field"].(string); ok && f != "" {
+			field = f
+		}
+		types := schemaTypes(ps["type"])
+		if len(types) == 1 && types[0] == "array" {
+			raws, ok := parameterValues(c, location, field)
+			if !ok {
+				continue
+			}
+			items, _ := ps["items"].(map[string]any)
+			itemTypes := schemaTypes(items["type"])
+			list := make([]any, len(raws))
+			for i, raw := range raws {
+				list[i] = coerceParameter(raw, itemTypes)
+			}
+			params.values[key] = list
+			continue
+		}
+		if raw, ok := parameterValue(c, location, field); ok {
+			params.values[key] = coerceParameter(raw, types)
+		}
+	}
+	return params
+}
+
+// parameterValue reads a raw parameter from the given request location.
+func parameterValue(c *fiber.Ctx, in, field string) (string, bool) {
+	switch in {
+	case LocationQuery:
+		if c.Context().QueryArgs().Has(field) {
+			return c.Query(field), true
+		}
+	case LocationPath:
+		if params, ok := c.Locals("params").(map[string]string); ok {
+			val, exists := params[field]
+			return val, exists
+		}
+	case LocationHeader:
+		if val := c.Get(field); val != "" {
+			return val, true
+		}
+	case LocationCookie:
+		if val := c.Cookies(field); val != "" {
+			return val, true
+		}
+	}
+	return "", false
+}
+
+// parameterValues reads a list parameter. Repeated query keys are collected
+// and each value is split on commas.
+func parameterValues(c *fiber.Ctx, in, field string) ([]string, bool) {
+	var raws []string
+	if in == LocationQuery {
+		for _, v := range c.Context().QueryArgs().PeekMulti(field) {
+			raws = append(raws, string(v))
+		}
+	} else if raw, ok := parameterValue(c, in, field); ok {
+		raws = append(raws, raw)
+	}
+	if len(raws) == 0 {
+		return nil, false
+	}
+	parts := []string{}
+	for _, raw := range raws {
+		if raw == "" {
+			continue
+		}
+		for _, part := range strings.Split(raw, ",") {
+			parts = append(parts, strings.TrimSpace(part))
+		}
+	}
+	return parts, true
+}
+
+// coerceParameter converts a raw string parameter to the first declared
+// type it parses as. Unparseable values are returned unchanged so the
+// validator reports the type mismatch.
+func coerceParameter(raw string, types []string) any {
+	for _, t := range types {
+		switch t {
+		case "integer":
+			if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				return i
+			}
+		case "number":
+			if f, err := strconv.ParseFloat(raw, 64); err == nil {
+				return f
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(raw); err == nil {
+				return b
+			}
+		case "null":
+			if raw == "" || raw == "null" {
+				return nil
+			}
+		case "string":
+			return raw
+		}
+	}
+	return raw
+}
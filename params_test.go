@@ -0,0 +1,62 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBodylessRequestValidation(t *testing.T) {
+	app := fiber.New()
+	dr := New(app)
+	body, err := CompileSchema([]byte(`{"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := CompileSchema([]byte(`{"type": "object", "required": ["limit"], "properties": {"limit": {"type": "integer", "in": "query"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr.AddRouteWithOptions(fiber.MethodGet, "/body", text("ok"), []RouteOption{WithRequestSchema(body)}, dr.ValidateRequestBySchema)
+	dr.AddRouteWithOptions(fiber.MethodGet, "/query", text("ok"), []RouteOption{WithRequestSchema(query)}, dr.ValidateRequestBySchema)
+	for _, tc := range []struct {
+		path   string
+		status int
+	}{
+		{"/body", fiber.StatusUnprocessableEntity},
+		{"/query", fiber.StatusUnprocessableEntity},
+		{"/query?limit=x", fiber.StatusUnprocessableEntity},
+		{"/query?limit=10", fiber.StatusOK},
+	} {
+		if status, body := get(t, app, tc.path); status != tc.status {
+			t.Errorf("GET %s = %d %s, want %d", tc.path, status, body, tc.status)
+		}
+	}
+}
+
+func TestParametersStayOutOfBody(t *testing.T) {
+	app := fiber.New()
+	dr := New(app)
+	schema, err := CompileSchema([]byte(`{"type": "object", "required": ["name", "limit"], "properties": {"name": {"type": "string"}, "limit": {"type": "integer", "in": "query"}, "tag": {"type": "string", "default": "none"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr.AddRouteWithOptions(fiber.MethodPost, "/items", func(c *fiber.Ctx) error {
+		limit, _ := ParamsFromCtx(c).Get("limit")
+		return c.SendString(fmt.Sprintf("%s %v", c.Body(), limit))
+	}, []RouteOption{WithRequestSchema(schema)}, dr.ValidateRequestBySchema)
+	req := httptest.NewRequest(fiber.MethodPost, "/items?limit=10", strings.NewReader(`{"name":"a"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	if want := `{"name":"a","tag":"none"} 10`; string(got) != want {
+		t.Errorf("POST /items = %d %s, want %s", resp.StatusCode, got, want)
+	}
+}
@@ -0,0 +1,109 @@
+package router
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/oarkflow/log"
+)
+
+// precompressedEncodings lists the content codings a static route can serve
+// from sibling files, in server preference order.
+var precompressedEncodings = []struct {
+	coding string
+	ext    string
+}{
+	{coding: "br", ext: ".br"},
+	{coding: "zstd", ext: ".zst"},
+	{coding: "gzip", ext: ".gz"},
+}
+
+// parseAcceptEncoding returns the q-value for each coding in an
+// Accept-Encoding header. Codings with q=0 are kept so they can be refused.
+func parseAcceptEncoding(header string) map[string]float64 {
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		coding, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(key, "q") {
+				if f, err := strconv.ParseFloat(val, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(coding))] = q
+	}
+	return accepted
+}
+
+// readStaticFile returns the contents of file, using the static cache.
+func (dr *Router) readStaticFile(file string) ([]byte, error) {
+	dr.staticCacheLock.RLock()
+	entry, found := dr.staticCache[file]
+	dr.staticCacheLock.RUnlock()
+	if found && time.Since(entry.timestamp) < staticCacheTTL {
+		log.Info().Str("file", file).Msg("Static cache hit")
+		return entry.data, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	dr.staticCacheLock.Lock()
+	dr.staticCache[file] = staticCacheEntry{data: data, timestamp: time.Now()}
+	dr.staticCacheLock.Unlock()
+	return data, nil
+}
+
+// servePrecompressed sends the best precompressed sibling of filePath the
+// client accepts. It reports false when no acceptable sibling exists.
+func (dr *Router) servePrecompressed(c *fiber.Ctx, filePath string) (bool, error) {
+	accepted := parseAcceptEncoding(c.Get(fiber.HeaderAcceptEncoding))
+	type candidate struct {
+		coding string
+		file   string
+		q      float64
+		rank   int
+	}
+	var candidates []candidate
+	for rank, enc := range precompressedEncodings {
+		q, ok := accepted[enc.coding]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if !ok || q <= 0 {
+			continue
+		}
+		sibling := filePath + enc.ext
+		if info, err := os.Stat(sibling); err != nil || info.IsDir() {
+			continue
+		}
+		candidates = append(candidates, candidate{coding: enc.coding, file: sibling, q: q, rank: rank})
+	}
+	if len(candidates) == 0 {
+		return false, nil
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].q != candidates[j].q {
+			return candidates[i].q > candidates[j].q
+		}
+		return candidates[i].rank < candidates[j].rank
+	})
+	best := candidates[0]
+	data, err := dr.readStaticFile(best.file)
+	if err != nil {
+		return false, err
+	}
+	c.Response().Header.Set(fiber.HeaderContentEncoding, best.coding)
+	return true, c.Send(data)
+}
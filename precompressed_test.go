@@ -0,0 +1,75 @@
+package router
+
+import (
+	"io"
+	"mime"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPrecompressed(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"app.js":        "plain js",
+		"app.js.br":     "br js",
+		"app.js.zst":    "zstd js",
+		"app.js.gz":     "gzip js",
+		"style.css":     "plain css",
+		"style.css.gz":  "gzip css",
+		"notes.txt":     "plain notes",
+		"notes.txt.br/": "",
+	} {
+		file := filepath.Join(dir, name)
+		if strings.HasSuffix(name, "/") {
+			// A directory named like a sibling is not served.
+			if err := os.Mkdir(file, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := fiber.New()
+	dr := New(app)
+	dr.Static("/assets", dir, StaticConfig{Precompressed: true})
+	for _, tc := range []struct {
+		file, accept string
+		encoding     string
+		body         string
+	}{
+		{"app.js", "gzip, br, zstd", "br", "br js"},
+		{"app.js", "gzip;q=1, br;q=0.5", "gzip", "gzip js"},
+		{"app.js", "zstd, gzip;q=0.8", "zstd", "zstd js"},
+		{"app.js", "*", "br", "br js"},
+		{"app.js", "*;q=0.5, gzip", "gzip", "gzip js"},
+		{"app.js", "br;q=0, *", "zstd", "zstd js"},
+		{"app.js", "identity", "", "plain js"},
+		{"style.css", "br, gzip;q=0.5", "gzip", "gzip css"},
+		{"style.css", "zstd", "", "plain css"},
+		{"notes.txt", "deflate", "", "plain notes"},
+	} {
+		req := httptest.NewRequest(fiber.MethodGet, "/assets/"+tc.file, nil)
+		req.Header.Set(fiber.HeaderAcceptEncoding, tc.accept)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if got := resp.Header.Get(fiber.HeaderContentEncoding); got != tc.encoding || string(body) != tc.body {
+			t.Errorf("%s with %q = %q %q, want %q %q", tc.file, tc.accept, got, body, tc.encoding, tc.body)
+		}
+		if got, want := resp.Header.Get(fiber.HeaderContentType), mime.TypeByExtension(filepath.Ext(tc.file)); got != want {
+			t.Errorf("%s with %q: Content-Type = %q, want %q", tc.file, tc.accept, got, want)
+		}
+		if vary := resp.Header.Get(fiber.HeaderVary); !strings.Contains(vary, fiber.HeaderAcceptEncoding) {
+			t.Errorf("%s with %q: Vary = %q, want Accept-Encoding", tc.file, tc.accept, vary)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/oarkflow/log"
+
+	"github.com/oarkflow/router/watcher"
+)
+
+// WithRenderer sets the views used by Render for the route.
+func WithRenderer(renderer fiber.Views) RouteOption {
+	return func(r *Route) {
+		r.Renderer = renderer
+	}
+}
+
+// WithLayout sets the layout used by Render for the route.
+func WithLayout(layout string) RouteOption {
+	return func(r *Route) {
+		r.Layout = layout
+	}
+}
+
+// withGroup records the group a route was added through, so that Render
+// can fall back to the group's renderer.
+func withGroup(g *Group) RouteOption {
+	return func(r *Route) {
+		r.group = g
+	}
+}
+
+// SetLayout sets the layout used by Render for a dynamic route.
+func (dr *Router) SetLayout(method, path, layout string) {
+	if !dr.updateRoute(method, path, func(route *Route) {
+		route.Layout = layout
+	}) {
+		log.Warn().Str("method", method).Str("path", path).Msg("Route not found for setting layout")
+		return
+	}
+	log.Info().Str("method", method).Str("path", path).Str("layout", layout).Msg("Set layout for route")
+}
+
+// SetRenderer sets the renderer and, optionally, the layout used by Render
+// for the group's routes that have no renderer of their own.
+func (g *Group) SetRenderer(renderer fiber.Views, layout ...string) {
+	g.renderMu.Lock()
+	defer g.renderMu.Unlock()
+	g.renderer = renderer
+	if len(layout) > 0 {
+		g.layout = layout[0]
+	}
+}
+
+// rendering returns the group's renderer and layout.
+func (g *Group) rendering() (fiber.Views, string) {
+	g.renderMu.RLock()
+	defer g.renderMu.RUnlock()
+	return g.renderer, g.layout
+}
+
+// Render renders a template with the renderer of the matched route, falling
+// back to its group's renderer and then to the app's Views. Without explicit
+// layouts the route's layout is used, then the group's, then the app's
+// ViewsLayout. The template is rendered into a buffer, so a failing template
+// leaves the response untouched. c.Render does the same when the app's
+// Views are wrapped with RouteViews; otherwise it ignores route renderers
+// and layouts, which the router logs as an error.
+func Render(c *fiber.Ctx, name string, bind any, layouts ...string) error {
+	renderer, layout := renderTarget(c)
+	if renderer == nil {
+		return c.Render(name, bind, layouts...)
+	}
+	if len(layouts) == 0 && layout != "" {
+		layouts = []string{layout}
+	}
+	var buf bytes.Buffer
+	if err := renderer.Render(&buf, name, bind, layouts...); err != nil {
+		return fmt.Errorf("failed to render: %w", err)
+	}
+	c.Type("html")
+	return c.Send(buf.Bytes())
+}
+
+// renderTarget resolves the renderer and layout for the matched route.
+func renderTarget(c *fiber.Ctx) (fiber.Views, string) {
+	cfg := c.App().Config()
+	renderer, layout := cfg.Views, cfg.ViewsLayout
+	if rendering, ok := c.Locals(renderingKey{}).(*routeRendering); ok {
+		if rendering.renderer != nil {
+			renderer = rendering.renderer
+		}
+		if rendering.layout != "" {
+			layout = rendering.layout
+		}
+	}
+	return renderer, layout
+}
+
+// rendering returns the renderer and layout of the route, falling back to
+// those of its groups. Either is empty when neither sets it.
+func (dr *Route) rendering() (fiber.Views, string) {
+	renderer, layout := dr.Renderer, dr.Layout
+	for g := dr.group; g != nil && (renderer == nil || layout == ""); g = g.parent {
+		r, l := g.rendering()
+		if renderer == nil {
+			renderer = r
+		}
+		if layout == "" {
+			layout = l
+		}
+	}
+	return renderer, layout
+}
+
+// renderingKey is the c.Locals key of the rendering of the matched route.
+// It is not a string, so PassLocalsToViews never hands it to templates.
+type renderingKey struct{}
+
+// routeViewsKey binds the rendering of the matched route to the views of
+// c.Render, see RouteViews. It is only bound when the app's views are
+// RouteViews, which remove it before rendering.
+const routeViewsKey = "router.rendering"
+
+// routeRendering is the renderer and layout of the matched route.
+type routeRendering struct {
+	renderer fiber.Views
+	layout   string
+	// appLayout is the app's ViewsLayout, which c.Render passes when called
+	// without layouts.
+	appLayout string
+}
+
+// bindRendering stores the route's renderer and layout in the request's
+// locals for Render and, when the app's views are RouteViews, binds them
+// for c.Render. Otherwise c.Render cannot honor them, which is logged once
+// per router.
+func (dr *Route) bindRendering(c *fiber.Ctx) {
+	renderer, layout := dr.rendering()
+	if renderer == nil && layout == "" {
+		return
+	}
+	cfg := c.App().Config()
+	rendering := &routeRendering{renderer: renderer, layout: layout, appLayout: cfg.ViewsLayout}
+	c.Locals(renderingKey{}, rendering)
+	if _, wrapped := cfg.Views.(*routeViews); !wrapped {
+		dr.router.unwrappedViews.Do(func() {
+			log.Error().Str("method", dr.Method).Str("path", dr.Path).Msg("Route renderer is ignored by c.Render: wrap the app's Views with RouteViews or use router.Render")
+		})
+		return
+	}
+	if err := c.Bind(fiber.Map{routeViewsKey: rendering}); err != nil {
+		log.Error().Err(err).Str("path", dr.Path).Msg("Failed to bind route renderer")
+	}
+}
+
+// routeViews are the views returned by RouteViews.
+type routeViews struct {
+	views fiber.Views
+}
+
+// RouteViews wraps the app's views so that c.Render uses the renderer and
+// layout of the matched route, falling back to its group's and then to
+// views, as Render does:
+//
+//	app := fiber.New(fiber.Config{Views: router.RouteViews(engine)})
+//
+// The route reaches the views through the bind map, so c.Render only honors
+// it when bind is nil or a fiber.Map; other binds are rendered with views.
+func RouteViews(views fiber.Views) fiber.Views {
+	return &routeViews{views: views}
+}
+
+// Load implements fiber.Views.
+func (v *routeViews) Load() error {
+	return v.views.Load()
+}
+
+// Render implements fiber.Views.
+func (v *routeViews) Render(w io.Writer, name string, bind any, layouts ...string) error {
+	views := v.views
+	if m, ok := bind.(fiber.Map); ok {
+		if rendering, ok := m[routeViewsKey].(*routeRendering); ok {
+			delete(m, routeViewsKey)
+			if rendering.renderer != nil {
+				views = rendering.renderer
+			}
+			implicit := len(layouts) == 0 || len(layouts) == 1 && layouts[0] == rendering.appLayout
+			if implicit && rendering.layout != "" {
+				layouts = []string{rendering.layout}
+			}
+		}
+	}
+	return views.Render(w, name, bind, layouts...)
+}
+
+// TemplateHandler returns a handler rendering the named template with data
+// through Render, so a route can be bound to a template without custom code.
+// Use TemplateConfig for more control.
+func TemplateHandler(name string, data map[string]any) fiber.Handler {
+	return TemplateConfig{Template: name, Data: data}.Handler()
+}
+
+// ReloadableViews wraps views built by a constructor so that they can be
+// rebuilt while serving, e.g. when their templates change on disk.
+type ReloadableViews struct {
+	mu    sync.RWMutex
+	build func() fiber.Views
+	views fiber.Views
+	// watcher is the watcher started by Watch, if any.
+	watcher *watcher.Watcher
+}
+
+// NewReloadableViews creates views from build, which is called again on
+// every reload.
+func NewReloadableViews(build func() fiber.Views) *ReloadableViews {
+	return &ReloadableViews{build: build, views: build()}
+}
+
+// Load rebuilds and loads the views. The previous views stay in use if
+// loading fails.
+func (v *ReloadableViews) Load() error {
+	views := v.build()
+	if err := views.Load(); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	v.views = views
+	v.mu.Unlock()
+	return nil
+}
+
+// Render implements fiber.Views.
+func (v *ReloadableViews) Render(w io.Writer, name string, bind any, layouts ...string) error {
+	v.mu.RLock()
+	views := v.views
+	v.mu.RUnlock()
+	return views.Render(w, name, bind, layouts...)
+}
+
+// templateReloadDelay groups bursts of file events into a single reload.
+const templateReloadDelay = 100 * time.Millisecond
+
+// Watch reloads the views whenever a file below root changes, replacing
+// the watcher of a previous call. Call the returned function, or Close, to
+// stop watching.
+func (v *ReloadableViews) Watch(root string) (func() error, error) {
+	w, err := watcher.New(watcher.Config{Roots: []string{root}, Debounce: templateReloadDelay}, func([]watcher.Event) {
+		if err := v.Load(); err != nil {
+			log.Error().Err(err).Str("root", root).Msg("Template reload failed")
+			return
+		}
+		log.Info().Str("root", root).Msg("Reloaded templates")
+	})
+	if err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	previous := v.watcher
+	v.watcher = w
+	v.mu.Unlock()
+	if previous != nil {
+		if err := previous.Close(); err != nil {
+			log.Error().Err(err).Msg("Failed to stop template watcher")
+		}
+	}
+	return func() error { return v.stop(w) }, nil
+}
+
+// Close stops watching the templates. The views stay usable.
+func (v *ReloadableViews) Close() error {
+	v.mu.RLock()
+	w := v.watcher
+	v.mu.RUnlock()
+	if w == nil {
+		return nil
+	}
+	return v.stop(w)
+}
+
+// stop closes w if it is still the views' watcher.
+func (v *ReloadableViews) stop(w *watcher.Watcher) error {
+	v.mu.Lock()
+	if v.watcher != w {
+		v.mu.Unlock()
+		return nil
+	}
+	v.watcher = nil
+	v.mu.Unlock()
+	return w.Close()
+}
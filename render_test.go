@@ -0,0 +1,138 @@
+package router
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// testViews render "name:template:layouts" and fail on the "broken" template
+// after writing part of it.
+type testViews string
+
+func (v testViews) Load() error { return nil }
+
+func (v testViews) Render(w io.Writer, name string, _ any, layouts ...string) error {
+	if name == "broken" {
+		io.WriteString(w, "partial")
+		return errors.New("template failed")
+	}
+	_, err := io.WriteString(w, string(v)+":"+name+":"+strings.Join(layouts, ","))
+	return err
+}
+
+func TestRouteViews(t *testing.T) {
+	app := fiber.New(fiber.Config{Views: RouteViews(testViews("app")), ViewsLayout: "base"})
+	dr := New(app)
+	render := func(c *fiber.Ctx) error { return c.Render("index", nil) }
+	dr.AddRoute(fiber.MethodGet, "/plain", render)
+	dr.AddRouteWithOptions(fiber.MethodGet, "/route", render, []RouteOption{WithRenderer(testViews("route")), WithLayout("page")})
+	g := dr.Group("/group")
+	g.SetRenderer(testViews("group"), "section")
+	g.Get("/page", render)
+	g.Get("/explicit", func(c *fiber.Ctx) error { return c.Render("index", fiber.Map{}, "other") })
+	for path, want := range map[string]string{
+		"/plain":          "app:index:base",
+		"/route":          "route:index:page",
+		"/group/page":     "group:index:section",
+		"/group/explicit": "group:index:other",
+	} {
+		if status, body := get(t, app, path); status != fiber.StatusOK || body != want {
+			t.Errorf("GET %s = %d %q, want %q", path, status, body, want)
+		}
+	}
+}
+
+// bindViews render the keys of the bind map.
+type bindViews struct{}
+
+func (bindViews) Load() error { return nil }
+
+func (bindViews) Render(w io.Writer, _ string, bind any, _ ...string) error {
+	var keys []string
+	for key := range bind.(fiber.Map) {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	_, err := io.WriteString(w, strings.Join(keys, ","))
+	return err
+}
+
+func TestRouteRenderingStaysOutOfBind(t *testing.T) {
+	for _, views := range []fiber.Views{bindViews{}, RouteViews(bindViews{})} {
+		app := fiber.New(fiber.Config{Views: views, PassLocalsToViews: true})
+		dr := New(app)
+		dr.AddRoute(fiber.MethodGet, "/bind", func(c *fiber.Ctx) error {
+			return c.Render("index", fiber.Map{"title": "x"})
+		}, WithLayout("page"))
+		dr.AddRoute(fiber.MethodGet, "/render", func(c *fiber.Ctx) error {
+			return Render(c, "index", nil)
+		}, WithRenderer(testViews("route")))
+		if _, body := get(t, app, "/bind"); !strings.Contains(body, "title") || strings.Contains(body, routeViewsKey) {
+			t.Errorf("%T: GET /bind bound %q", views, body)
+		}
+		if _, body := get(t, app, "/render"); body != "route:index:" {
+			t.Errorf("%T: GET /render = %q, want route:index:", views, body)
+		}
+	}
+}
+
+func TestRenderFailureLeavesResponse(t *testing.T) {
+	app := fiber.New()
+	dr := New(app)
+	dr.AddRouteWithOptions(fiber.MethodGet, "/", func(c *fiber.Ctx) error {
+		if err := Render(c, "broken", nil); err == nil {
+			t.Error("Render of a failing template succeeded")
+		}
+		return nil
+	}, []RouteOption{WithRenderer(testViews("route"))})
+	if _, body := get(t, app, "/"); body != "" {
+		t.Errorf("GET / = %q after a failed render", body)
+	}
+}
+
+func TestReloadableViewsWatch(t *testing.T) {
+	dir := t.TempDir()
+	var builds atomic.Int32
+	views := NewReloadableViews(func() fiber.Views {
+		builds.Add(1)
+		return testViews("disk")
+	})
+	stopFirst, err := views.Watch(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := views.Watch(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := stopFirst(); err != nil {
+		t.Errorf("stopping a replaced watcher: %v", err)
+	}
+	write := func(name string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * templateReloadDelay)
+	}
+	before := builds.Load()
+	write("a.html")
+	if got := builds.Load() - before; got != 1 {
+		t.Errorf("%d reloads after a change, want 1", got)
+	}
+	if err := views.Close(); err != nil {
+		t.Fatal(err)
+	}
+	before = builds.Load()
+	write("b.html")
+	if got := builds.Load() - before; got != 0 {
+		t.Errorf("%d reloads after Close, want 0", got)
+	}
+}
@@ -0,0 +1,310 @@
+package router
+
+import (
+	"bytes"
+	"encoding/xml"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/oarkflow/json"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Response formats offered by Respond.
+const (
+	FormatHTML    = "html"
+	FormatJSON    = "json"
+	FormatXML     = "xml"
+	FormatMsgPack = "msgpack"
+)
+
+// formatMediaTypes lists the media types accepted for each format. The
+// first one is sent as Content-Type.
+var formatMediaTypes = map[string][]string{
+	FormatHTML:    {fiber.MIMETextHTML},
+	FormatJSON:    {fiber.MIMEApplicationJSON},
+	FormatXML:     {fiber.MIMEApplicationXML, fiber.MIMETextXML},
+	FormatMsgPack: {"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"},
+}
+
+// defaultFormats is the server preference used when the client accepts
+// several formats equally.
+var defaultFormats = []string{FormatJSON, FormatHTML, FormatXML, FormatMsgPack}
+
+// RespondOptions configures Respond.
+type RespondOptions struct {
+	// Status is the response status.
+	//
+	// Optional. Default: 200
+	Status int
+	// Template renders HTML responses through Render. HTML is only offered
+	// when it is set.
+	Template string
+	// Layout overrides the layout used for HTML responses.
+	Layout string
+	// Formats restricts the formats offered for this response, in order of
+	// preference. It is intersected with the route's formats.
+	//
+	// Optional. Default: json, html, xml, msgpack
+	Formats []string
+	// XMLRoot names the root element of XML responses.
+	//
+	// Optional. Default: "response"
+	XMLRoot string
+}
+
+// WithFormats restricts the formats Respond offers for the route.
+func WithFormats(formats ...string) RouteOption {
+	return func(r *Route) {
+		r.Formats = formats
+	}
+}
+
+// Respond sends data in the representation the client prefers according to
+// its Accept header: a template rendered with the route renderer for HTML,
+// JSON, XML or MessagePack. It answers 406 when none of the offered formats
+// is acceptable, and always sets Vary: Accept.
+func Respond(c *fiber.Ctx, data any, opts ...RespondOptions) error {
+	var opt RespondOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Status == 0 {
+		opt.Status = fiber.StatusOK
+	}
+	if opt.XMLRoot == "" {
+		opt.XMLRoot = "response"
+	}
+	c.Vary(fiber.HeaderAccept)
+	formats := offeredFormats(RouteFromCtx(c), opt)
+	var offers []string
+	for _, format := range formats {
+		offers = append(offers, formatMediaTypes[format]...)
+	}
+	accepted := ""
+	if len(offers) > 0 {
+		accepted = c.Accepts(offers...)
+	}
+	format := ""
+	for f, types := range formatMediaTypes {
+		for _, t := range types {
+			if t == accepted {
+				format = f
+			}
+		}
+	}
+	c.Status(opt.Status)
+	switch format {
+	case FormatHTML:
+		var layouts []string
+		if opt.Layout != "" {
+			layouts = []string{opt.Layout}
+		}
+		return Render(c, opt.Template, data, layouts...)
+	case FormatJSON:
+		return c.JSON(data)
+	case FormatXML:
+		out, err := marshalXML(opt.XMLRoot, data)
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationXMLCharsetUTF8)
+		return c.Send(out)
+	case FormatMsgPack:
+		out, err := marshalMsgPack(data)
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, formatMediaTypes[FormatMsgPack][0])
+		return c.Send(out)
+	}
+	var available []string
+	for _, f := range formats {
+		available = append(available, formatMediaTypes[f][0])
+	}
+	return c.Status(fiber.StatusNotAcceptable).SendString("Not Acceptable. Available: " + strings.Join(available, ", "))
+}
+
+// offeredFormats returns the formats a response may use, in preference order.
+func offeredFormats(route *Route, opt RespondOptions) []string {
+	formats := opt.Formats
+	if len(formats) == 0 {
+		formats = defaultFormats
+	}
+	var offered []string
+	for _, f := range formats {
+		f = strings.ToLower(f)
+		if _, known := formatMediaTypes[f]; !known {
+			continue
+		}
+		if f == FormatHTML && opt.Template == "" {
+			continue
+		}
+		if route != nil && len(route.Formats) > 0 && !containsFold(route.Formats, f) {
+			continue
+		}
+		offered = append(offered, f)
+	}
+	return offered
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// plainValue converts data to maps, slices and scalars through its JSON
+// encoding, so that every format sees the same field names.
+func plainValue(data any) (any, error) {
+	switch data.(type) {
+	case nil, string, bool, float64, map[string]any, []any:
+		return data, nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// marshalMsgPack encodes data as MessagePack. Types generated by msgp use
+// their own encoder.
+func marshalMsgPack(data any) ([]byte, error) {
+	if m, ok := data.(msgp.Marshaler); ok {
+		return m.MarshalMsg(nil)
+	}
+	plain, err := plainValue(data)
+	if err != nil {
+		return nil, err
+	}
+	return msgp.AppendIntf(nil, integralNumbers(plain))
+}
+
+// integralNumbers turns whole float64 values into int64, so that integers
+// decoded from JSON keep a compact integer encoding.
+func integralNumbers(v any) any {
+	switch val := v.(type) {
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+			return int64(val)
+		}
+		return val
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for key, item := range val {
+			out[key] = integralNumbers(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = integralNumbers(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// marshalXML encodes data as XML using the convention of request decoding:
+// object keys become child elements, except "@name" keys, which become
+// attributes, and "#text", which becomes the element text. Array items are
+// repeated elements named after their key, or "item" at the top level.
+// Keys that are not valid XML names are encoded as <entry key="...">
+// elements, and as such elements in place of attributes.
+func marshalXML(root string, data any) ([]byte, error) {
+	plain, err := plainValue(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if list, ok := plain.([]any); ok {
+		plain = map[string]any{"item": list}
+	}
+	if err := encodeXMLElement(enc, root, plain); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeXMLElement(enc *xml.Encoder, name string, value any) error {
+	if list, ok := value.([]any); ok {
+		for _, item := range list {
+			if err := encodeXMLElement(enc, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !isXMLName(name) {
+		start = xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}}}
+	}
+	obj, isObject := value.(map[string]any)
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if attr, ok := strings.CutPrefix(key, "@"); ok && isXMLName(attr) {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attr}, Value: formatMessageValue(obj[key])})
+		}
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if isObject {
+		for _, key := range keys {
+			switch {
+			case strings.HasPrefix(key, "@") && isXMLName(key[1:]):
+			case key == "#text":
+				if err := enc.EncodeToken(xml.CharData(formatMessageValue(obj[key]))); err != nil {
+					return err
+				}
+			default:
+				if err := encodeXMLElement(enc, key, obj[key]); err != nil {
+					return err
+				}
+			}
+		}
+	} else if value != nil {
+		if err := enc.EncodeToken(xml.CharData(formatMessageValue(value))); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// isXMLName reports whether name can be used as an element or attribute
+// name as is. Names with a namespace prefix are not.
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
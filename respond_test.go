@@ -0,0 +1,49 @@
+package router
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMarshalXML(t *testing.T) {
+	data := map[string]any{
+		"name":          "a<b",
+		"@id":           7,
+		"tags":          []any{"x", "y"},
+		"bad key":       1,
+		"x><evil/><y":   2,
+		"@bad attr":     3,
+		"nested":        map[string]any{"#text": "t", "@lang": "en"},
+		"1starts-digit": true,
+	}
+	out, err := marshalXML("user", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(out)
+	want := `<user id="7">` +
+		`<entry key="1starts-digit">true</entry>` +
+		`<entry key="@bad attr">3</entry>` +
+		`<entry key="bad key">1</entry>` +
+		`<name>a&lt;b</name>` +
+		`<nested lang="en">t</nested>` +
+		`<tags>x</tags><tags>y</tags>` +
+		`<entry key="x&gt;&lt;evil/&gt;&lt;y">2</entry>` +
+		`</user>`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("marshalXML =\n%s\nwant\n%s", got, want)
+	}
+	dec := xml.NewDecoder(bytes.NewReader(out))
+	for {
+		_, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("output is not well-formed: %v", err)
+		}
+	}
+}
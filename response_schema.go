@@ -0,0 +1,178 @@
+package router
+
+import (
+	"expvar"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/oarkflow/json"
+	"github.com/oarkflow/log"
+)
+
+// ResponseValidationMode selects what happens when a handler's response
+// does not match the response schema documented for its status code.
+type ResponseValidationMode int
+
+const (
+	// ResponseValidationOff skips response validation.
+	ResponseValidationOff ResponseValidationMode = iota
+	// ResponseValidationStrict replaces an invalid response with a 500
+	// listing the violations. Meant for development and tests.
+	ResponseValidationStrict
+	// ResponseValidationReport logs violations and records metrics but sends
+	// the response unchanged. Meant for production, usually with sampling.
+	ResponseValidationReport
+)
+
+// ResponseValidationConfig configures response schema validation.
+type ResponseValidationConfig struct {
+	// Mode selects the validation behaviour.
+	//
+	// Optional. Default: ResponseValidationOff
+	Mode ResponseValidationMode
+	// SampleRate is the fraction of responses validated in report mode,
+	// between 0 and 1. Strict mode always validates every response.
+	//
+	// Optional. Default: 1
+	SampleRate float64
+	// OnViolation is called with every invalid response, e.g. to forward
+	// violations to a metrics or alerting system.
+	//
+	// Optional. Default: nil
+	OnViolation func(c *fiber.Ctx, route *Route, status int, violations []Violation)
+}
+
+// responseValidationMetrics exposes counters through expvar under
+// "router_response_validation".
+var responseValidationMetrics = expvar.NewMap("router_response_validation")
+
+// WithResponseSchema documents the response body for a status code. Status 0
+// applies to every status without a dedicated schema.
+func WithResponseSchema(status int, schema *Schema) RouteOption {
+	return func(r *Route) {
+		if r.ResponseSchemas == nil {
+			r.ResponseSchemas = make(map[int]*Schema)
+		}
+		r.ResponseSchemas[status] = schema
+	}
+}
+
+// SetResponseValidation configures how responses are checked against the
+// response schemas of their routes.
+func (dr *Router) SetResponseValidation(cfg ResponseValidationConfig) {
+	if cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+		cfg.SampleRate = 1
+	}
+	dr.responseValidation.Store(&cfg)
+	log.Info().Int("mode", int(cfg.Mode)).Float64("sampleRate", cfg.SampleRate).Msg("Set response validation")
+}
+
+// ResponseValidation returns how responses are checked, as set by
+// SetResponseValidation. Responses are not checked by default.
+func (dr *Router) ResponseValidation() ResponseValidationConfig {
+	if cfg := dr.responseValidation.Load(); cfg != nil {
+		return *cfg
+	}
+	return ResponseValidationConfig{}
+}
+
+// SetResponseSchema documents the response body of an existing route for
+// a status code.
+func (dr *Router) SetResponseSchema(method, path string, status int, schema *Schema) error {
+	found := dr.updateRoute(method, path, func(route *Route) {
+		schemas := make(map[int]*Schema, len(route.ResponseSchemas)+1)
+		for code, s := range route.ResponseSchemas {
+			schemas[code] = s
+		}
+		schemas[status] = schema
+		route.ResponseSchemas = schemas
+	})
+	if !found {
+		return fmt.Errorf("route %s %s not found", strings.ToUpper(method), path)
+	}
+	log.Info().Str("method", method).Str("path", path).Int("status", status).Msg("Set response schema for route")
+	return nil
+}
+
+// RemoveResponseSchema removes the response schema of a route for a status code.
+func (dr *Router) RemoveResponseSchema(method, path string, status int) error {
+	found := dr.updateRoute(method, path, func(route *Route) {
+		schemas := make(map[int]*Schema, len(route.ResponseSchemas))
+		for code, s := range route.ResponseSchemas {
+			if code != status {
+				schemas[code] = s
+			}
+		}
+		route.ResponseSchemas = schemas
+	})
+	if !found {
+		return fmt.Errorf("route %s %s not found", strings.ToUpper(method), path)
+	}
+	log.Info().Str("method", method).Str("path", path).Int("status", status).Msg("Removed response schema from route")
+	return nil
+}
+
+// responseSchema returns the schema documented for status, if any.
+func (dr *Route) responseSchema(status int) *Schema {
+	if s, ok := dr.ResponseSchemas[status]; ok {
+		return s
+	}
+	return dr.ResponseSchemas[0]
+}
+
+// validateResponse checks the response body produced by the handler chain
+// against the route's response schema, according to the router's mode.
+func (dr *Route) validateResponse(c *fiber.Ctx) {
+	if dr.router == nil || len(dr.ResponseSchemas) == 0 {
+		return
+	}
+	cfg := dr.router.ResponseValidation()
+	if cfg.Mode == ResponseValidationOff {
+		return
+	}
+	if cfg.Mode == ResponseValidationReport && cfg.SampleRate < 1 && rand.Float64() >= cfg.SampleRate {
+		return
+	}
+	resp := c.Response()
+	status := resp.StatusCode()
+	schema := dr.responseSchema(status)
+	if schema == nil || len(resp.Header.Peek(fiber.HeaderContentEncoding)) > 0 {
+		return
+	}
+	if !strings.Contains(string(resp.Header.ContentType()), "json") {
+		return
+	}
+	responseValidationMetrics.Add("checked", 1)
+	var data any
+	var violations []Violation
+	if err := json.Unmarshal(resp.Body(), &data); err != nil {
+		violations = []Violation{{In: LocationBody, Keyword: "syntax", Expected: "JSON", Actual: err.Error()}}
+	} else {
+		violations = validateDocument(schema.document(), data, LocationBody)
+	}
+	if len(violations) == 0 {
+		return
+	}
+	localizeViolations(c, violations)
+	responseValidationMetrics.Add("failed", 1)
+	responseValidationMetrics.Add(dr.Method+" "+dr.Path+" "+strconv.Itoa(status), 1)
+	if cfg.OnViolation != nil {
+		cfg.OnViolation(c, dr, status, violations)
+	}
+	if cfg.Mode == ResponseValidationStrict {
+		log.Error().Str("method", dr.Method).Str("path", dr.Path).Int("status", status).Int("violations", len(violations)).Msg("Response does not match schema")
+		resp.Header.Del(fiber.HeaderContentLength)
+		_ = c.Status(fiber.StatusInternalServerError).JSON(map[string]any{
+			"success": false,
+			"message": "response validation failed",
+			"code":    fiber.StatusInternalServerError,
+			"status":  status,
+			"errors":  violations,
+		})
+		return
+	}
+	log.Warn().Str("method", dr.Method).Str("path", dr.Path).Int("status", status).Int("violations", len(violations)).Msgf("Response does not match schema: %s %s", violations[0].Pointer, violations[0].Keyword)
+}
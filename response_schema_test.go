@@ -0,0 +1,108 @@
+package router
+
+import (
+	"expvar"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// responseApp serves GET /valid and GET /invalid, whose responses are
+// checked against a schema requiring an integer "id".
+func responseApp(t *testing.T, cfg ResponseValidationConfig) (*fiber.App, *Router) {
+	t.Helper()
+	app := fiber.New()
+	dr := New(app)
+	schema, err := CompileSchema([]byte(`{"type": "object", "required": ["id"], "properties": {"id": {"type": "integer"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr.AddRoute(fiber.MethodGet, "/valid", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"id": 1})
+	}, WithResponseSchema(fiber.StatusOK, schema))
+	dr.AddRoute(fiber.MethodGet, "/invalid", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"id": "one"})
+	}, WithResponseSchema(0, schema))
+	dr.SetResponseValidation(cfg)
+	return app, dr
+}
+
+func failedResponses() int64 {
+	if v, ok := responseValidationMetrics.Get("failed").(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestResponseValidationStrict(t *testing.T) {
+	var reported []Violation
+	app, _ := responseApp(t, ResponseValidationConfig{
+		Mode: ResponseValidationStrict,
+		OnViolation: func(_ *fiber.Ctx, _ *Route, _ int, violations []Violation) {
+			reported = append(reported, violations...)
+		},
+	})
+	if status, body := get(t, app, "/valid"); status != fiber.StatusOK || body != `{"id":1}` {
+		t.Errorf("GET /valid = %d %s", status, body)
+	}
+	status, body := get(t, app, "/invalid")
+	if status != fiber.StatusInternalServerError || !strings.Contains(body, "response validation failed") || !strings.Contains(body, `"pointer":"/id"`) {
+		t.Errorf("GET /invalid = %d %s, want the response replaced by a 500", status, body)
+	}
+	if len(reported) != 1 || reported[0].Keyword != "type" {
+		t.Errorf("reported violations = %+v", reported)
+	}
+}
+
+func TestResponseValidationReport(t *testing.T) {
+	calls := 0
+	app, _ := responseApp(t, ResponseValidationConfig{
+		Mode:        ResponseValidationReport,
+		OnViolation: func(*fiber.Ctx, *Route, int, []Violation) { calls++ },
+	})
+	before := failedResponses()
+	if status, body := get(t, app, "/invalid"); status != fiber.StatusOK || body != `{"id":"one"}` {
+		t.Errorf("GET /invalid = %d %s, want the response passed through", status, body)
+	}
+	if calls != 1 {
+		t.Errorf("OnViolation called %d times, want 1", calls)
+	}
+	if got := failedResponses() - before; got != 1 {
+		t.Errorf("failed metric grew by %d, want 1", got)
+	}
+}
+
+func TestResponseValidationSampling(t *testing.T) {
+	calls := 0
+	app, dr := responseApp(t, ResponseValidationConfig{
+		Mode:        ResponseValidationReport,
+		SampleRate:  0.25,
+		OnViolation: func(*fiber.Ctx, *Route, int, []Violation) { calls++ },
+	})
+	const requests = 400
+	for i := 0; i < requests; i++ {
+		get(t, app, "/invalid")
+	}
+	if calls < requests/10 || calls > requests/2 {
+		t.Errorf("%d of %d responses validated at a sample rate of 0.25", calls, requests)
+	}
+	for _, rate := range []float64{0, 2} {
+		dr.SetResponseValidation(ResponseValidationConfig{Mode: ResponseValidationReport, SampleRate: rate})
+		if got := dr.ResponseValidation().SampleRate; got != 1 {
+			t.Errorf("sample rate %v was stored as %v, want 1", rate, got)
+		}
+	}
+	calls = 0
+	dr.SetResponseValidation(ResponseValidationConfig{
+		Mode:        ResponseValidationStrict,
+		SampleRate:  0.01,
+		OnViolation: func(*fiber.Ctx, *Route, int, []Violation) { calls++ },
+	})
+	for i := 0; i < 20; i++ {
+		get(t, app, "/invalid")
+	}
+	if calls != 20 {
+		t.Errorf("strict mode validated %d of 20 responses", calls)
+	}
+}
@@ -1,13 +1,18 @@
 package router
 
 import (
+	"errors"
 	"fmt"
+	"html/template"
+	"maps"
 	"mime"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -19,6 +24,8 @@ import (
 type middlewareEntry struct {
 	id      uintptr
 	handler fiber.Handler
+	// security is the handle the middleware was added through, if any.
+	security *Security
 }
 
 func wrapMiddleware(m fiber.Handler) middlewareEntry {
@@ -42,6 +49,10 @@ var (
 
 func init() {
 	ErrorHandler = func(c *fiber.Ctx, err error) error {
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			return sendValidationError(c, validationErr)
+		}
 		resp := map[string]any{
 			"success": false,
 			"message": err.Error(),
@@ -71,6 +82,42 @@ type Route struct {
 	Middlewares []middlewareEntry
 	// Renderer is used to render the response.
 	Renderer fiber.Views
+	// Layout is the layout Render uses for the route.
+	Layout string
+	// Formats restricts the response formats Respond offers for the route.
+	Formats []string
+	// RequestSchema validates the request when ValidateRequestBySchema is used.
+	RequestSchema *Schema
+	// ResponseSchemas document the response body per status code and are
+	// checked according to the router's response validation mode.
+	ResponseSchemas map[int]*Schema
+	// Summary, Description, OperationID and Tags describe the route in the
+	// OpenAPI document.
+	Summary     string
+	Description string
+	OperationID string
+	Tags        []string
+	// Hidden leaves the route out of the OpenAPI document.
+	Hidden bool
+	// NormalizeBody re-encodes validated form, multipart and XML bodies as
+	// JSON for the handler.
+	NormalizeBody bool
+	router        *Router
+	group         *Group
+	// config is the configuration the route was built from, see WithConfig.
+	config any
+}
+
+// clone returns a copy of the route. Routes being served are never
+// modified: updates are made to a copy that replaces the route, so that a
+// request keeps the route it matched.
+func (dr *Route) clone() *Route {
+	c := *dr
+	c.Middlewares = slices.Clone(dr.Middlewares)
+	c.Formats = slices.Clone(dr.Formats)
+	c.Tags = slices.Clone(dr.Tags)
+	c.ResponseSchemas = maps.Clone(dr.ResponseSchemas)
+	return &c
 }
 
 // Serve executes the route's handler chain.
@@ -80,11 +127,13 @@ func (dr *Route) Serve(c *fiber.Ctx) error {
 		chain = append(chain, m.handler)
 	}
 	chain = append(chain, dr.Handler)
+	dr.bindRendering(c)
 	c.Locals("chain_handlers", chain)
 	c.Locals("chain_index", 0)
 	if err := Next(c); err != nil {
 		return fmt.Errorf("chain error: %w", err)
 	}
+	dr.validateResponse(c)
 	body := c.Response().Body()
 	if len(body) > 0 {
 		compData, err := compressData(c, body)
@@ -126,6 +175,9 @@ type Static struct {
 	Index            string
 	DirectoryListing bool
 	CompressionLevel int
+	Dotfiles         DotfilesPolicy
+	ListingTemplate  *template.Template
+	Precompressed    bool
 }
 
 type staticCacheEntry struct {
@@ -142,19 +194,32 @@ type StaticConfig struct {
 	DirectoryListing bool
 	CompressionLevel int
 	Index            string
+	// Dotfiles controls whether dotfiles appear in directory listings.
+	Dotfiles DotfilesPolicy
+	// ListingTemplate overrides DefaultListingTemplate for directory listings.
+	ListingTemplate *template.Template
+	// Precompressed serves .br, .zst or .gz siblings of a file when the
+	// client accepts that encoding, instead of compressing on the fly.
+	Precompressed bool
 }
 
 // Router represents the HTTP router.
 type Router struct {
-	app          fiber.Router
-	routes       sync.Map // key: string (HTTP method) -> *methodRoutes
-	staticRoutes []Static
+	app fiber.Router
+	// current holds the dynamic and static routes being served.
+	current atomic.Pointer[routeTable]
 	// GlobalMiddlewares are applied to every route.
 	GlobalMiddlewares []middlewareEntry
 	// NotFoundHandler is invoked when no route matches.
 	NotFoundHandler fiber.Handler
-	staticCache     map[string]staticCacheEntry
-	staticCacheLock sync.RWMutex
+	// responseValidation controls checking of responses against route
+	// response schemas, see SetResponseValidation.
+	responseValidation atomic.Pointer[ResponseValidationConfig]
+	staticCache        map[string]staticCacheEntry
+	staticCacheLock    sync.RWMutex
+	// unwrappedViews reports once that c.Render ignores route renderers
+	// because the app's Views are not RouteViews.
+	unwrappedViews sync.Once
 }
 
 // New creates and returns a new Router instance.
@@ -163,6 +228,7 @@ func New(app fiber.Router) *Router {
 		app:         app,
 		staticCache: make(map[string]staticCacheEntry),
 	}
+	dr.current.Store(&routeTable{})
 	app.Use(func(c *fiber.Ctx) error {
 		err := c.Next()
 		if err != nil {
@@ -224,7 +290,12 @@ func (dr *Router) Use(mw ...fiber.Handler) {
 }
 
 func (dr *Router) MatchRoute(method, path string) (*Route, bool, map[string]string) {
-	if v, ok := dr.routes.Load(method); ok {
+	return dr.table().match(method, path)
+}
+
+// match finds the route serving method and path in the table.
+func (t *routeTable) match(method, path string) (*Route, bool, map[string]string) {
+	if v, ok := t.routes.Load(method); ok {
 		mr := v.(*methodRoutes)
 		mr.mu.RLock()
 		defer mr.mu.RUnlock()
@@ -242,17 +313,35 @@ func (dr *Router) MatchRoute(method, path string) (*Route, bool, map[string]stri
 
 func (dr *Router) dispatch(c *fiber.Ctx) error {
 	globalChain := dr.GetGlobalMiddlewareChain()
+	method := c.Method()
+	path := c.Path()
+	// The table is loaded once so that a request is served by a single
+	// version of the routes even if they are swapped meanwhile.
+	table := dr.table()
+	route, matched, params := table.match(method, path)
+	setMatch := func(c *fiber.Ctx) {
+		if matched {
+			c.Locals("route", route)
+		} else {
+			c.Locals("route", nil)
+		}
+		if params != nil {
+			c.Locals("params", params)
+		}
+	}
+	setMatch(c)
 	nextFunc := func(c *fiber.Ctx) error {
-		method := c.Method()
-		path := c.Path()
-		route, matched, params := dr.MatchRoute(method, path)
+		if c.Method() != method || c.Path() != path {
+			// A global middleware rewrote the request, so match it again.
+			method = c.Method()
+			path = c.Path()
+			route, matched, params = table.match(method, path)
+			setMatch(c)
+		}
 		if matched {
-			if params != nil {
-				c.Locals("params", params)
-			}
 			return route.Serve(c)
 		}
-		for _, sr := range dr.staticRoutes {
+		for _, sr := range table.static {
 			if strings.HasPrefix(path, sr.Prefix) {
 				relativePath := strings.TrimPrefix(path, sr.Prefix)
 				cleanRelative := filepath.Clean(relativePath)
@@ -270,23 +359,7 @@ func (dr *Router) dispatch(c *fiber.Ctx) error {
 				info, err := os.Stat(filePath)
 				if err == nil && info.IsDir() {
 					if sr.DirectoryListing {
-						entries, err := os.ReadDir(filePath)
-						if err != nil {
-							log.Error().Err(err).Msgf("Failed to read directory: %s", filePath)
-							return c.Status(500).SendString("Error reading directory")
-						}
-						var builder strings.Builder
-						builder.WriteString("<html><head><meta charset=\"UTF-8\"><title>Directory listing</title></head><body>")
-						builder.WriteString("<h1>Directory listing for " + c.Path() + "</h1><ul>")
-						for _, entry := range entries {
-							name := entry.Name()
-							entryLink := filepath.Join(c.Path(), name)
-							builder.WriteString(fmt.Sprintf("<li><a href=\"%s\">%s</a></li>", entryLink, name))
-						}
-						builder.WriteString("</ul></body></html>")
-						data := []byte(builder.String())
-						c.Response().Header.Set("Content-Type", "text/html")
-						return c.Send(data)
+						return dr.serveDirectoryListing(c, sr, filePath)
 					}
 					file := "index.html"
 					if sr.Index != "" {
@@ -303,23 +376,21 @@ func (dr *Router) dispatch(c *fiber.Ctx) error {
 					if sr.CacheControl != "" {
 						c.Response().Header.Set("Cache-Control", sr.CacheControl)
 					}
-					var data []byte
-					dr.staticCacheLock.RLock()
-					entry, found := dr.staticCache[filePath]
-					dr.staticCacheLock.RUnlock()
-					if found && time.Since(entry.timestamp) < staticCacheTTL {
-						data = entry.data
-						log.Info().Str("file", filePath).Msg("Static cache hit")
-					} else {
-						d, err := os.ReadFile(filePath)
+					c.Vary(fiber.HeaderAcceptEncoding)
+					if sr.Precompressed {
+						served, err := dr.servePrecompressed(c, filePath)
 						if err != nil {
-							log.Error().Err(err).Msgf("Failed to read file: %s", filePath)
+							log.Error().Err(err).Msgf("Failed to read precompressed file: %s", filePath)
 							return c.Status(500).SendString("Error reading file")
 						}
-						data = d
-						dr.staticCacheLock.Lock()
-						dr.staticCache[filePath] = staticCacheEntry{data: data, timestamp: time.Now()}
-						dr.staticCacheLock.Unlock()
+						if served {
+							return nil
+						}
+					}
+					data, err := dr.readStaticFile(filePath)
+					if err != nil {
+						log.Error().Err(err).Msgf("Failed to read file: %s", filePath)
+						return c.Status(500).SendString("Error reading file")
 					}
 					compData, err := compressData(c, data)
 					if err != nil {
@@ -342,31 +413,62 @@ func (dr *Router) dispatch(c *fiber.Ctx) error {
 	return Next(c)
 }
 
-// AddRoute adds a new dynamic route.
-func (dr *Router) AddRoute(method, path string, handler fiber.Handler, middlewares ...fiber.Handler) {
-	method = strings.ToUpper(method)
-	var mr *methodRoutes
-	if v, ok := dr.routes.Load(method); !ok {
-		mr = &methodRoutes{
-			exact:  make(map[string]*Route),
-			params: []*Route{},
+// AddRoute adds a new dynamic route. Args are route middlewares
+// (fiber.Handler) and route options (RouteOption), such as
+// WithRequestSchema, in any order.
+func (dr *Router) AddRoute(method, path string, handler fiber.Handler, args ...any) {
+	opts, middlewares := routeArgs(args)
+	dr.AddRouteWithOptions(method, path, handler, opts, middlewares...)
+}
+
+// routeArgs splits AddRoute arguments into route options and middlewares.
+// It panics on any other argument, like fiber does for invalid handlers.
+func routeArgs(args []any) ([]RouteOption, []fiber.Handler) {
+	var opts []RouteOption
+	var middlewares []fiber.Handler
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case RouteOption:
+			opts = append(opts, arg)
+		case fiber.Handler:
+			middlewares = append(middlewares, arg)
+		default:
+			panic(fmt.Sprintf("router: invalid route argument of type %T", arg))
 		}
-		dr.routes.Store(method, mr)
-	} else {
-		mr = v.(*methodRoutes)
 	}
-	mr.mu.Lock()
-	defer mr.mu.Unlock()
+	return opts, middlewares
+}
 
+// AddRouteWithOptions adds a new dynamic route configured by opts, such as
+// WithRequestSchema.
+func (dr *Router) AddRouteWithOptions(method, path string, handler fiber.Handler, opts []RouteOption, middlewares ...fiber.Handler) {
 	var mwEntries []middlewareEntry
 	for _, m := range middlewares {
 		mwEntries = append(mwEntries, wrapMiddleware(m))
 	}
+	dr.addRoute(method, path, handler, opts, mwEntries)
+}
+
+// addRoute adds a route with its middleware entries.
+func (dr *Router) addRoute(method, path string, handler fiber.Handler, opts []RouteOption, mwEntries []middlewareEntry) {
+	method = strings.ToUpper(method)
+	v, _ := dr.table().routes.LoadOrStore(method, &methodRoutes{
+		exact:  make(map[string]*Route),
+		params: []*Route{},
+	})
+	mr := v.(*methodRoutes)
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
 	route := &Route{
 		Method:      method,
 		Path:        path,
 		Handler:     handler,
 		Middlewares: mwEntries,
+		router:      dr,
+	}
+	for _, opt := range opts {
+		opt(route)
 	}
 	if strings.Contains(path, ":") {
 		mr.params = append(mr.params, route)
@@ -378,36 +480,38 @@ func (dr *Router) AddRoute(method, path string, handler fiber.Handler, middlewar
 
 // UpdateRoute updates the handler of an existing route.
 func (dr *Router) UpdateRoute(method, path string, newHandler fiber.Handler) {
-	method = strings.ToUpper(method)
-	if v, ok := dr.routes.Load(method); ok {
-		mr := v.(*methodRoutes)
-		mr.mu.Lock()
-		defer mr.mu.Unlock()
-		if route, exists := mr.exact[path]; exists {
-			route.Handler = newHandler
-			log.Info().Str("method", method).Str("path", path).Msg("Updated dynamic route handler")
-			return
-		}
-		for _, route := range mr.params {
-			if route.Path == path {
-				route.Handler = newHandler
-				log.Info().Str("method", method).Str("path", path).Msg("Updated dynamic route handler")
-				return
-			}
-		}
+	if !dr.updateRoute(method, path, func(route *Route) {
+		route.Handler = newHandler
+	}) {
+		log.Warn().Str("method", method).Str("path", path).Msg("Route not found for update")
+		return
 	}
-	log.Warn().Str("method", method).Str("path", path).Msg("Route not found for update")
+	log.Info().Str("method", method).Str("path", path).Msg("Updated dynamic route handler")
 }
 
 // RenameRoute renames an existing dynamic route.
 func (dr *Router) RenameRoute(method, oldPath, newPath string) {
 	method = strings.ToUpper(method)
-	if v, ok := dr.routes.Load(method); ok {
+	if v, ok := dr.table().routes.Load(method); ok {
 		mr := v.(*methodRoutes)
 		mr.mu.Lock()
 		defer mr.mu.Unlock()
-		if route, exists := mr.exact[oldPath]; exists {
+		var route *Route
+		if r, exists := mr.exact[oldPath]; exists {
 			delete(mr.exact, oldPath)
+			route = r
+		} else {
+			for i, r := range mr.params {
+				if r.Path == oldPath {
+					mr.params = slices.Delete(mr.params, i, i+1)
+					route = r
+					break
+				}
+			}
+		}
+		if route != nil {
+			// Requests already matched keep the route with its old path.
+			route = route.clone()
 			route.Path = newPath
 			if strings.Contains(newPath, ":") {
 				mr.params = append(mr.params, route)
@@ -417,110 +521,45 @@ func (dr *Router) RenameRoute(method, oldPath, newPath string) {
 			log.Info().Str("method", method).Str("oldPath", oldPath).Str("newPath", newPath).Msg("Renamed route")
 			return
 		}
-		for i, route := range mr.params {
-			if route.Path == oldPath {
-				mr.params = append(mr.params[:i], mr.params[i+1:]...)
-				route.Path = newPath
-				if strings.Contains(newPath, ":") {
-					mr.params = append(mr.params, route)
-				} else {
-					mr.exact[newPath] = route
-				}
-				log.Info().Str("method", method).Str("oldPath", oldPath).Str("newPath", newPath).Msg("Renamed route")
-				return
-			}
-		}
 	}
 	log.Warn().Str("method", method).Str("oldPath", oldPath).Str("newPath", newPath).Msg("Route not found for rename")
 }
 
 // AddMiddleware adds middleware to an existing route.
 func (dr *Router) AddMiddleware(method, path string, middlewares ...fiber.Handler) {
-	method = strings.ToUpper(method)
-	if v, ok := dr.routes.Load(method); ok {
-		mr := v.(*methodRoutes)
-		mr.mu.Lock()
-		defer mr.mu.Unlock()
-		if route, exists := mr.exact[path]; exists {
-			for _, m := range middlewares {
-				route.Middlewares = append(route.Middlewares, wrapMiddleware(m))
-			}
-			log.Info().Str("method", method).Str("path", path).Int("count", len(middlewares)).Msg("Added middleware to route")
-			return
-		}
-		for _, route := range mr.params {
-			if route.Path == path {
-				for _, m := range middlewares {
-					route.Middlewares = append(route.Middlewares, wrapMiddleware(m))
-				}
-				log.Info().Str("method", method).Str("path", path).Int("count", len(middlewares)).Msg("Added middleware to route")
-				return
-			}
+	if !dr.updateRoute(method, path, func(route *Route) {
+		for _, m := range middlewares {
+			route.Middlewares = append(route.Middlewares, wrapMiddleware(m))
 		}
+	}) {
+		log.Warn().Str("method", method).Str("path", path).Int("count", len(middlewares)).Msg("Route not found for adding middleware")
+		return
 	}
-	log.Warn().Str("method", method).Str("path", path).Int("count", len(middlewares)).Msg("Route not found for adding middleware")
+	log.Info().Str("method", method).Str("path", path).Int("count", len(middlewares)).Msg("Added middleware to route")
 }
 
 // RemoveMiddleware removes middleware from a route.
 func (dr *Router) RemoveMiddleware(method, path string, middlewares ...fiber.Handler) {
-	method = strings.ToUpper(method)
-	if v, ok := dr.routes.Load(method); ok {
-		mr := v.(*methodRoutes)
-		mr.mu.Lock()
-		defer mr.mu.Unlock()
-		removeFromRoute := func(route *Route) {
-			newChain := make([]middlewareEntry, 0, len(route.Middlewares))
-			for _, existing := range route.Middlewares {
-				shouldRemove := false
-				for _, rm := range middlewares {
-					if middlewareIDsEqual(rm, existing) {
-						shouldRemove = true
-						break
-					}
-				}
-				if !shouldRemove {
-					newChain = append(newChain, existing)
-				}
-			}
-			route.Middlewares = newChain
-		}
-		if route, exists := mr.exact[path]; exists {
-			removeFromRoute(route)
-			log.Info().Str("method", method).Str("path", path).Int("count", len(middlewares)).Msg("Removed middleware from route")
-			return
-		}
-		for _, route := range mr.params {
-			if route.Path == path {
-				removeFromRoute(route)
-				log.Info().Str("method", method).Str("path", path).Int("count", len(middlewares)).Msg("Removed middleware from route")
-				return
-			}
-		}
+	if !dr.updateRoute(method, path, func(route *Route) {
+		route.Middlewares = slices.DeleteFunc(route.Middlewares, func(existing middlewareEntry) bool {
+			return slices.ContainsFunc(middlewares, func(rm fiber.Handler) bool { return middlewareIDsEqual(rm, existing) })
+		})
+	}) {
+		log.Warn().Str("method", method).Str("path", path).Int("count", len(middlewares)).Msg("Route not found for removing middleware")
+		return
 	}
-	log.Warn().Str("method", method).Str("path", path).Int("count", len(middlewares)).Msg("Route not found for removing middleware")
+	log.Info().Str("method", method).Str("path", path).Int("count", len(middlewares)).Msg("Removed middleware from route")
 }
 
 // SetRenderer sets a custom renderer for a dynamic route.
 func (dr *Router) SetRenderer(method, path string, renderer fiber.Views) {
-	method = strings.ToUpper(method)
-	if v, ok := dr.routes.Load(method); ok {
-		mr := v.(*methodRoutes)
-		mr.mu.Lock()
-		defer mr.mu.Unlock()
-		if route, exists := mr.exact[path]; exists {
-			route.Renderer = renderer
-			log.Info().Str("method", method).Str("path", path).Msg("Set custom renderer for route")
-			return
-		}
-		for _, route := range mr.params {
-			if route.Path == path {
-				route.Renderer = renderer
-				log.Info().Str("method", method).Str("path", path).Msg("Set custom renderer for route")
-				return
-			}
-		}
+	if !dr.updateRoute(method, path, func(route *Route) {
+		route.Renderer = renderer
+	}) {
+		log.Warn().Str("method", method).Str("path", path).Msg("Route not found for setting renderer")
+		return
 	}
-	log.Warn().Str("method", method).Str("path", path).Msg("Route not found for setting renderer")
+	log.Info().Str("method", method).Str("path", path).Msg("Set custom renderer for route")
 }
 
 // Static adds a new static route.
@@ -531,13 +570,17 @@ func (dr *Router) Static(prefix, directory string, cfg ...StaticConfig) {
 		sc = cfg[0]
 		cacheControl = sc.CacheControl
 	}
-	dr.staticRoutes = append(dr.staticRoutes, Static{
+	t := dr.table()
+	t.static = append(t.static, Static{
 		Prefix:           prefix,
 		Directory:        directory,
 		CacheControl:     cacheControl,
 		DirectoryListing: sc.DirectoryListing,
 		CompressionLevel: sc.CompressionLevel,
 		Index:            sc.Index,
+		Dotfiles:         sc.Dotfiles,
+		ListingTemplate:  sc.ListingTemplate,
+		Precompressed:    sc.Precompressed,
 	})
 	log.Info().Str("prefix", prefix).Str("directory", directory).Msg("Added static route")
 }
@@ -545,7 +588,7 @@ func (dr *Router) Static(prefix, directory string, cfg ...StaticConfig) {
 // RemoveRoute deletes an existing dynamic route.
 func (dr *Router) RemoveRoute(method, path string) {
 	method = strings.ToUpper(method)
-	if v, ok := dr.routes.Load(method); ok {
+	if v, ok := dr.table().routes.Load(method); ok {
 		mr := v.(*methodRoutes)
 		mr.mu.Lock()
 		defer mr.mu.Unlock()
@@ -574,7 +617,7 @@ func (dr *Router) SetNotFoundHandler(handler fiber.Handler) {
 // ListRoutes returns a list of all registered dynamic routes.
 func (dr *Router) ListRoutes() []string {
 	var routesList []string
-	dr.routes.Range(func(key, value any) bool {
+	dr.table().routes.Range(func(key, value any) bool {
 		method := key.(string)
 		mr := value.(*methodRoutes)
 		mr.mu.RLock()
@@ -608,6 +651,8 @@ type GroupRoute struct {
 	handler fiber.Handler
 	// routeMWs are the group-specific middlewares for the route.
 	routeMWs []middlewareEntry
+	// opts are the route options passed when the route was added.
+	opts []RouteOption
 	// effectivePath is the complete route path.
 	effectivePath string
 }
@@ -622,6 +667,12 @@ type Group struct {
 	// routes are the routes belonging to the group.
 	routes []*GroupRoute
 	router *Router
+	// renderer and layout are used by Render for routes without their own.
+	// renderMu guards them, as SetRenderer may be called while serving.
+	renderMu sync.RWMutex
+	renderer fiber.Views
+	layout   string
+	parent   *Group
 }
 
 func (g *Group) Use(args ...any) fiber.Router {
@@ -632,59 +683,57 @@ func getHandlers(handlers ...fiber.Handler) (fiber.Handler, []fiber.Handler) {
 	if len(handlers) == 0 {
 		return nil, nil
 	}
-	last := handlers[len(handlers)-1]
-	rest := handlers[:len(handlers)-1]
-	return last, rest
+	return handlers[len(handlers)-1], handlers[:len(handlers)-1]
 }
 
 func (g *Group) Get(path string, handlers ...fiber.Handler) fiber.Router {
 	last, rest := getHandlers(handlers...)
-	return g.AddRoute("GET", path, last, rest...)
+	return g.AddRouteWithOptions("GET", path, last, nil, rest...)
 }
 
 func (g *Group) Head(path string, handlers ...fiber.Handler) fiber.Router {
 	last, rest := getHandlers(handlers...)
-	return g.AddRoute("HEAD", path, last, rest...)
+	return g.AddRouteWithOptions("HEAD", path, last, nil, rest...)
 }
 
 func (g *Group) Post(path string, handlers ...fiber.Handler) fiber.Router {
 	last, rest := getHandlers(handlers...)
-	return g.AddRoute("POST", path, last, rest...)
+	return g.AddRouteWithOptions("POST", path, last, nil, rest...)
 }
 
 func (g *Group) Put(path string, handlers ...fiber.Handler) fiber.Router {
 	last, rest := getHandlers(handlers...)
-	return g.AddRoute("PUT", path, last, rest...)
+	return g.AddRouteWithOptions("PUT", path, last, nil, rest...)
 }
 
 func (g *Group) Delete(path string, handlers ...fiber.Handler) fiber.Router {
 	last, rest := getHandlers(handlers...)
-	return g.AddRoute("DELETE", path, last, rest...)
+	return g.AddRouteWithOptions("DELETE", path, last, nil, rest...)
 }
 
 func (g *Group) Connect(path string, handlers ...fiber.Handler) fiber.Router {
 	last, rest := getHandlers(handlers...)
-	return g.AddRoute("CONNECT", path, last, rest...)
+	return g.AddRouteWithOptions("CONNECT", path, last, nil, rest...)
 }
 
 func (g *Group) Options(path string, handlers ...fiber.Handler) fiber.Router {
 	last, rest := getHandlers(handlers...)
-	return g.AddRoute("OPTIONS", path, last, rest...)
+	return g.AddRouteWithOptions("OPTIONS", path, last, nil, rest...)
 }
 
 func (g *Group) Trace(path string, handlers ...fiber.Handler) fiber.Router {
 	last, rest := getHandlers(handlers...)
-	return g.AddRoute("TRACE", path, last, rest...)
+	return g.AddRouteWithOptions("TRACE", path, last, nil, rest...)
 }
 
 func (g *Group) Patch(path string, handlers ...fiber.Handler) fiber.Router {
 	last, rest := getHandlers(handlers...)
-	return g.AddRoute("PATCH", path, last, rest...)
+	return g.AddRouteWithOptions("PATCH", path, last, nil, rest...)
 }
 
 func (g *Group) Add(method, path string, handlers ...fiber.Handler) fiber.Router {
 	last, rest := getHandlers(handlers...)
-	return g.AddRoute(method, path, last, rest...)
+	return g.AddRouteWithOptions(method, path, last, nil, rest...)
 }
 
 func (g *Group) Static(prefix, root string, config ...fiber.Static) fiber.Router {
@@ -696,7 +745,7 @@ func (g *Group) Static(prefix, root string, config ...fiber.Static) fiber.Router
 func (g *Group) All(path string, handlers ...fiber.Handler) fiber.Router {
 	for _, method := range fiber.DefaultMethods {
 		last, rest := getHandlers(handlers...)
-		g.AddRoute(method, path, last, rest...)
+		g.AddRouteWithOptions(method, path, last, nil, rest...)
 	}
 	return g
 }
@@ -732,11 +781,19 @@ func (g *Group) Group(prefix string, m ...fiber.Handler) fiber.Router {
 		prefix:      newPrefix,
 		middlewares: newMW,
 		router:      g.router,
+		parent:      g,
 	}
 }
 
-// AddRoute adds a new route to the group.
-func (g *Group) AddRoute(method, relPath string, handler fiber.Handler, m ...fiber.Handler) fiber.Router {
+// AddRoute adds a new route to the group. Args are route middlewares
+// (fiber.Handler) and route options (RouteOption) in any order.
+func (g *Group) AddRoute(method, relPath string, handler fiber.Handler, args ...any) fiber.Router {
+	opts, m := routeArgs(args)
+	return g.AddRouteWithOptions(method, relPath, handler, opts, m...)
+}
+
+// AddRouteWithOptions adds a new route to the group configured by opts.
+func (g *Group) AddRouteWithOptions(method, relPath string, handler fiber.Handler, opts []RouteOption, m ...fiber.Handler) fiber.Router {
 	effectivePath := g.prefix + relPath
 	var routeMWs []middlewareEntry
 	for _, mw := range m {
@@ -747,20 +804,28 @@ func (g *Group) AddRoute(method, relPath string, handler fiber.Handler, m ...fib
 		relPath:       relPath,
 		handler:       handler,
 		routeMWs:      routeMWs,
+		opts:          opts,
 		effectivePath: effectivePath,
 	}
 	g.routes = append(g.routes, gr)
-	combinedMW := make([]fiber.Handler, 0, len(g.middlewares)+len(routeMWs))
-	for _, m := range g.middlewares {
-		combinedMW = append(combinedMW, m.handler)
-	}
-	for _, m := range routeMWs {
-		combinedMW = append(combinedMW, m.handler)
-	}
-	g.router.AddRoute(method, effectivePath, handler, combinedMW...)
+	g.addRoute(gr)
 	return g
 }
 
+// addRoute adds a route of the group to the router, behind the group and
+// route middlewares.
+func (g *Group) addRoute(gr *GroupRoute) {
+	middlewares := make([]middlewareEntry, 0, len(g.middlewares)+len(gr.routeMWs))
+	middlewares = append(middlewares, g.middlewares...)
+	middlewares = append(middlewares, gr.routeMWs...)
+	opts := []RouteOption{withGroup(g)}
+	if g.name != "" {
+		opts = append(opts, WithTags(g.name))
+	}
+	opts = append(opts, gr.opts...)
+	g.router.addRoute(gr.method, gr.effectivePath, gr.handler, opts, middlewares)
+}
+
 // ChangePrefix updates the group's prefix and the effective path of its routes.
 func (g *Group) ChangePrefix(newPrefix string) {
 	oldPrefix := g.prefix
@@ -781,22 +846,27 @@ func (g *Group) ChangePrefix(newPrefix string) {
 func (g *Group) UpdateMiddlewares(newMW []any) {
 	var newWrapped []middlewareEntry
 	for _, m := range newMW {
-		mw, ok := m.(fiber.Handler)
-		if ok {
+		switch mw := m.(type) {
+		case fiber.Handler:
 			newWrapped = append(newWrapped, wrapMiddleware(mw))
+		case *Security:
+			newWrapped = append(newWrapped, mw.entry())
+		case middlewareEntry:
+			newWrapped = append(newWrapped, mw)
 		}
 	}
 	g.middlewares = newWrapped
 	for _, gr := range g.routes {
-		g.router.RemoveRoute(gr.method, gr.effectivePath)
-		combinedMW := make([]fiber.Handler, 0, len(g.middlewares)+len(gr.routeMWs))
-		for _, m := range g.middlewares {
-			combinedMW = append(combinedMW, m.handler)
-		}
-		for _, m := range gr.routeMWs {
-			combinedMW = append(combinedMW, m.handler)
+		mwEntries := make([]middlewareEntry, 0, len(g.middlewares)+len(gr.routeMWs))
+		mwEntries = append(mwEntries, g.middlewares...)
+		mwEntries = append(mwEntries, gr.routeMWs...)
+		// Update the live route so schemas and renderers set on it survive.
+		found := g.router.updateRoute(gr.method, gr.effectivePath, func(route *Route) {
+			route.Middlewares = mwEntries
+		})
+		if !found {
+			g.addRoute(gr)
 		}
-		g.router.AddRoute(gr.method, gr.effectivePath, gr.handler, combinedMW...)
 	}
 	log.Info().Str("groupPrefix", g.prefix).Msg("Group middlewares updated")
 }
@@ -805,7 +875,7 @@ func (g *Group) UpdateMiddlewares(newMW []any) {
 func (g *Group) AddMiddleware(mw ...any) fiber.Router {
 	current := make([]any, 0, len(g.middlewares))
 	for _, m := range g.middlewares {
-		current = append(current, m.handler)
+		current = append(current, m)
 	}
 	current = append(current, mw...)
 	g.UpdateMiddlewares(current)
@@ -824,7 +894,7 @@ func (g *Group) RemoveMiddleware(mw ...fiber.Handler) {
 			}
 		}
 		if keep {
-			newMW = append(newMW, m.handler)
+			newMW = append(newMW, m)
 		}
 	}
 	g.UpdateMiddlewares(newMW)
@@ -858,6 +928,6 @@ func (dr *Router) Group(prefix string, m ...fiber.Handler) *Group {
 
 // ClearRoutes clears all dynamic routes.
 func (dr *Router) ClearRoutes() {
-	dr.routes = sync.Map{}
+	dr.current.Store(&routeTable{static: dr.table().static})
 	log.Info().Msg("Cleared all dynamic routes")
 }
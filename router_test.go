@@ -0,0 +1,90 @@
+package router
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAddRouteWithOptions(t *testing.T) {
+	dr := New(fiber.New())
+	dr.AddRouteWithOptions(fiber.MethodGet, "/users/:id", text("user"), []RouteOption{WithSummary("Get a user"), WithHidden()})
+	route, ok, params := dr.table().match(fiber.MethodGet, "/users/42")
+	if !ok || params["id"] != "42" {
+		t.Fatalf("match = %v %v", ok, params)
+	}
+	if route.Summary != "Get a user" || !route.Hidden {
+		t.Errorf("route options not applied: %+v", route)
+	}
+}
+
+func TestAddRouteArguments(t *testing.T) {
+	app := fiber.New()
+	dr := New(app)
+	schema, err := CompileSchema([]byte(`{"type": "object", "required": ["id"], "properties": {"id": {"type": "integer", "in": "query"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr.AddRoute(fiber.MethodGet, "/items", text("items"), WithRequestSchema(schema), dr.ValidateRequestBySchema, WithSummary("List items"))
+	route, ok, _ := dr.table().match(fiber.MethodGet, "/items")
+	if !ok || route.RequestSchema != schema || route.Summary != "List items" || len(route.Middlewares) != 1 {
+		t.Fatalf("route = %+v", route)
+	}
+	if status, body := get(t, app, "/items"); status != fiber.StatusUnprocessableEntity {
+		t.Errorf("GET /items = %d %s, want 422", status, body)
+	}
+	if status, body := get(t, app, "/items?id=1"); status != fiber.StatusOK || body != "items" {
+		t.Errorf("GET /items?id=1 = %d %s", status, body)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("AddRoute accepted an invalid argument")
+		}
+	}()
+	dr.AddRoute(fiber.MethodGet, "/invalid", text("invalid"), "summary")
+}
+
+func TestUpdateRouteCopiesRoute(t *testing.T) {
+	dr := New(fiber.New())
+	dr.AddRoute(fiber.MethodGet, "/a", text("a"))
+	dr.AddRoute(fiber.MethodGet, "/b/:id", text("b"))
+	schema, err := CompileSchema([]byte(`{"type": "object"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/a", "/b/:id"} {
+		before, _, _ := dr.table().match(fiber.MethodGet, path)
+		if err := dr.SetSchema(fiber.MethodGet, path, schema); err != nil {
+			t.Fatal(err)
+		}
+		after, _, _ := dr.table().match(fiber.MethodGet, path)
+		if before.RequestSchema != nil {
+			t.Errorf("%s: route being served was modified", path)
+		}
+		if after.RequestSchema != schema {
+			t.Errorf("%s: updated route not served", path)
+		}
+	}
+}
+
+// TestUpdateRouteWhileServing is meant for the race detector.
+func TestUpdateRouteWhileServing(t *testing.T) {
+	app := fiber.New()
+	dr := New(app)
+	dr.AddRoute(fiber.MethodGet, "/a", text("a"))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			dr.SetLayout(fiber.MethodGet, "/a", "main")
+			dr.AddMiddleware(fiber.MethodGet, "/a", func(c *fiber.Ctx) error { return Next(c) })
+			dr.SetRenderer(fiber.MethodGet, "/a", nil)
+		}
+	}()
+	for range 50 {
+		get(t, app, "/a")
+	}
+	wg.Wait()
+}
@@ -1,40 +1,211 @@
 package router
 
 import (
-	"log"
+	"fmt"
+	"strings"
 	"sync"
 
+	"github.com/gofiber/fiber/v2"
 	"github.com/oarkflow/json"
-	v2 "github.com/oarkflow/json/jsonschema/v2"
+	"github.com/oarkflow/log"
 )
 
+// Schema is a JSON schema checked by CompileSchema together with the
+// document it was compiled from.
 type Schema struct {
-	m     sync.RWMutex
-	items map[string]*v2.Schema
+	// Source is the JSON document the schema was compiled from.
+	Source json.RawMessage
+	mu     sync.RWMutex
+	doc    any
 }
 
-var (
-	compiledSchemas *Schema
-	compiler        *v2.Compiler
-)
+// document returns the decoded schema document.
+func (s *Schema) document() any {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.doc
+}
+
+// source returns the document the schema was compiled from.
+func (s *Schema) source() json.RawMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Source
+}
 
-func init() {
-	compiler = v2.NewCompiler()
-	compiledSchemas = &Schema{items: make(map[string]*v2.Schema)}
+// replace swaps in a recompiled schema, so that routes holding s pick up
+// the new version.
+func (s *Schema) replace(n *Schema) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Source, s.doc = n.Source, n.doc
 }
 
-func AddSchema(key string, schema *v2.Schema) {
-	compiledSchemas.m.Lock()
-	defer compiledSchemas.m.Unlock()
-	compiledSchemas.items[key] = schema
+// CompileSchema compiles a JSON schema so it can be attached to a route. It
+// fails if the schema uses a keyword the validator does not support, a
+// pattern does not compile or a "$ref" does not resolve within the schema;
+// use SchemaRegistry.Compile for schemas referencing others.
+func CompileSchema(schema json.RawMessage) (*Schema, error) {
+	var doc any
+	if err := json.Unmarshal(schema, &doc); err != nil {
+		return nil, fmt.Errorf("decode schema: %w", err)
+	}
+	if err := checkDocument(doc); err != nil {
+		return nil, fmt.Errorf("compile schema: %w", err)
+	}
+	return &Schema{Source: schema, doc: doc}, nil
 }
 
-func CompileSchema(uri, method string, schema json.RawMessage) {
-	s, err := compiler.Compile(schema)
-	if err != nil {
-		log.Printf("Error compiling schema for %s %s: %v", method, uri, err)
-		return
+// ValidateRequest validates the request against the schema. Properties
+// declared with an "in" location other than body are read from the path,
+// query string, headers or cookies, coerced to their declared type and
+// exposed through ParamsFromCtx. The body, when present, is decoded
+// according to its Content-Type (JSON, form, multipart or XML) and
+// validated with those parameters merged in. Bodyless requests are
+// validated as an empty body when the schema declares such parameters or
+// requires body properties. It returns the body data with defaults applied
+// and without the parameters, which is nil for bodyless requests, and also
+// exposes it through BodyFromCtx. Failures are reported as a
+// *ValidationError.
+func (s *Schema) ValidateRequest(c *fiber.Ctx) (any, error) {
+	doc := s.document()
+	params := extractParameters(c, doc)
+	c.Locals("request_params", params)
+	var data any
+	var violations []Violation
+	body := c.Body()
+	if len(body) > 0 {
+		encoding := bodyEncoding(c)
+		var err error
+		data, violations, err = decodeBody(c, doc, encoding)
+		if err != nil {
+			verr := &ValidationError{
+				Status: fiber.StatusBadRequest,
+				Violations: []Violation{{
+					In:       LocationBody,
+					Keyword:  "syntax",
+					Expected: encodingNames[encoding],
+					Actual:   err.Error(),
+				}},
+			}
+			localizeViolations(c, verr.Violations)
+			return nil, verr
+		}
+	}
+	if len(body) == 0 {
+		if !params.declared() && !requiresBody(doc, params) {
+			return nil, nil
+		}
+		data = map[string]any{}
+	}
+	if obj, ok := data.(map[string]any); ok {
+		for name, val := range params.values {
+			obj[name] = val
+		}
+		applyDefaults(doc, obj)
+		params.collect(obj)
 	}
-	key := method + ":" + uri
-	AddSchema(key, s)
+	violations = append(violations, validateDocument(doc, data, LocationBody)...)
+	if len(violations) > 0 {
+		localizeViolations(c, violations)
+		return nil, &ValidationError{Status: fiber.StatusUnprocessableEntity, Violations: violations}
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	data = params.without(data)
+	c.Locals("request_body", data)
+	return data, nil
+}
+
+// encodingNames describe body encodings in syntax violations.
+var encodingNames = map[string]string{
+	EncodingJSON:      "JSON",
+	EncodingForm:      "form data",
+	EncodingMultipart: "multipart form data",
+	EncodingXML:       "XML",
+}
+
+// RouteOption configures a route when it is added.
+type RouteOption func(*Route)
+
+// WithRequestSchema attaches a compiled request schema to the route.
+func WithRequestSchema(schema *Schema) RouteOption {
+	return func(r *Route) {
+		r.RequestSchema = schema
+	}
+}
+
+// updateRoute replaces a registered route with a copy updated by fn, see
+// Route.clone. It reports whether the route was found.
+func (dr *Router) updateRoute(method, path string, fn func(route *Route)) bool {
+	method = strings.ToUpper(method)
+	v, ok := dr.table().routes.Load(method)
+	if !ok {
+		return false
+	}
+	mr := v.(*methodRoutes)
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if route, exists := mr.exact[path]; exists {
+		route = route.clone()
+		fn(route)
+		mr.exact[path] = route
+		return true
+	}
+	for i, route := range mr.params {
+		if route.Path == path {
+			route = route.clone()
+			fn(route)
+			mr.params[i] = route
+			return true
+		}
+	}
+	return false
+}
+
+// SetSchema attaches a compiled request schema to an existing route.
+func (dr *Router) SetSchema(method, path string, schema *Schema) error {
+	found := dr.updateRoute(method, path, func(route *Route) {
+		route.RequestSchema = schema
+	})
+	if !found {
+		return fmt.Errorf("route %s %s not found", strings.ToUpper(method), path)
+	}
+	log.Info().Str("method", method).Str("path", path).Msg("Set request schema for route")
+	return nil
+}
+
+// RemoveSchema detaches the request schema from an existing route.
+func (dr *Router) RemoveSchema(method, path string) error {
+	found := dr.updateRoute(method, path, func(route *Route) {
+		route.RequestSchema = nil
+	})
+	if !found {
+		return fmt.Errorf("route %s %s not found", strings.ToUpper(method), path)
+	}
+	log.Info().Str("method", method).Str("path", path).Msg("Removed request schema from route")
+	return nil
+}
+
+// Schemas returns the request schemas of all routes keyed by "METHOD path".
+func (dr *Router) Schemas() map[string]*Schema {
+	schemas := make(map[string]*Schema)
+	dr.table().routes.Range(func(key, value any) bool {
+		mr := value.(*methodRoutes)
+		mr.mu.RLock()
+		for _, route := range mr.exact {
+			if route.RequestSchema != nil {
+				schemas[route.Method+" "+route.Path] = route.RequestSchema
+			}
+		}
+		for _, route := range mr.params {
+			if route.RequestSchema != nil {
+				schemas[route.Method+" "+route.Path] = route.RequestSchema
+			}
+		}
+		mr.mu.RUnlock()
+		return true
+	})
+	return schemas
 }
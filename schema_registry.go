@@ -0,0 +1,501 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/oarkflow/json"
+	"github.com/oarkflow/log"
+)
+
+// SchemaRegistry holds JSON schema documents loaded from files and resolves
+// "$ref"s between them. Schemas compiled through the registry are bundled
+// with every document they reference and are recompiled in place when one
+// of those documents is reloaded.
+type SchemaRegistry struct {
+	mu sync.RWMutex
+	// docs maps canonical IDs to documents.
+	docs map[string]*registryDoc
+	// aliases maps file paths relative to their loaded directory to IDs.
+	aliases map[string]string
+	// files maps absolute file paths to IDs.
+	files map[string]string
+	dirs  []string
+	// tracked maps the sources of the schemas compiled through the registry
+	// to their last compilation.
+	tracked map[string]*trackedSchema
+}
+
+// registryDoc is a schema document known to the registry.
+type registryDoc struct {
+	id   string
+	file string
+	doc  any
+}
+
+// trackedSchema is a schema compiled through the registry, recompiled when
+// any document it depends on changes.
+type trackedSchema struct {
+	schema *Schema
+	source string
+	raw    json.RawMessage
+	deps   map[string]bool
+}
+
+// NewSchemaRegistry creates an empty schema registry.
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{
+		docs:    make(map[string]*registryDoc),
+		aliases: make(map[string]string),
+		files:   make(map[string]string),
+		tracked: make(map[string]*trackedSchema),
+	}
+}
+
+// LoadDir loads every .json file below dir. Each document is registered
+// under its "$id", or under its path relative to dir when it has none, and
+// can be referenced by either. All references are checked once the
+// directory is loaded.
+func (r *SchemaRegistry) LoadDir(dir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	var files []string
+	err = filepath.WalkDir(absDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), ".json") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("schema registry: %w", err)
+	}
+	r.mu.Lock()
+	if r.dirFor(absDir+string(filepath.Separator)) == "" {
+		r.dirs = append(r.dirs, absDir)
+	}
+	for _, file := range files {
+		if err := r.register(absDir, file); err != nil {
+			r.mu.Unlock()
+			return err
+		}
+	}
+	r.mu.Unlock()
+	if err := r.Check(); err != nil {
+		return err
+	}
+	log.Info().Str("dir", absDir).Int("count", len(files)).Msg("Loaded schema directory")
+	return nil
+}
+
+// LoadFile loads or reloads a single schema file and recompiles every
+// schema that depends on it. The file must be inside a directory loaded
+// with LoadDir.
+func (r *SchemaRegistry) LoadFile(file string) error {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	dir := r.dirFor(absFile)
+	if dir == "" {
+		r.mu.Unlock()
+		return fmt.Errorf("schema registry: %s is not inside a loaded directory", absFile)
+	}
+	oldID := r.files[absFile]
+	if err := r.register(dir, absFile); err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	newID := r.files[absFile]
+	if oldID != "" && oldID != newID {
+		delete(r.docs, oldID)
+	}
+	d := r.docs[newID]
+	_, _, err = r.bundle(d.doc, d.id, d.file)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	log.Info().Str("file", absFile).Str("id", newID).Msg("Reloaded schema file")
+	return r.recompile(oldID, newID)
+}
+
+// RemoveFile forgets a schema file. Schemas depending on it keep their last
+// compiled version and an error lists the ones that can no longer compile.
+func (r *SchemaRegistry) RemoveFile(file string) error {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	id, ok := r.files[absFile]
+	if ok {
+		delete(r.files, absFile)
+		delete(r.docs, id)
+		for alias, target := range r.aliases {
+			if target == id {
+				delete(r.aliases, alias)
+			}
+		}
+	}
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	log.Info().Str("file", absFile).Str("id", id).Msg("Removed schema file")
+	return r.recompile(id)
+}
+
+// register parses file and stores it. The caller holds r.mu.
+func (r *SchemaRegistry) register(dir, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("schema registry: %w", err)
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("schema registry: %s: invalid JSON: %w", file, err)
+	}
+	rel, err := filepath.Rel(dir, file)
+	if err != nil {
+		return fmt.Errorf("schema registry: %w", err)
+	}
+	rel = filepath.ToSlash(rel)
+	id := rel
+	if obj, ok := doc.(map[string]any); ok {
+		if s, ok := obj["$id"].(string); ok && s != "" {
+			id = s
+		}
+	}
+	if existing, ok := r.docs[id]; ok && existing.file != file {
+		return fmt.Errorf("schema registry: %s: $id %q is already defined by %s", file, id, existing.file)
+	}
+	r.docs[id] = &registryDoc{id: id, file: file, doc: doc}
+	r.aliases[rel] = id
+	r.files[file] = id
+	return nil
+}
+
+// dirFor returns the loaded directory containing file. The caller holds r.mu.
+func (r *SchemaRegistry) dirFor(file string) string {
+	for _, dir := range r.dirs {
+		if strings.HasPrefix(file, dir+string(filepath.Separator)) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// Check resolves the references of every registered document and reports
+// the first unresolved one.
+func (r *SchemaRegistry) Check() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := make([]string, 0, len(r.docs))
+	for id := range r.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		d := r.docs[id]
+		if _, _, err := r.bundle(d.doc, d.id, d.file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compile compiles a schema whose "$ref"s may point at registered documents.
+// source names the schema in error messages and must identify it, e.g. the
+// file it was read from and its place in the file. The returned schema is recompiled when a document it references is
+// reloaded. Compiling the same document from the same source again updates
+// and returns the schema compiled first; compiling another document from a
+// source replaces the schema tracked for it.
+func (r *SchemaRegistry) Compile(source string, raw json.RawMessage) (*Schema, error) {
+	schema, deps, err := r.compile(source, raw)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.tracked[source]; ok && bytes.Equal(t.raw, raw) {
+		t.schema.replace(schema)
+		t.deps = deps
+		return t.schema, nil
+	}
+	r.tracked[source] = &trackedSchema{schema: schema, source: source, raw: raw, deps: deps}
+	return schema, nil
+}
+
+// CompileID compiles a registered document by its "$id" or relative path.
+func (r *SchemaRegistry) CompileID(id string) (*Schema, error) {
+	r.mu.RLock()
+	d, ok := r.lookup(id)
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("schema registry: unknown schema %q", id)
+	}
+	raw, err := json.Marshal(map[string]any{"$ref": d.id})
+	if err != nil {
+		return nil, err
+	}
+	return r.Compile(d.file, raw)
+}
+
+// compile bundles raw with the documents it references and compiles it.
+func (r *SchemaRegistry) compile(source string, raw json.RawMessage) (*Schema, map[string]bool, error) {
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, nil, fmt.Errorf("%s: invalid JSON: %w", source, err)
+	}
+	base := ""
+	if obj, ok := doc.(map[string]any); ok {
+		base, _ = obj["$id"].(string)
+	}
+	r.mu.RLock()
+	bundled, deps, err := r.bundle(doc, base, source)
+	r.mu.RUnlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := json.Marshal(bundled)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", source, err)
+	}
+	schema, err := CompileSchema(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", source, err)
+	}
+	return schema, deps, nil
+}
+
+// recompile rebuilds every tracked schema depending on one of ids.
+func (r *SchemaRegistry) recompile(ids ...string) error {
+	r.mu.RLock()
+	var affected []*trackedSchema
+	for _, t := range r.tracked {
+		for _, id := range ids {
+			if id != "" && t.deps[id] {
+				affected = append(affected, t)
+				break
+			}
+		}
+	}
+	r.mu.RUnlock()
+	var errs []error
+	for _, t := range affected {
+		schema, deps, err := r.compile(t.source, t.raw)
+		if err != nil {
+			log.Error().Err(err).Str("source", t.source).Msg("Failed to recompile dependent schema")
+			errs = append(errs, err)
+			continue
+		}
+		t.schema.replace(schema)
+		r.mu.Lock()
+		t.deps = deps
+		r.mu.Unlock()
+		log.Info().Str("source", t.source).Msg("Recompiled dependent schema")
+	}
+	return errors.Join(errs...)
+}
+
+// lookup finds a document by ID or alias. The caller holds r.mu.
+func (r *SchemaRegistry) lookup(id string) (*registryDoc, bool) {
+	if d, ok := r.docs[id]; ok {
+		return d, true
+	}
+	if alias, ok := r.aliases[strings.TrimPrefix(id, "./")]; ok {
+		d, ok := r.docs[alias]
+		return d, ok
+	}
+	return nil, false
+}
+
+// resolve finds the document a reference points at, relative to base.
+// The caller holds r.mu.
+func (r *SchemaRegistry) resolve(base, ref string) (*registryDoc, bool) {
+	if baseURL, err := url.Parse(base); err == nil && base != "" {
+		if refURL, err := url.Parse(ref); err == nil {
+			if d, ok := r.lookup(baseURL.ResolveReference(refURL).String()); ok {
+				return d, true
+			}
+		}
+	}
+	return r.lookup(ref)
+}
+
+// bundle returns a copy of doc in which every reference to another document
+// points into "$defs", where the referenced documents are embedded. It
+// returns the IDs of all documents pulled in. The caller holds r.mu.
+func (r *SchemaRegistry) bundle(doc any, base, source string) (any, map[string]bool, error) {
+	defs := map[string]any{}
+	deps := map[string]bool{}
+	var rewrite func(node any, base, source, prefix string) (any, error)
+	rewrite = func(node any, base, source, prefix string) (any, error) {
+		switch val := node.(type) {
+		case map[string]any:
+			out := make(map[string]any, len(val))
+			for key, item := range val {
+				ref, isRef := item.(string)
+				if key != "$ref" || !isRef {
+					rewritten, err := rewrite(item, base, source, prefix)
+					if err != nil {
+						return nil, err
+					}
+					out[key] = rewritten
+					continue
+				}
+				if strings.HasPrefix(ref, "#") {
+					out[key] = prefix + ref[1:]
+					continue
+				}
+				target, fragment, _ := strings.Cut(ref, "#")
+				d, ok := r.resolve(base, target)
+				if !ok {
+					return nil, fmt.Errorf("%s: unresolved $ref %q", source, ref)
+				}
+				if fragment != "" {
+					if _, ok := resolvePointer(d.doc, "#"+fragment); !ok {
+						return nil, fmt.Errorf("%s: $ref %q: %s not found in %s", source, ref, fragment, d.file)
+					}
+				}
+				defPrefix := "#/$defs/" + escapePointer(d.id)
+				if !deps[d.id] {
+					deps[d.id] = true
+					embedded, err := rewrite(d.doc, d.id, d.file, defPrefix)
+					if err != nil {
+						return nil, err
+					}
+					if obj, ok := embedded.(map[string]any); ok {
+						delete(obj, "$id")
+						delete(obj, "$schema")
+					}
+					defs[d.id] = embedded
+				}
+				out[key] = defPrefix + fragment
+			}
+			return out, nil
+		case []any:
+			out := make([]any, len(val))
+			for i, item := range val {
+				rewritten, err := rewrite(item, base, source, prefix)
+				if err != nil {
+					return nil, err
+				}
+				out[i] = rewritten
+			}
+			return out, nil
+		default:
+			return node, nil
+		}
+	}
+	out, err := rewrite(doc, base, source, "#")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(defs) == 0 {
+		return out, deps, nil
+	}
+	obj, ok := out.(map[string]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: a schema with external references must be an object", source)
+	}
+	rootDefs, _ := obj["$defs"].(map[string]any)
+	if rootDefs == nil {
+		rootDefs = map[string]any{}
+	}
+	for id, def := range defs {
+		rootDefs[id] = def
+	}
+	obj["$defs"] = rootDefs
+	return obj, deps, nil
+}
+
+// Watch reloads schema files of the loaded directories when they change on
+// disk, recompiling dependent schemas. Call the returned function to stop.
+func (r *SchemaRegistry) Watch() (func() error, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	dirs := append([]string(nil), r.dirs...)
+	r.mu.RUnlock()
+	for _, dir := range dirs {
+		if err := r.watchTree(watcher, dir, false); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Create) {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						if err := r.watchTree(watcher, event.Name, true); err != nil {
+							log.Error().Err(err).Str("dir", event.Name).Msg("Schema directory watch failed")
+						}
+						continue
+					}
+				}
+				if !strings.HasSuffix(event.Name, ".json") {
+					continue
+				}
+				var err error
+				switch {
+				case event.Has(fsnotify.Write) || event.Has(fsnotify.Create):
+					err = r.LoadFile(event.Name)
+				case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+					err = r.RemoveFile(event.Name)
+				}
+				if err != nil {
+					log.Error().Err(err).Str("file", event.Name).Msg("Schema reload failed")
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Error().Err(err).Msg("Schema watcher error")
+			}
+		}
+	}()
+	return watcher.Close, nil
+}
+
+// watchTree watches dir and its subdirectories. The schema files found are
+// loaded when load is set, as a directory created while watching may have
+// been filled before it was watched.
+func (r *SchemaRegistry) watchTree(watcher *fsnotify.Watcher, dir string, load bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+		if load && strings.HasSuffix(path, ".json") {
+			if err := r.LoadFile(path); err != nil {
+				log.Error().Err(err).Str("file", path).Msg("Schema reload failed")
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,168 @@
+package router
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/oarkflow/json"
+)
+
+func TestSchemaRegistryTracksBySource(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "user.json"), []byte(`{"type": "object"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewSchemaRegistry()
+	if err := r.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	raw := []byte(`{"$ref": "user.json"}`)
+	first, err := r.Compile("api.json#/users", raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := r.Compile("api.json#/users", raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first {
+		t.Errorf("compiling the same document from the same source returned a new schema")
+	}
+	if _, err := r.Compile("api.json#/users", []byte(`{"type": "string"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.tracked) != 1 {
+		t.Errorf("tracked schemas = %d, want 1", len(r.tracked))
+	}
+
+	// The schema compiled first is no longer tracked, the last one is.
+	tracked := r.tracked["api.json#/users"]
+	if tracked.schema == first || len(tracked.deps) != 0 {
+		t.Errorf("tracked schema not replaced: %+v", tracked)
+	}
+}
+
+func TestSchemaRegistryRecompilesDependents(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "user.json")
+	if err := os.WriteFile(file, []byte(`{"type": "object"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewSchemaRegistry()
+	if err := r.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := r.Compile("api.json#/users", []byte(`{"$ref": "user.json"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(`{"type": "object", "required": ["name"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(schema.Source), `"required"`) {
+		t.Errorf("schema not recompiled after its dependency changed: %s", schema.Source)
+	}
+}
+
+func TestManifestRoutesSharingReference(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "user.json")
+	if err := os.WriteFile(file, []byte(`{"type": "object"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewSchemaRegistry()
+	if err := r.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	dr := New(fiber.New())
+	m := Manifest{Routes: []RouteConfig{
+		{RouteMethod: "POST", RouteURI: "/a", HandlerKey: "ok", Schema: json.RawMessage(`{"$ref": "user.json"}`)},
+		{RouteMethod: "POST", RouteURI: "/b", HandlerKey: "ok", Schema: json.RawMessage(`{"$ref": "user.json", "title": "B"}`)},
+	}}
+	if err := dr.LoadManifest("api.json", m, HandlerRegistry{"ok": text("ok")}, r); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(`{"type": "object", "required": ["name"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadFile(file); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/a", "/b"} {
+		route, _, _ := dr.MatchRoute(fiber.MethodPost, path)
+		if !strings.Contains(string(route.RequestSchema.Source), `"required"`) {
+			t.Errorf("POST %s: schema not recompiled after its dependency changed", path)
+		}
+	}
+}
+
+func TestSchemaRegistryWatchesNewDirectories(t *testing.T) {
+	dir := t.TempDir()
+	r := NewSchemaRegistry()
+	if err := r.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	stop, err := r.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	sub := filepath.Join(dir, "defs", "nested")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "name.json"), []byte(`{"type": "string"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := r.Compile("api.json#name", []byte(`{"$ref": "defs/nested/name.json"}`)); err == nil {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("schema in a new directory not loaded: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestDiffWhileRecompiling is meant for the race detector.
+func TestDiffWhileRecompiling(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "user.json")
+	if err := os.WriteFile(file, []byte(`{"type": "object"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewSchemaRegistry()
+	if err := r.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := r.Compile("api.json#users", []byte(`{"$ref": "user.json"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr := New(fiber.New())
+	dr.AddRouteWithOptions(fiber.MethodPost, "/users", text("ok"), []RouteOption{WithRequestSchema(schema)})
+	staged := dr.Stage()
+	staged.AddRouteWithOptions(fiber.MethodPost, "/users", text("ok"), []RouteOption{WithRequestSchema(schema)})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if err := r.LoadFile(file); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		dr.Diff(staged)
+	}
+	<-done
+}
@@ -0,0 +1,200 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/oarkflow/log"
+)
+
+// routeTable holds the dynamic and static routes served by a router. Swap
+// replaces it as a whole.
+type routeTable struct {
+	routes sync.Map // key: string (HTTP method) -> *methodRoutes
+	static []Static
+}
+
+// table returns the routes currently served.
+func (dr *Router) table() *routeTable {
+	return dr.current.Load()
+}
+
+// Stage returns a detached router with an empty route table and the
+// configuration of dr: global middlewares, not-found handler, response
+// validation and static routes. Routes added to it, directly, through its
+// groups or with LoadManifest, are not served until Swap is called, so a
+// new set of routes can be built and checked while dr keeps serving the
+// old one. The staged router must not be used after it was swapped in.
+func (dr *Router) Stage() *Router {
+	staged := &Router{
+		app:               dr.app,
+		GlobalMiddlewares: dr.GlobalMiddlewares,
+		NotFoundHandler:   dr.NotFoundHandler,
+		staticCache:       make(map[string]staticCacheEntry),
+	}
+	staged.responseValidation.Store(dr.responseValidation.Load())
+	current := dr.table()
+	staged.current.Store(&routeTable{static: append([]Static(nil), current.static...)})
+	return staged
+}
+
+// ErrRoutesSwapped is returned when restoring routes that were swapped out
+// since by another Swap.
+var ErrRoutesSwapped = errors.New("routes were replaced by another swap")
+
+// Swap atomically replaces the routes served by dr with the routes of a
+// router returned by Stage. Requests in flight finish on the routes they
+// started with. The returned function swaps the previous routes back in,
+// unless another Swap replaced the routes since, in which case it leaves
+// them and returns ErrRoutesSwapped.
+func (dr *Router) Swap(staged *Router) (restore func() error) {
+	table := staged.table()
+	count := 0
+	table.routes.Range(func(_, value any) bool {
+		mr := value.(*methodRoutes)
+		mr.mu.Lock()
+		for _, route := range mr.exact {
+			route.router = dr
+		}
+		for _, route := range mr.params {
+			route.router = dr
+		}
+		count += len(mr.exact) + len(mr.params)
+		mr.mu.Unlock()
+		return true
+	})
+	previous := dr.current.Swap(table)
+	log.Info().Int("routes", count).Msg("Swapped route table")
+	return func() error {
+		if !dr.current.CompareAndSwap(table, previous) {
+			return ErrRoutesSwapped
+		}
+		log.Info().Msg("Restored previous route table")
+		return nil
+	}
+}
+
+// RouteChange is a route served by two route tables with a different
+// configuration.
+type RouteChange struct {
+	Route string `json:"route"`
+	// Fields names what differs, e.g. "handler" or "request_schema".
+	Fields []string `json:"fields"`
+}
+
+// RouteDiff is the difference between two route tables. Routes are named
+// "METHOD path".
+type RouteDiff struct {
+	Added   []string      `json:"added"`
+	Removed []string      `json:"removed"`
+	Changed []RouteChange `json:"changed"`
+}
+
+// routeMap returns the dynamic routes of a table by "METHOD path".
+func (t *routeTable) routeMap() map[string]*Route {
+	routes := make(map[string]*Route)
+	t.routes.Range(func(key, value any) bool {
+		mr := value.(*methodRoutes)
+		mr.mu.RLock()
+		for _, route := range mr.exact {
+			routes[key.(string)+" "+route.Path] = route
+		}
+		for _, route := range mr.params {
+			routes[key.(string)+" "+route.Path] = route
+		}
+		mr.mu.RUnlock()
+		return true
+	})
+	return routes
+}
+
+// Diff returns the dynamic routes that swapping staged in would add, remove
+// or change. Handlers and middlewares are compared by function, so a
+// handler built by a closure is only reported as changed when the function
+// it is built from changes, or when the configuration recorded with
+// WithConfig does.
+func (dr *Router) Diff(staged *Router) RouteDiff {
+	live, next := dr.table().routeMap(), staged.table().routeMap()
+	diff := RouteDiff{Added: []string{}, Removed: []string{}, Changed: []RouteChange{}}
+	for key, route := range next {
+		old, ok := live[key]
+		if !ok {
+			diff.Added = append(diff.Added, key)
+			continue
+		}
+		if fields := routeChanges(old, route); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, RouteChange{Route: key, Fields: fields})
+		}
+	}
+	for key := range live {
+		if _, ok := next[key]; !ok {
+			diff.Removed = append(diff.Removed, key)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Route < diff.Changed[j].Route })
+	return diff
+}
+
+// WithConfig records the configuration a route was built from, e.g. its
+// RouteConfig or TemplateConfig. Handlers built from a configuration are
+// closures of the same function, so Diff compares the configuration to
+// report such a route as changed.
+func WithConfig(config any) RouteOption {
+	return func(r *Route) {
+		r.config = config
+	}
+}
+
+// routeChanges names the fields that differ between two routes.
+func routeChanges(a, b *Route) []string {
+	var fields []string
+	if funcID(a.Handler) != funcID(b.Handler) {
+		fields = append(fields, "handler")
+	}
+	if !reflect.DeepEqual(a.config, b.config) {
+		fields = append(fields, "config")
+	}
+	if !slices.EqualFunc(a.Middlewares, b.Middlewares, func(x, y middlewareEntry) bool { return x.id == y.id }) {
+		fields = append(fields, "middlewares")
+	}
+	if !schemaEqual(a.RequestSchema, b.RequestSchema) {
+		fields = append(fields, "request_schema")
+	}
+	if !maps.EqualFunc(a.ResponseSchemas, b.ResponseSchemas, schemaEqual) {
+		fields = append(fields, "response_schemas")
+	}
+	if a.Summary != b.Summary || a.Description != b.Description || a.OperationID != b.OperationID ||
+		!slices.Equal(a.Tags, b.Tags) || a.Hidden != b.Hidden {
+		fields = append(fields, "documentation")
+	}
+	if a.Layout != b.Layout || !slices.Equal(a.Formats, b.Formats) || a.NormalizeBody != b.NormalizeBody {
+		fields = append(fields, "rendering")
+	}
+	return fields
+}
+
+// funcID identifies a function by its code pointer.
+func funcID(h fiber.Handler) uintptr {
+	if h == nil {
+		return 0
+	}
+	return reflect.ValueOf(h).Pointer()
+}
+
+// schemaEqual reports whether two schemas were compiled from the same
+// document.
+func schemaEqual(a, b *Schema) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return bytes.Equal(a.source(), b.source())
+}
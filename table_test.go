@@ -0,0 +1,119 @@
+package router
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func text(s string) fiber.Handler {
+	return func(c *fiber.Ctx) error { return c.SendString(s) }
+}
+
+func get(t *testing.T, app *fiber.App, path string) (int, string) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestStageAndSwap(t *testing.T) {
+	app := fiber.New()
+	dr := New(app)
+	dr.AddRoute(fiber.MethodGet, "/old", text("old"))
+
+	staged := dr.Stage()
+	staged.AddRoute(fiber.MethodGet, "/new", text("new"))
+	if status, _ := get(t, app, "/new"); status != fiber.StatusNotFound {
+		t.Errorf("staged route served before Swap: status %d", status)
+	}
+
+	restore := dr.Swap(staged)
+	if status, body := get(t, app, "/new"); status != fiber.StatusOK || body != "new" {
+		t.Errorf("GET /new after Swap = %d %q", status, body)
+	}
+	if status, _ := get(t, app, "/old"); status != fiber.StatusNotFound {
+		t.Errorf("replaced route still served after Swap: status %d", status)
+	}
+
+	if err := restore(); err != nil {
+		t.Fatal(err)
+	}
+	if status, body := get(t, app, "/old"); status != fiber.StatusOK || body != "old" {
+		t.Errorf("GET /old after restore = %d %q", status, body)
+	}
+}
+
+func TestSwapRestoreAfterAnotherSwap(t *testing.T) {
+	dr := New(fiber.New())
+	first := dr.Stage()
+	first.AddRoute(fiber.MethodGet, "/a", text("a"))
+	restore := dr.Swap(first)
+	second := dr.Stage()
+	second.AddRoute(fiber.MethodGet, "/b", text("b"))
+	dr.Swap(second)
+
+	if err := restore(); !errors.Is(err, ErrRoutesSwapped) {
+		t.Errorf("restore after another swap: err = %v, want %v", err, ErrRoutesSwapped)
+	}
+	if _, ok := dr.table().routeMap()["GET /b"]; !ok {
+		t.Errorf("restore replaced the routes of the later swap")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dr := New(fiber.New())
+	same := text("same")
+	changed := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) }
+	dr.AddRoute(fiber.MethodGet, "/same", same)
+	dr.AddRoute(fiber.MethodGet, "/changed", same)
+	dr.AddRoute(fiber.MethodGet, "/removed", same)
+
+	staged := dr.Stage()
+	staged.AddRoute(fiber.MethodGet, "/same", same)
+	staged.AddRoute(fiber.MethodGet, "/changed", changed)
+	staged.AddRoute(fiber.MethodPost, "/added", same)
+
+	diff := dr.Diff(staged)
+	if !slices.Equal(diff.Added, []string{"POST /added"}) {
+		t.Errorf("added = %v", diff.Added)
+	}
+	if !slices.Equal(diff.Removed, []string{"GET /removed"}) {
+		t.Errorf("removed = %v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Route != "GET /changed" || !slices.Equal(diff.Changed[0].Fields, []string{"handler"}) {
+		t.Errorf("changed = %+v", diff.Changed)
+	}
+}
+
+func TestDiffTemplateRouteConfig(t *testing.T) {
+	page := func(status int, title string) Manifest {
+		return Manifest{Routes: []RouteConfig{
+			{RouteMethod: "GET", RouteURI: "/page", Kind: HandlerKindTemplate, Template: &TemplateConfig{
+				Template: "page", Status: status, Data: map[string]any{"title": title},
+			}},
+			{RouteMethod: "GET", RouteURI: "/about", Kind: HandlerKindTemplate, Template: &TemplateConfig{Template: "about"}},
+		}}
+	}
+	dr := New(fiber.New())
+	if err := dr.LoadManifest("pages.json", page(200, "Home"), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []Manifest{page(201, "Home"), page(200, "Start")} {
+		staged := dr.Stage()
+		if err := staged.LoadManifest("pages.json", m, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		diff := dr.Diff(staged)
+		if len(diff.Changed) != 1 || diff.Changed[0].Route != "GET /page" || !slices.Equal(diff.Changed[0].Fields, []string{"config"}) {
+			t.Errorf("changed = %+v", diff.Changed)
+		}
+	}
+}
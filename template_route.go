@@ -0,0 +1,166 @@
+package router
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandlerKindTemplate is the route config kind served by TemplateConfig.
+const HandlerKindTemplate = "template"
+
+// TemplateConfig declares a route that renders a template, so that pages
+// can be added from configuration without handler code.
+type TemplateConfig struct {
+	// Template is the name of the template to render.
+	Template string `json:"template"`
+	// Layout overrides the route, group and app layouts.
+	Layout string `json:"layout,omitempty"`
+	// Data is passed to the template as is.
+	Data map[string]any `json:"data,omitempty"`
+	// Params, Query and Locals map template data keys to the path
+	// parameter, query key or context local they are read from. An empty
+	// source name means the same name as the key.
+	Params map[string]string `json:"params,omitempty"`
+	Query  map[string]string `json:"query,omitempty"`
+	Locals map[string]string `json:"locals,omitempty"`
+	// Status is the response status. Default: 200
+	Status int `json:"status,omitempty"`
+	// Headers are set on every response.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Cache sets the Cache-Control policy and ETag handling.
+	Cache *CachePolicy `json:"cache,omitempty"`
+}
+
+// CachePolicy describes the caching of a rendered response.
+type CachePolicy struct {
+	// MaxAge is the max-age in seconds.
+	MaxAge int `json:"max_age,omitempty"`
+	// StaleWhileRevalidate is the stale-while-revalidate window in seconds.
+	StaleWhileRevalidate int  `json:"stale_while_revalidate,omitempty"`
+	Public               bool `json:"public,omitempty"`
+	Private              bool `json:"private,omitempty"`
+	NoCache              bool `json:"no_cache,omitempty"`
+	NoStore              bool `json:"no_store,omitempty"`
+	Immutable            bool `json:"immutable,omitempty"`
+	// ETag adds a weak ETag computed from the rendered body and answers
+	// matching If-None-Match requests with 304.
+	ETag bool `json:"etag,omitempty"`
+}
+
+// CacheControl returns the Cache-Control header value of the policy.
+func (p CachePolicy) CacheControl() string {
+	var parts []string
+	if p.Public {
+		parts = append(parts, "public")
+	}
+	if p.Private {
+		parts = append(parts, "private")
+	}
+	if p.NoCache {
+		parts = append(parts, "no-cache")
+	}
+	if p.NoStore {
+		parts = append(parts, "no-store")
+	}
+	if p.MaxAge > 0 {
+		parts = append(parts, "max-age="+strconv.Itoa(p.MaxAge))
+	}
+	if p.StaleWhileRevalidate > 0 {
+		parts = append(parts, "stale-while-revalidate="+strconv.Itoa(p.StaleWhileRevalidate))
+	}
+	if p.Immutable {
+		parts = append(parts, "immutable")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Validate reports configuration errors.
+func (t TemplateConfig) Validate() error {
+	if t.Template == "" {
+		return fmt.Errorf("template route: template name is required")
+	}
+	if t.Status != 0 && (t.Status < 100 || t.Status > 599) {
+		return fmt.Errorf("template route %s: invalid status %d", t.Template, t.Status)
+	}
+	return nil
+}
+
+// Handler returns the handler rendering the template through Render.
+func (t TemplateConfig) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		bind := make(fiber.Map, len(t.Data)+len(t.Params)+len(t.Query)+len(t.Locals))
+		for key, val := range t.Data {
+			bind[key] = val
+		}
+		params, _ := c.Locals("params").(map[string]string)
+		for key, name := range t.Params {
+			if val, ok := params[sourceName(key, name)]; ok {
+				bind[key] = val
+			}
+		}
+		for key, name := range t.Query {
+			if val := c.Query(sourceName(key, name)); val != "" {
+				bind[key] = val
+			}
+		}
+		for key, name := range t.Locals {
+			if val := c.Locals(sourceName(key, name)); val != nil {
+				bind[key] = val
+			}
+		}
+		for key, val := range t.Headers {
+			c.Set(key, val)
+		}
+		if t.Cache != nil {
+			if cc := t.Cache.CacheControl(); cc != "" {
+				c.Set(fiber.HeaderCacheControl, cc)
+			}
+		}
+		var layouts []string
+		if t.Layout != "" {
+			layouts = []string{t.Layout}
+		}
+		if t.Status != 0 {
+			c.Status(t.Status)
+		}
+		if err := Render(c, t.Template, bind, layouts...); err != nil {
+			return err
+		}
+		if t.Cache != nil && t.Cache.ETag {
+			h := fnv.New64a()
+			h.Write(c.Response().Body())
+			etag := `W/"` + strconv.FormatUint(h.Sum64(), 36) + `"`
+			c.Set(fiber.HeaderETag, etag)
+			if etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag) {
+				c.Context().ResetBody()
+				return c.SendStatus(fiber.StatusNotModified)
+			}
+		}
+		return nil
+	}
+}
+
+// etagMatches reports whether an If-None-Match header matches etag. The
+// header is a comma-separated list of entity tags or "*", compared weakly
+// as RFC 9110 requires for If-None-Match.
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag != "" && strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func sourceName(key, name string) string {
+	if name == "" {
+		return key
+	}
+	return name
+}
@@ -0,0 +1,95 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// dataViews render "name[layouts]:key=value,..." from the sorted bind map.
+type dataViews struct{}
+
+func (dataViews) Load() error { return nil }
+
+func (dataViews) Render(w io.Writer, name string, bind any, layouts ...string) error {
+	var pairs []string
+	for key, val := range bind.(fiber.Map) {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, val))
+	}
+	sort.Strings(pairs)
+	_, err := fmt.Fprintf(w, "%s%v:%s", name, layouts, strings.Join(pairs, ","))
+	return err
+}
+
+func TestTemplateRoute(t *testing.T) {
+	app := fiber.New(fiber.Config{Views: dataViews{}})
+	dr := New(app)
+	page := TemplateConfig{
+		Template: "page",
+		Layout:   "main",
+		Data:     map[string]any{"site": "docs"},
+		Params:   map[string]string{"slug": ""},
+		Query:    map[string]string{"lang": "l"},
+		Status:   fiber.StatusAccepted,
+		Headers:  map[string]string{"X-Page": "yes"},
+		Cache:    &CachePolicy{Public: true, MaxAge: 60},
+	}
+	dr.AddRoute(fiber.MethodGet, "/pages/:slug", page.Handler())
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/pages/intro?l=en", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if want := "page[main]:lang=en,site=docs,slug=intro"; string(body) != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+	if resp.StatusCode != fiber.StatusAccepted {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusAccepted)
+	}
+	if got := resp.Header.Get("X-Page"); got != "yes" {
+		t.Errorf("X-Page = %q, want yes", got)
+	}
+	if got := resp.Header.Get(fiber.HeaderCacheControl); got != "public, max-age=60" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+}
+
+func TestTemplateRouteNotModified(t *testing.T) {
+	app := fiber.New(fiber.Config{Views: dataViews{}})
+	dr := New(app)
+	dr.AddRoute(fiber.MethodGet, "/", TemplateConfig{Template: "index", Cache: &CachePolicy{ETag: true}}.Handler())
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := resp.Header.Get(fiber.HeaderETag)
+	if resp.StatusCode != fiber.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("GET / = %d with ETag %q", resp.StatusCode, etag)
+	}
+	for header, status := range map[string]int{
+		etag:                           fiber.StatusNotModified,
+		strings.TrimPrefix(etag, "W/"): fiber.StatusNotModified,
+		`"other", ` + etag:             fiber.StatusNotModified,
+		"*":                            fiber.StatusNotModified,
+		`"other"`:                      fiber.StatusOK,
+	} {
+		req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		req.Header.Set(fiber.HeaderIfNoneMatch, header)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != status {
+			t.Errorf("If-None-Match %s: status = %d, want %d", header, resp.StatusCode, status)
+		}
+		if status == fiber.StatusNotModified && len(body) > 0 {
+			t.Errorf("If-None-Match %s: 304 with body %q", header, body)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package router
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Parameter locations reported in Violation.In.
+const (
+	LocationBody   = "body"
+	LocationQuery  = "query"
+	LocationPath   = "path"
+	LocationHeader = "header"
+	LocationCookie = "cookie"
+)
+
+// Violation describes a single schema violation in a request.
+type Violation struct {
+	// Pointer is the JSON pointer of the offending value within its location.
+	Pointer string `json:"pointer"`
+	// In is the parameter location: body, query, path, header or cookie.
+	In string `json:"in"`
+	// Keyword is the schema keyword that failed, e.g. "required" or "minLength".
+	Keyword string `json:"keyword"`
+	// Expected is the value the keyword demanded.
+	Expected any `json:"expected,omitempty"`
+	// Actual is the value found in the request.
+	Actual any `json:"actual,omitempty"`
+	// Message is the localized, human-readable description.
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a request does not satisfy its schema.
+// The default ErrorHandler renders it with Status and the violation list.
+type ValidationError struct {
+	Status     int
+	Violations []Violation
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	if len(e.Violations) == 0 {
+		return "request validation failed"
+	}
+	first := e.Violations[0]
+	msg := fmt.Sprintf("request validation failed: %s %s: %s", first.In, first.Pointer, first.Keyword)
+	if len(e.Violations) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(e.Violations)-1)
+	}
+	return msg
+}
+
+// MessageCatalog produces the human-readable text of a violation.
+type MessageCatalog interface {
+	// Message returns the text for v in the first supported language of langs.
+	Message(langs []string, v Violation) string
+}
+
+// MessageTemplates is a MessageCatalog keyed by language tag and schema
+// keyword. Templates may reference {pointer}, {in}, {keyword}, {expected}
+// and {actual}. The "*" keyword is used when no template matches.
+type MessageTemplates map[string]map[string]string
+
+// DefaultLanguage is used when none of the requested languages is known.
+var DefaultLanguage = "en"
+
+// Message implements MessageCatalog.
+func (m MessageTemplates) Message(langs []string, v Violation) string {
+	candidates := make([]string, 0, len(langs)+1)
+	candidates = append(candidates, langs...)
+	candidates = append(candidates, DefaultLanguage)
+	for _, lang := range candidates {
+		templates, ok := m[lang]
+		if !ok {
+			continue
+		}
+		tmpl, ok := templates[v.Keyword]
+		if !ok {
+			tmpl, ok = templates["*"]
+		}
+		if ok {
+			return strings.NewReplacer(
+				"{pointer}", v.Pointer,
+				"{in}", v.In,
+				"{keyword}", v.Keyword,
+				"{expected}", formatMessageValue(v.Expected),
+				"{actual}", formatMessageValue(v.Actual),
+			).Replace(tmpl)
+		}
+	}
+	return v.Keyword + " validation failed"
+}
+
+// DefaultMessages is the built-in English message catalog.
+var DefaultMessages = MessageTemplates{
+	"en": {
+		"*":                    "is invalid",
+		"syntax":               "is not valid {expected}",
+		"false":                "is not allowed",
+		"type":                 "must be of type {expected}, got {actual}",
+		"required":             "is required",
+		"enum":                 "must be one of {expected}",
+		"const":                "must be equal to {expected}",
+		"minLength":            "must be at least {expected} characters long",
+		"maxLength":            "must be at most {expected} characters long",
+		"pattern":              "must match the pattern {expected}",
+		"format":               "must be a valid {expected}",
+		"minimum":              "must be greater than or equal to {expected}",
+		"maximum":              "must be less than or equal to {expected}",
+		"exclusiveMinimum":     "must be greater than {expected}",
+		"exclusiveMaximum":     "must be less than {expected}",
+		"multipleOf":           "must be a multiple of {expected}",
+		"minItems":             "must contain at least {expected} items",
+		"maxItems":             "must contain at most {expected} items",
+		"uniqueItems":          "must not contain duplicate items",
+		"minProperties":        "must contain at least {expected} properties",
+		"maxProperties":        "must contain at most {expected} properties",
+		"additionalProperties": "is not an allowed property",
+		"dependentRequired":    "is required when {expected} is present",
+		"anyOf":                "must match at least one of the allowed schemas",
+		"oneOf":                "must match exactly one of the allowed schemas",
+		"not":                  "must not match the disallowed schema",
+		"maxSize":              "must be at most {expected} bytes, got {actual}",
+		"minSize":              "must be at least {expected} bytes, got {actual}",
+		"contentMediaType":     "must be of media type {expected}, got {actual}",
+	},
+}
+
+// ValidationMessages is the catalog used to localize violations.
+// Replace it to translate or reword validation messages.
+var ValidationMessages MessageCatalog = DefaultMessages
+
+// localizeViolations fills in the Message of each violation using the
+// languages the client asked for in Accept-Language.
+func localizeViolations(c *fiber.Ctx, violations []Violation) {
+	langs := acceptedLanguages(c.Get(fiber.HeaderAcceptLanguage))
+	for i := range violations {
+		violations[i].Message = ValidationMessages.Message(langs, violations[i])
+	}
+}
+
+// acceptedLanguages returns the language tags of an Accept-Language header
+// ordered by preference. Each regional tag is followed by its base language.
+func acceptedLanguages(header string) []string {
+	type tag struct {
+		lang string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		if key, val, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(key) == "q" {
+			if f, err := strconv.ParseFloat(val, 64); err == nil {
+				q = f
+			}
+		}
+		if q <= 0 {
+			// q=0 marks a language the client refuses.
+			continue
+		}
+		tags = append(tags, tag{lang: strings.ToLower(lang), q: q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	langs := make([]string, 0, len(tags)*2)
+	for _, t := range tags {
+		langs = append(langs, t.lang)
+		if base, _, ok := strings.Cut(t.lang, "-"); ok {
+			langs = append(langs, base)
+		}
+	}
+	return langs
+}
+
+// normalizeLocation maps the "in" values accepted in schemas to the
+// locations reported in violations.
+func normalizeLocation(in string) string {
+	switch strings.ToLower(in) {
+	case "params", "param", "path":
+		return LocationPath
+	case "query":
+		return LocationQuery
+	case "header", "headers":
+		return LocationHeader
+	case "cookie", "cookies":
+		return LocationCookie
+	default:
+		return LocationBody
+	}
+}
+
+func formatMessageValue(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case []any:
+		parts := make([]string, len(val))
+		for i, item := range val {
+			parts[i] = formatMessageValue(item)
+		}
+		return strings.Join(parts, ", ")
+	case []string:
+		return strings.Join(val, ", ")
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// sendValidationError writes a ValidationError as a JSON error response.
+func sendValidationError(c *fiber.Ctx, err *ValidationError) error {
+	return c.Status(err.Status).JSON(map[string]any{
+		"success": false,
+		"message": "request validation failed",
+		"code":    err.Status,
+		"errors":  err.Violations,
+	})
+}
@@ -0,0 +1,699 @@
+package router
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// schemaValidator walks a decoded JSON schema document and records every
+// violation it finds instead of stopping at the first one.
+type schemaValidator struct {
+	root       any
+	in         string
+	violations []Violation
+}
+
+var patternCache sync.Map // map[string]*regexp.Regexp
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// validateDocument validates data against the schema document and returns
+// the violations found. Violations are attributed to the location in.
+func validateDocument(doc any, data any, in string) []Violation {
+	v := &schemaValidator{root: doc, in: in}
+	v.validate(doc, data, "")
+	return v.violations
+}
+
+func (v *schemaValidator) add(ptr, keyword string, expected, actual any) {
+	v.violations = append(v.violations, Violation{
+		Pointer:  ptr,
+		In:       v.in,
+		Keyword:  keyword,
+		Expected: expected,
+		Actual:   actual,
+	})
+}
+
+// matches reports whether data is valid against schema without recording
+// violations, as needed by anyOf, oneOf, not and if.
+func (v *schemaValidator) matches(schema any, data any, ptr string) bool {
+	sub := &schemaValidator{root: v.root, in: v.in}
+	sub.validate(schema, data, ptr)
+	return len(sub.violations) == 0
+}
+
+func (v *schemaValidator) validate(schema any, data any, ptr string) {
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			v.add(ptr, "false", nil, data)
+		}
+		return
+	case map[string]any:
+		v.validateObjectSchema(s, data, ptr)
+	}
+}
+
+func (v *schemaValidator) validateObjectSchema(s map[string]any, data any, ptr string) {
+	if ref, ok := s["$ref"].(string); ok {
+		if target, ok := resolvePointer(v.root, ref); ok {
+			v.validate(target, data, ptr)
+		}
+	}
+	if t, ok := s["type"]; ok {
+		types := schemaTypes(t)
+		if !matchesAnyType(types, data) {
+			var expected any = types
+			if len(types) == 1 {
+				expected = types[0]
+			}
+			v.add(ptr, "type", expected, jsonType(data))
+			return
+		}
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, candidate := range enum {
+			if jsonEqual(candidate, data) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.add(ptr, "enum", enum, data)
+		}
+	}
+	if c, ok := s["const"]; ok && !jsonEqual(c, data) {
+		v.add(ptr, "const", c, data)
+	}
+	switch d := data.(type) {
+	case string:
+		v.validateString(s, d, ptr)
+	case map[string]any:
+		v.validateObject(s, d, ptr)
+	case []any:
+		v.validateArray(s, d, ptr)
+	default:
+		if n, ok := toNumber(data); ok {
+			v.validateNumber(s, n, ptr)
+		}
+	}
+	if all, ok := s["allOf"].([]any); ok {
+		for _, sub := range all {
+			v.validate(sub, data, ptr)
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]any); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if v.matches(sub, data, ptr) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.add(ptr, "anyOf", len(anyOf), 0)
+		}
+	}
+	if oneOf, ok := s["oneOf"].([]any); ok {
+		count := 0
+		for _, sub := range oneOf {
+			if v.matches(sub, data, ptr) {
+				count++
+			}
+		}
+		if count != 1 {
+			v.add(ptr, "oneOf", 1, count)
+		}
+	}
+	if not, ok := s["not"]; ok && v.matches(not, data, ptr) {
+		v.add(ptr, "not", nil, data)
+	}
+	if cond, ok := s["if"]; ok {
+		if v.matches(cond, data, ptr) {
+			if then, ok := s["then"]; ok {
+				v.validate(then, data, ptr)
+			}
+		} else if els, ok := s["else"]; ok {
+			v.validate(els, data, ptr)
+		}
+	}
+}
+
+func (v *schemaValidator) validateString(s map[string]any, str string, ptr string) {
+	length := float64(utf8.RuneCountInString(str))
+	if min, ok := toNumber(s["minLength"]); ok && length < min {
+		v.add(ptr, "minLength", min, length)
+	}
+	if max, ok := toNumber(s["maxLength"]); ok && length > max {
+		v.add(ptr, "maxLength", max, length)
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		if re, err := compilePattern(pattern); err != nil || !re.MatchString(str) {
+			v.add(ptr, "pattern", pattern, str)
+		}
+	}
+	if format, ok := s["format"].(string); ok && !validFormat(format, str) {
+		v.add(ptr, "format", format, str)
+	}
+}
+
+func (v *schemaValidator) validateNumber(s map[string]any, n float64, ptr string) {
+	if min, ok := toNumber(s["minimum"]); ok && n < min {
+		v.add(ptr, "minimum", min, n)
+	}
+	if max, ok := toNumber(s["maximum"]); ok && n > max {
+		v.add(ptr, "maximum", max, n)
+	}
+	if min, ok := toNumber(s["exclusiveMinimum"]); ok && n <= min {
+		v.add(ptr, "exclusiveMinimum", min, n)
+	}
+	if max, ok := toNumber(s["exclusiveMaximum"]); ok && n >= max {
+		v.add(ptr, "exclusiveMaximum", max, n)
+	}
+	if m, ok := toNumber(s["multipleOf"]); ok && m > 0 {
+		if q := n / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.add(ptr, "multipleOf", m, n)
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(s map[string]any, obj map[string]any, ptr string) {
+	props, _ := s["properties"].(map[string]any)
+	if required, ok := s["required"].([]any); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, exists := obj[name]; !exists {
+				v.violations = append(v.violations, Violation{
+					Pointer:  ptr + "/" + escapePointer(name),
+					In:       v.propertyLocation(props[name]),
+					Keyword:  "required",
+					Expected: name,
+				})
+			}
+		}
+	}
+	if min, ok := toNumber(s["minProperties"]); ok && float64(len(obj)) < min {
+		v.add(ptr, "minProperties", min, len(obj))
+	}
+	if max, ok := toNumber(s["maxProperties"]); ok && float64(len(obj)) > max {
+		v.add(ptr, "maxProperties", max, len(obj))
+	}
+	if deps, ok := s["dependentRequired"].(map[string]any); ok {
+		for key, list := range deps {
+			if _, exists := obj[key]; !exists {
+				continue
+			}
+			names, _ := list.([]any)
+			for _, n := range names {
+				name, _ := n.(string)
+				if _, exists := obj[name]; !exists {
+					v.add(ptr+"/"+escapePointer(name), "dependentRequired", key, nil)
+				}
+			}
+		}
+	}
+	patterns, _ := s["patternProperties"].(map[string]any)
+	additional, hasAdditional := s["additionalProperties"]
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		val := obj[key]
+		childPtr := ptr + "/" + escapePointer(key)
+		evaluated := false
+		if propSchema, ok := props[key]; ok {
+			evaluated = true
+			v.validateProperty(propSchema, val, childPtr)
+		}
+		for pattern, patternSchema := range patterns {
+			if re, err := compilePattern(pattern); err == nil && re.MatchString(key) {
+				evaluated = true
+				v.validate(patternSchema, val, childPtr)
+			}
+		}
+		if evaluated || !hasAdditional {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok {
+			if !allowed {
+				v.add(childPtr, "additionalProperties", nil, key)
+			}
+			continue
+		}
+		v.validate(additional, val, childPtr)
+	}
+}
+
+// propertyLocation returns the parameter location declared by a property
+// schema's "in" keyword, defaulting to the validator's location.
+func (v *schemaValidator) propertyLocation(schema any) string {
+	if m, ok := schema.(map[string]any); ok {
+		if in, ok := m["in"].(string); ok && in != "" {
+			return normalizeLocation(in)
+		}
+	}
+	return v.in
+}
+
+// validateProperty validates a property value, attributing violations to
+// the parameter location declared by the property's "in" keyword.
+func (v *schemaValidator) validateProperty(schema any, val any, ptr string) {
+	in := v.propertyLocation(schema)
+	if in == v.in {
+		v.validate(schema, val, ptr)
+		return
+	}
+	sub := &schemaValidator{root: v.root, in: in}
+	sub.validate(schema, val, ptr)
+	v.violations = append(v.violations, sub.violations...)
+}
+
+func (v *schemaValidator) validateArray(s map[string]any, arr []any, ptr string) {
+	if min, ok := toNumber(s["minItems"]); ok && float64(len(arr)) < min {
+		v.add(ptr, "minItems", min, len(arr))
+	}
+	if max, ok := toNumber(s["maxItems"]); ok && float64(len(arr)) > max {
+		v.add(ptr, "maxItems", max, len(arr))
+	}
+	if unique, ok := s["uniqueItems"].(bool); ok && unique {
+		for i := 0; i < len(arr); i++ {
+			for j := i + 1; j < len(arr); j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					v.add(ptr+"/"+strconv.Itoa(j), "uniqueItems", true, arr[j])
+				}
+			}
+		}
+	}
+	items, hasItems := s["items"]
+	prefix, _ := s["prefixItems"].([]any)
+	if tuple, ok := items.([]any); ok {
+		// Before draft 2020-12, an items array validated positions.
+		prefix, hasItems = tuple, false
+	}
+	for i, sub := range prefix {
+		if i >= len(arr) {
+			break
+		}
+		v.validate(sub, arr[i], ptr+"/"+strconv.Itoa(i))
+	}
+	if hasItems {
+		for i := len(prefix); i < len(arr); i++ {
+			v.validate(items, arr[i], ptr+"/"+strconv.Itoa(i))
+		}
+	}
+}
+
+// applyDefaults fills in missing object properties that declare a default.
+func applyDefaults(schema any, data any) {
+	s, ok := schema.(map[string]any)
+	if !ok {
+		return
+	}
+	obj, ok := data.(map[string]any)
+	if !ok {
+		return
+	}
+	props, _ := s["properties"].(map[string]any)
+	for key, propSchema := range props {
+		ps, ok := propSchema.(map[string]any)
+		if !ok {
+			continue
+		}
+		if _, exists := obj[key]; !exists {
+			if def, ok := ps["default"]; ok {
+				obj[key] = def
+			}
+		}
+		if nested, ok := obj[key]; ok {
+			applyDefaults(ps, nested)
+		}
+	}
+}
+
+// resolvePointer resolves a local reference such as "#/$defs/name".
+func resolvePointer(root any, ref string) (any, bool) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, false
+	}
+	ref = strings.TrimPrefix(ref, "#")
+	if ref == "" {
+		return root, true
+	}
+	cur := root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "/"), "/") {
+		part = unescapePointer(part)
+		switch node := cur.(type) {
+		case map[string]any:
+			next, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			cur = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func unescapePointer(s string) string {
+	if decoded, err := url.PathUnescape(s); err == nil {
+		s = decoded
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+}
+
+func schemaTypes(t any) []string {
+	switch tv := t.(type) {
+	case string:
+		return []string{tv}
+	case []any:
+		types := make([]string, 0, len(tv))
+		for _, item := range tv {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func matchesAnyType(types []string, data any) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		switch t {
+		case "null":
+			if data == nil {
+				return true
+			}
+		case "boolean":
+			if _, ok := data.(bool); ok {
+				return true
+			}
+		case "object":
+			if _, ok := data.(map[string]any); ok {
+				return true
+			}
+		case "array":
+			if _, ok := data.([]any); ok {
+				return true
+			}
+		case "string":
+			if _, ok := data.(string); ok {
+				return true
+			}
+		case "number":
+			if _, ok := toNumber(data); ok {
+				return true
+			}
+		case "integer":
+			if n, ok := toNumber(data); ok && n == math.Trunc(n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON type name of a decoded value.
+func jsonType(data any) string {
+	switch d := data.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	default:
+		if n, ok := toNumber(d); ok {
+			if n == math.Trunc(n) {
+				return "integer"
+			}
+			return "number"
+		}
+		return fmt.Sprintf("%T", data)
+	}
+}
+
+func toNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case interface{ Float64() (float64, error) }:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// jsonEqual compares two decoded JSON values, treating numbers of
+// different Go types as equal when their values are equal.
+func jsonEqual(a, b any) bool {
+	if na, ok := toNumber(a); ok {
+		nb, ok := toNumber(b)
+		return ok && na == nb
+	}
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, val := range av {
+			if !jsonEqual(val, bv[k]) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compilePattern compiles a "pattern" or "patternProperties" regular
+// expression. Schemas are checked by checkDocument when compiled, so that
+// validation never meets a pattern that does not compile.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := patternCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(pattern, re)
+	return re, nil
+}
+
+// namedSchemas are the keywords whose values map names to schemas.
+var namedSchemas = map[string]bool{
+	"properties":        true,
+	"patternProperties": true,
+	"$defs":             true,
+	"definitions":       true,
+}
+
+// unsupportedKeywords are the validation keywords of JSON Schema the
+// validator does not apply. Schemas using them are rejected rather than
+// partly validated.
+var unsupportedKeywords = map[string]bool{
+	"additionalItems":       true,
+	"contains":              true,
+	"maxContains":           true,
+	"minContains":           true,
+	"dependencies":          true,
+	"dependentSchemas":      true,
+	"propertyNames":         true,
+	"unevaluatedItems":      true,
+	"unevaluatedProperties": true,
+	"$dynamicRef":           true,
+	"$recursiveRef":         true,
+}
+
+// jsonTypes are the type names accepted by the "type" keyword.
+var jsonTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true,
+	"string": true, "number": true, "integer": true,
+}
+
+// dataKeywords are the keywords whose values are instances rather than
+// schemas.
+var dataKeywords = map[string]bool{
+	"enum":     true,
+	"const":    true,
+	"default":  true,
+	"examples": true,
+	"example":  true,
+}
+
+// checkDocument compiles the patterns of a schema document, resolves its
+// references and rejects keywords the validator does not apply, so that a schema the validator cannot fully apply is rejected
+// when it is compiled instead of being partly skipped when validating.
+// References must point into the document itself; schemas referencing other
+// documents are compiled through a SchemaRegistry, which bundles them.
+func checkDocument(root any) error {
+	var check func(node any, ptr string) error
+	check = func(node any, ptr string) error {
+		switch n := node.(type) {
+		case []any:
+			for i, item := range n {
+				if err := check(item, ptr+"/"+strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+		case map[string]any:
+			for key, val := range n {
+				childPtr := ptr + "/" + escapePointer(key)
+				switch {
+				case dataKeywords[key]:
+					continue
+				case unsupportedKeywords[key]:
+					return fmt.Errorf("#%s: keyword %q is not supported", childPtr, key)
+				case key == "type":
+					types, ok := val.([]any)
+					if !ok {
+						types = []any{val}
+					}
+					for _, t := range types {
+						if name, _ := t.(string); !jsonTypes[name] {
+							return fmt.Errorf("#%s: invalid type %v", childPtr, t)
+						}
+					}
+					continue
+				case key == "$ref":
+					if ref, ok := val.(string); ok {
+						if _, ok := resolvePointer(root, ref); !ok {
+							return fmt.Errorf("#%s: unresolved $ref %q", childPtr, ref)
+						}
+						continue
+					}
+				case key == "pattern":
+					if pattern, ok := val.(string); ok {
+						if _, err := compilePattern(pattern); err != nil {
+							return fmt.Errorf("#%s: invalid pattern: %w", childPtr, err)
+						}
+						continue
+					}
+				case namedSchemas[key]:
+					if schemas, ok := val.(map[string]any); ok {
+						for name, schema := range schemas {
+							if key == "patternProperties" {
+								if _, err := compilePattern(name); err != nil {
+									return fmt.Errorf("#%s: invalid pattern: %w", childPtr, err)
+								}
+							}
+							if err := check(schema, childPtr+"/"+escapePointer(name)); err != nil {
+								return err
+							}
+						}
+						continue
+					}
+				}
+				if err := check(val, childPtr); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return check(root, "")
+}
+
+func validFormat(format, value string) bool {
+	switch format {
+	case "email":
+		_, err := mail.ParseAddress(value)
+		return err == nil
+	case "uri", "url":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != ""
+	case "uri-reference":
+		_, err := url.Parse(value)
+		return err == nil
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+	case "time":
+		_, err := time.Parse("15:04:05Z07:00", value)
+		if err != nil {
+			_, err = time.Parse(time.TimeOnly, value)
+		}
+		return err == nil
+	case "uuid":
+		return uuidPattern.MatchString(value)
+	case "ipv4":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil && strings.Contains(value, ".")
+	case "ipv6":
+		ip := net.ParseIP(value)
+		return ip != nil && strings.Contains(value, ":")
+	}
+	return true
+}
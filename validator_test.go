@@ -0,0 +1,154 @@
+package router
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/json"
+)
+
+func TestCompileSchemaRejectsUnusableSchemas(t *testing.T) {
+	for name, tc := range map[string]struct{ schema, err string }{
+		"pattern":           {`{"type": "string", "pattern": "(?=a)"}`, "invalid pattern"},
+		"patternProperties": {`{"patternProperties": {"[": {"type": "string"}}}`, "invalid pattern"},
+		"nested pattern":    {`{"properties": {"default": {"items": {"pattern": "("}}}}`, "invalid pattern"},
+		"local ref":         {`{"properties": {"user": {"$ref": "#/$defs/user"}}}`, "unresolved $ref"},
+		"external ref":      {`{"$ref": "user.json"}`, "unresolved $ref"},
+	} {
+		_, err := CompileSchema([]byte(tc.schema))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: CompileSchema error = %v, want %q", name, err, tc.err)
+		}
+	}
+	// Instances are not checked as schemas.
+	if _, err := CompileSchema([]byte(`{"enum": [{"$ref": "nowhere"}], "default": {"pattern": "("}}`)); err != nil {
+		t.Errorf("CompileSchema checked instances: %v", err)
+	}
+}
+
+func TestRegistrySchemaReferences(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "defs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"defs/name.json": `{"$id": "https://example.com/name.json", "$defs": {"name": {"type": "string", "pattern": "^[a-z]{3,}$"}}, "$ref": "#/$defs/name"}`,
+		"user.json":      `{"type": "object", "properties": {"name": {"$ref": "https://example.com/name.json"}, "alias": {"$ref": "defs/name.json#/$defs/name"}}}`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := NewSchemaRegistry()
+	if err := r.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := r.Compile("api.json#/users", []byte(`{"$ref": "user.json"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	violations := validateDocument(schema.document(), map[string]any{"name": "ab", "alias": "Bob"}, LocationBody)
+	var pointers []string
+	for _, v := range violations {
+		pointers = append(pointers, v.Pointer+" "+v.Keyword)
+	}
+	if got := strings.Join(pointers, ", "); got != "/alias pattern, /name pattern" {
+		t.Errorf("violations = %s", got)
+	}
+}
+
+func TestValidatorKeywords(t *testing.T) {
+	tests := []struct {
+		schema         string
+		valid, invalid string
+		keyword        string
+	}{
+		{`{"type": "integer"}`, `3`, `3.5`, "type"},
+		{`{"type": ["string", "null"]}`, `null`, `1`, "type"},
+		{`{"enum": ["a", 1]}`, `1`, `"b"`, "enum"},
+		{`{"const": {"a": 1}}`, `{"a": 1}`, `{"a": 2}`, "const"},
+		{`{"allOf": [{"minimum": 1}, {"maximum": 3}]}`, `2`, `4`, "maximum"},
+		{`{"anyOf": [{"type": "string"}, {"type": "integer"}]}`, `1`, `true`, "anyOf"},
+		{`{"oneOf": [{"minimum": 1}, {"maximum": 3}]}`, `5`, `2`, "oneOf"},
+		{`{"not": {"type": "string"}}`, `1`, `"a"`, "not"},
+		{`{"if": {"minimum": 10}, "then": {"multipleOf": 5}, "else": {"maximum": 3}}`, `15`, `4`, "maximum"},
+		{`{"minLength": 2, "maxLength": 3}`, `"ab"`, `"a"`, "minLength"},
+		{`{"maxLength": 3}`, `"äöü"`, `"abcd"`, "maxLength"},
+		{`{"pattern": "^[a-z]+$"}`, `"abc"`, `"aB"`, "pattern"},
+		{`{"format": "email"}`, `"a@example.com"`, `"a@"`, "format"},
+		{`{"format": "uri"}`, `"https://example.com"`, `"example.com"`, "format"},
+		{`{"format": "date-time"}`, `"2024-01-02T03:04:05Z"`, `"2024-01-02"`, "format"},
+		{`{"format": "date"}`, `"2024-01-02"`, `"2024-13-02"`, "format"},
+		{`{"format": "time"}`, `"03:04:05"`, `"25:00:00"`, "format"},
+		{`{"format": "uuid"}`, `"123e4567-e89b-12d3-a456-426614174000"`, `"123"`, "format"},
+		{`{"format": "ipv4"}`, `"10.0.0.1"`, `"::1"`, "format"},
+		{`{"format": "ipv6"}`, `"::1"`, `"10.0.0.1"`, "format"},
+		{`{"minimum": 1}`, `1`, `0`, "minimum"},
+		{`{"exclusiveMinimum": 1}`, `2`, `1`, "exclusiveMinimum"},
+		{`{"exclusiveMaximum": 1}`, `0`, `1`, "exclusiveMaximum"},
+		{`{"multipleOf": 0.5}`, `1.5`, `1.2`, "multipleOf"},
+		{`{"required": ["a"]}`, `{"a": 1}`, `{}`, "required"},
+		{`{"minProperties": 1}`, `{"a": 1}`, `{}`, "minProperties"},
+		{`{"maxProperties": 1}`, `{"a": 1}`, `{"a": 1, "b": 2}`, "maxProperties"},
+		{`{"dependentRequired": {"a": ["b"]}}`, `{"a": 1, "b": 2}`, `{"a": 1}`, "dependentRequired"},
+		{`{"properties": {"a": {"type": "string"}}}`, `{"a": "x"}`, `{"a": 1}`, "type"},
+		{`{"patternProperties": {"^x-": {"type": "string"}}}`, `{"x-a": "1"}`, `{"x-a": 1}`, "type"},
+		{`{"properties": {"a": true}, "additionalProperties": false}`, `{"a": 1}`, `{"b": 1}`, "additionalProperties"},
+		{`{"additionalProperties": {"type": "integer"}}`, `{"b": 1}`, `{"b": "1"}`, "type"},
+		{`{"minItems": 1}`, `[1]`, `[]`, "minItems"},
+		{`{"maxItems": 1}`, `[1]`, `[1, 2]`, "maxItems"},
+		{`{"uniqueItems": true}`, `[1, 2]`, `[1, 1]`, "uniqueItems"},
+		{`{"prefixItems": [{"type": "string"}], "items": {"type": "integer"}}`, `["a", 1]`, `["a", "b"]`, "type"},
+		{`{"items": [{"type": "string"}, {"type": "integer"}]}`, `["a", 1, true]`, `[1]`, "type"},
+		{`{"$defs": {"n": {"type": "integer"}}, "properties": {"a": {"$ref": "#/$defs/n"}}}`, `{"a": 1}`, `{"a": "x"}`, "type"},
+		{`false`, ``, `1`, "false"},
+	}
+	for _, tt := range tests {
+		schema, err := CompileSchema([]byte(tt.schema))
+		if err != nil {
+			t.Errorf("%s: %v", tt.schema, err)
+			continue
+		}
+		decode := func(s string) any {
+			var v any
+			if err := json.Unmarshal([]byte(s), &v); err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+		if tt.valid != "" {
+			if violations := validateDocument(schema.document(), decode(tt.valid), LocationBody); len(violations) > 0 {
+				t.Errorf("%s: %s rejected: %+v", tt.schema, tt.valid, violations)
+			}
+		}
+		violations := validateDocument(schema.document(), decode(tt.invalid), LocationBody)
+		if len(violations) == 0 || violations[0].Keyword != tt.keyword {
+			t.Errorf("%s: %s violations = %+v, want %s", tt.schema, tt.invalid, violations, tt.keyword)
+		}
+	}
+}
+
+func TestCompileSchemaRejectsUnsupportedKeywords(t *testing.T) {
+	for _, schema := range []string{
+		`{"type": "str"}`,
+		`{"type": ["string", 1]}`,
+		`{"contains": {"type": "string"}}`,
+		`{"properties": {"a": {"propertyNames": {"maxLength": 3}}}}`,
+		`{"unevaluatedProperties": false}`,
+	} {
+		if _, err := CompileSchema([]byte(schema)); err == nil {
+			t.Errorf("CompileSchema(%s) succeeded", schema)
+		}
+	}
+}
+
+func TestAcceptedLanguages(t *testing.T) {
+	got := acceptedLanguages("fr;q=0, de-CH;q=0.5, en, *;q=0.1")
+	if want := []string{"en", "de-ch", "de"}; !slices.Equal(got, want) {
+		t.Errorf("acceptedLanguages = %v, want %v", got, want)
+	}
+}
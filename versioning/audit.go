@@ -0,0 +1,148 @@
+package versioning
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/oarkflow/json"
+	"github.com/oarkflow/log"
+)
+
+// Audit actions.
+const (
+	AuditFileUpdate     = "file.update"
+	AuditFileRename     = "file.rename"
+	AuditFileRestore    = "file.restore"
+	AuditCommitCreate   = "commit.create"
+	AuditCommitRevert   = "commit.revert"
+	AuditMergeConflict  = "merge.conflict"
+	AuditMergeResolve   = "merge.resolve"
+	AuditMergeAbort     = "merge.abort"
+	AuditVersionCreate  = "version.create"
+	AuditVersionApprove = "version.approve"
+	AuditVersionImport  = "version.import"
+	AuditBranchCreate   = "branch.create"
+	AuditBranchDelete   = "branch.delete"
+	AuditBranchSwitch   = "branch.switch"
+	AuditStorageCompact = "storage.compact"
+	// Deployments are recorded as "version." followed by their action, see
+	// ActionDeploy, ActionPromote and ActionRollback.
+	AuditVersionDeploy   = "version." + ActionDeploy
+	AuditVersionPromote  = "version." + ActionPromote
+	AuditVersionRollback = "version." + ActionRollback
+)
+
+// AuditEntry records an action taken on the versioning state.
+type AuditEntry struct {
+	ID        int       `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	// Actor is the user who took the action, "" for the file watcher and
+	// unauthenticated requests.
+	Actor  string `json:"actor,omitempty"`
+	Action string `json:"action"`
+	// Targets identify what the action applies to, as "kind:id", such as
+	// "version:3", "commit:7", "branch:main", "environment:prod" or
+	// "file:api.json".
+	Targets []string `json:"targets,omitempty"`
+	// Before and After reference the state the action changed, such as the
+	// version running in an environment or the content hash of a file.
+	Before  string `json:"before,omitempty"`
+	After   string `json:"after,omitempty"`
+	Message string `json:"message"`
+}
+
+// UnmarshalJSON decodes an entry, or a message of the plain-text log of
+// earlier releases.
+func (e *AuditEntry) UnmarshalJSON(data []byte) error {
+	var message string
+	if err := json.Unmarshal(data, &message); err == nil {
+		*e = AuditEntry{Message: message}
+		return nil
+	}
+	type entry AuditEntry
+	return json.Unmarshal(data, (*entry)(e))
+}
+
+// auditRef returns the reference of an object in audit entries, as
+// "kind:id".
+func auditRef(kind string, id any) string {
+	return fmt.Sprintf("%s:%v", kind, id)
+}
+
+// versionRef returns the audit reference of a version, "" for 0.
+func versionRef(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return auditRef("version", id)
+}
+
+// record appends an entry to the audit log without persisting the state.
+func (vm *VersionManager) record(e AuditEntry) {
+	e.ID = vm.auditOffset + len(vm.AuditLog) + 1
+	e.Timestamp = time.Now()
+	vm.AuditLog = append(vm.AuditLog, e)
+	if n := vm.retention.AuditEntries; n > 0 && len(vm.AuditLog) > n {
+		drop := len(vm.AuditLog) - n
+		vm.AuditLog = append([]AuditEntry(nil), vm.AuditLog[drop:]...)
+		vm.auditOffset += drop
+	}
+}
+
+// audit appends an entry to the audit log and persists the state.
+func (vm *VersionManager) audit(e AuditEntry) {
+	vm.record(e)
+	if err := vm.persistState(); err != nil {
+		log.Error().Err(err).Msg("Failed to persist version state")
+	}
+}
+
+// AuditQuery filters the audit log. Zero fields match every entry.
+type AuditQuery struct {
+	Actor  string
+	Action string
+	// Target matches entries with this target, such as "version:3".
+	Target string
+	Since  time.Time
+	Until  time.Time
+	// After skips the entries up to this ID, to fetch the next page.
+	After int
+	// Limit is the maximum number of entries returned.
+	//
+	// Optional. Default: 50
+	Limit int
+}
+
+// AuditPage is a page of audit entries, oldest first.
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	// Next is the After of the next page, 0 on the last page.
+	Next int `json:"next,omitempty"`
+}
+
+// QueryAudit returns the audit entries matching q.
+func (vm *VersionManager) QueryAudit(q AuditQuery) AuditPage {
+	vm.RLock()
+	defer vm.RUnlock()
+	if q.Limit <= 0 {
+		q.Limit = 50
+	}
+	page := AuditPage{Entries: []AuditEntry{}}
+	for _, e := range vm.AuditLog {
+		if e.ID <= q.After ||
+			(q.Actor != "" && e.Actor != q.Actor) ||
+			(q.Action != "" && e.Action != q.Action) ||
+			(q.Target != "" && !slices.Contains(e.Targets, q.Target)) ||
+			(!q.Since.IsZero() && e.Timestamp.Before(q.Since)) ||
+			(!q.Until.IsZero() && e.Timestamp.After(q.Until)) {
+			continue
+		}
+		if len(page.Entries) == q.Limit {
+			page.Next = page.Entries[q.Limit-1].ID
+			break
+		}
+		page.Entries = append(page.Entries, e)
+	}
+	return page
+}
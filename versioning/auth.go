@@ -0,0 +1,311 @@
+package versioning
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/oarkflow/router"
+)
+
+// ErrUnauthorized is returned by an AuthProvider that rejects a request.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Role grants access to a set of endpoints of the HTTP API.
+type Role string
+
+const (
+	// RoleViewer reads changes, commits, versions, branches and the audit
+	// log. Every other role implies it.
+	RoleViewer Role = "viewer"
+	// RoleCommitter commits changes, merges them into versions and manages
+	// branches.
+	RoleCommitter Role = "committer"
+	// RoleApprover approves the promotion of versions.
+	RoleApprover Role = "approver"
+	// RoleDeployer deploys, promotes and rolls back versions.
+	RoleDeployer Role = "deployer"
+)
+
+// allRoles is granted when no roles are configured at all.
+var allRoles = []Role{RoleViewer, RoleCommitter, RoleApprover, RoleDeployer}
+
+// Identity is an authenticated user and the roles its credentials grant.
+type Identity struct {
+	User  string
+	Roles []Role
+}
+
+// AuthProvider authenticates requests to the HTTP API.
+type AuthProvider interface {
+	// Authenticate returns the identity of the user making the request, or
+	// an error if the request is not authenticated. It may set response
+	// headers such as WWW-Authenticate.
+	Authenticate(c *fiber.Ctx) (Identity, error)
+}
+
+// AuthFunc adapts a function to the AuthProvider interface.
+type AuthFunc func(c *fiber.Ctx) (Identity, error)
+
+// Authenticate implements AuthProvider.
+func (f AuthFunc) Authenticate(c *fiber.Ctx) (Identity, error) {
+	return f(c)
+}
+
+// WithRoles grants roles to users by name, on top of the roles their
+// credentials grant. When no roles are configured, neither here nor by the
+// AuthProvider, every authenticated user has every role.
+func WithRoles(roles map[string][]Role) Option {
+	return func(vm *VersionManager) {
+		vm.roles = roles
+	}
+}
+
+// BasicAuth authenticates requests with HTTP basic auth against a map of
+// user names to passwords.
+func BasicAuth(users map[string]string) AuthProvider {
+	return AuthFunc(func(c *fiber.Ctx) (Identity, error) {
+		user, pass, ok := parseBasicAuth(c.Get(fiber.HeaderAuthorization))
+		if ok {
+			if expected, known := users[user]; known && subtle.ConstantTimeCompare([]byte(pass), []byte(expected)) == 1 {
+				return Identity{User: user}, nil
+			}
+		}
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="Restricted"`)
+		return Identity{}, ErrUnauthorized
+	})
+}
+
+// HtpasswdFile authenticates requests with HTTP basic auth against an
+// htpasswd file. Passwords hashed with MD5 ("$apr1$", htpasswd -m) and SHA-1
+// ("{SHA}", htpasswd -s) are supported. The file is read once.
+func HtpasswdFile(path string) (AuthProvider, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hashes := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: missing ':'", path, n)
+		}
+		if !strings.HasPrefix(hash, "$apr1$") && !strings.HasPrefix(hash, "{SHA}") {
+			return nil, fmt.Errorf("%s:%d: unsupported hash for user %q, use htpasswd -m or -s", path, n, user)
+		}
+		hashes[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return AuthFunc(func(c *fiber.Ctx) (Identity, error) {
+		user, pass, ok := parseBasicAuth(c.Get(fiber.HeaderAuthorization))
+		if ok {
+			if hash, known := hashes[user]; known && checkHtpasswd(hash, pass) {
+				return Identity{User: user}, nil
+			}
+		}
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="Restricted"`)
+		return Identity{}, ErrUnauthorized
+	}), nil
+}
+
+// checkHtpasswd reports whether pass matches an htpasswd hash.
+func checkHtpasswd(hash, pass string) bool {
+	var computed string
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(pass))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+		computed = apr1(pass, salt)
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// apr1 hashes a password with the Apache variant of MD5-crypt.
+func apr1(password, salt string) string {
+	const magic = "$apr1$"
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+	ctx := md5.New()
+	ctx.Write(pw)
+	ctx.Write([]byte(magic + salt))
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+	for i := len(pw); i > 0; i -= 16 {
+		ctx.Write(altSum[:min(i, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	final := ctx.Sum(nil)
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write(pw)
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 != 0 {
+			round.Write(final)
+		} else {
+			round.Write(pw)
+		}
+		final = round.Sum(nil)
+	}
+	var out strings.Builder
+	to64 := func(v uint, n int) {
+		for ; n > 0; n-- {
+			out.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, idx := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		to64(uint(final[idx[0]])<<16|uint(final[idx[1]])<<8|uint(final[idx[2]]), 4)
+	}
+	to64(uint(final[11]), 2)
+	return magic + salt + "$" + out.String()
+}
+
+// APIKeys authenticates requests with the key of the X-API-Key header,
+// mapped to the identity it grants.
+func APIKeys(keys map[string]Identity) AuthProvider {
+	return AuthFunc(func(c *fiber.Ctx) (Identity, error) {
+		key := c.Get("X-API-Key")
+		if key == "" {
+			return Identity{}, ErrUnauthorized
+		}
+		// Compare with every key so that timing does not tell which
+		// prefix matched.
+		var found Identity
+		ok := false
+		for k, identity := range keys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+				found, ok = identity, true
+			}
+		}
+		if !ok {
+			return Identity{}, ErrUnauthorized
+		}
+		return found, nil
+	})
+}
+
+// BearerToken authenticates requests with the bearer token of the
+// Authorization header, checked by validate, e.g. against a JWT issuer or a
+// token introspection endpoint.
+func BearerToken(validate func(token string) (Identity, error)) AuthProvider {
+	return AuthFunc(func(c *fiber.Ctx) (Identity, error) {
+		header := c.Get(fiber.HeaderAuthorization)
+		if len(header) <= 7 || !strings.EqualFold(header[:7], "bearer ") {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="Restricted"`)
+			return Identity{}, ErrUnauthorized
+		}
+		identity, err := validate(strings.TrimSpace(header[7:]))
+		if err != nil {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="Restricted", error="invalid_token"`)
+			return Identity{}, ErrUnauthorized
+		}
+		return identity, nil
+	})
+}
+
+// AnyAuth authenticates requests with the first of providers that accepts
+// them, e.g. to accept API keys next to basic auth.
+func AnyAuth(providers ...AuthProvider) AuthProvider {
+	return AuthFunc(func(c *fiber.Ctx) (Identity, error) {
+		for _, p := range providers {
+			if identity, err := p.Authenticate(c); err == nil {
+				c.Response().Header.Del(fiber.HeaderWWWAuthenticate)
+				return identity, nil
+			}
+		}
+		return Identity{}, ErrUnauthorized
+	})
+}
+
+// parseBasicAuth extracts the credentials of a basic Authorization header.
+func parseBasicAuth(header string) (string, string, bool) {
+	if len(header) <= 6 || !strings.EqualFold(header[:6], "basic ") {
+		return "", "", false
+	}
+	raw, err := base64.StdEncoding.DecodeString(header[6:])
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(raw), ":")
+}
+
+// UserFromCtx returns the user authenticated for the request, or "" when
+// the API is opened with WithoutAuth.
+func UserFromCtx(c *fiber.Ctx) string {
+	user, _ := c.Locals("versioning_user").(string)
+	return user
+}
+
+// rolesOf returns the roles of an identity.
+func (vm *VersionManager) rolesOf(identity Identity) []Role {
+	if vm.roles == nil && len(identity.Roles) == 0 {
+		return allRoles
+	}
+	return append(slices.Clone(identity.Roles), vm.roles[identity.User]...)
+}
+
+// authorize returns a middleware authenticating requests with the
+// configured provider and requiring role. Any role grants RoleViewer.
+// Without a provider, requests are refused unless WithoutAuth is set.
+func (vm *VersionManager) authorize(role Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if vm.auth == nil {
+			if vm.noAuth {
+				return router.Next(c)
+			}
+			return c.Status(fiber.StatusUnauthorized).SendString("Unauthorized.")
+		}
+		identity, err := vm.auth.Authenticate(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).SendString("Unauthorized.")
+		}
+		roles := vm.rolesOf(identity)
+		if !slices.Contains(roles, role) && (role != RoleViewer || len(roles) == 0) {
+			return c.Status(fiber.StatusForbidden).SendString("Forbidden.")
+		}
+		c.Locals("versioning_user", identity.User)
+		return router.Next(c)
+	}
+}
@@ -0,0 +1,93 @@
+package versioning
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func authStatus(t *testing.T, vm *VersionManager, role Role, user, pass string) int {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/", vm.authorize(role))
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	if user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestAuthorize(t *testing.T) {
+	if got := authStatus(t, &VersionManager{}, RoleViewer, "", ""); got != fiber.StatusUnauthorized {
+		t.Errorf("without a provider: status %d, want %d", got, fiber.StatusUnauthorized)
+	}
+	if got := authStatus(t, &VersionManager{noAuth: true}, RoleDeployer, "", ""); got != fiber.StatusOK {
+		t.Errorf("WithoutAuth: status %d, want %d", got, fiber.StatusOK)
+	}
+	vm := &VersionManager{
+		auth:  BasicAuth(map[string]string{"alice": "secret", "bob": "secret"}),
+		roles: map[string][]Role{"alice": {RoleDeployer}, "bob": {RoleCommitter}},
+	}
+	tests := []struct {
+		user, pass string
+		role       Role
+		want       int
+	}{
+		{"alice", "wrong", RoleViewer, fiber.StatusUnauthorized},
+		{"alice", "secret", RoleDeployer, fiber.StatusOK},
+		{"alice", "secret", RoleViewer, fiber.StatusOK},
+		{"bob", "secret", RoleDeployer, fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := authStatus(t, vm, tt.role, tt.user, tt.pass); got != tt.want {
+			t.Errorf("%s/%s as %s: status %d, want %d", tt.user, tt.pass, tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestApr1(t *testing.T) {
+	// Vectors from the Apache documentation and "openssl passwd -apr1".
+	tests := []struct{ password, salt, want string }{
+		{"myPassword", "r31.....", "$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/"},
+		{"password", "saltsalt", "$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/"},
+	}
+	for _, tt := range tests {
+		if got := apr1(tt.password, tt.salt); got != tt.want {
+			t.Errorf("apr1(%q, %q) = %q, want %q", tt.password, tt.salt, got, tt.want)
+		}
+	}
+}
+
+func TestHtpasswdFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".htpasswd")
+	data := "# users\nalice:$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/\nbob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := HtpasswdFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := &VersionManager{auth: provider}
+	tests := []struct {
+		user, pass string
+		want       int
+	}{
+		{"alice", "myPassword", fiber.StatusOK},
+		{"alice", "password", fiber.StatusUnauthorized},
+		{"bob", "password", fiber.StatusOK},
+		{"carol", "password", fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := authStatus(t, vm, RoleViewer, tt.user, tt.pass); got != tt.want {
+			t.Errorf("%s/%s: status %d, want %d", tt.user, tt.pass, got, tt.want)
+		}
+	}
+}
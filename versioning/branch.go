@@ -0,0 +1,413 @@
+package versioning
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oarkflow/log"
+)
+
+// ErrBranchNotFound is returned when a branch does not exist.
+var ErrBranchNotFound = errors.New("branch not found")
+
+// Branch is a line of versions with its own working state. Versions of a
+// branch apply on top of the files it was created from; its commits are the
+// pending commits whose Branch is its name.
+type Branch struct {
+	Name    string    `json:"name"`
+	From    string    `json:"from,omitempty"`
+	Created time.Time `json:"created"`
+	// Base holds the files of From when the branch was created.
+	Base map[string]string `json:"base,omitempty"`
+	// MergeBases holds, per other branch, the files both branches had in
+	// common after they were last forked or merged. It is the base of the
+	// next merge between them.
+	MergeBases map[string]map[string]string `json:"mergeBases,omitempty"`
+	// LatestFiles, FileVersions and CommittedFiles hold the working state
+	// of the branch while it is not the current one. The working state of
+	// the current branch is held by the VersionManager.
+	LatestFiles    map[string]string        `json:"latestFiles,omitempty"`
+	FileVersions   map[string][]FileVersion `json:"fileVersions,omitempty"`
+	CommittedFiles map[string]string        `json:"committedFiles,omitempty"`
+}
+
+// BranchInfo describes a branch.
+type BranchInfo struct {
+	Name    string    `json:"name"`
+	From    string    `json:"from,omitempty"`
+	Created time.Time `json:"created"`
+	Current bool      `json:"current"`
+	// Version is the ID of the latest version of the branch, 0 if none.
+	Version int `json:"version,omitempty"`
+	Pending int `json:"pending"`
+}
+
+// ensureBranches registers the branches named by the state, for states
+// persisted before branches had their own working state.
+func (vm *VersionManager) ensureBranches() {
+	if vm.Branches == nil {
+		vm.Branches = make(map[string]*Branch)
+	}
+	if vm.DeletedBranches == nil {
+		vm.DeletedBranches = make(map[string]*Branch)
+	}
+	names := []string{vm.CurrentBranch}
+	for _, ver := range vm.Versions {
+		names = append(names, ver.Branch)
+	}
+	for _, commit := range vm.PendingCommits {
+		names = append(names, commit.Branch)
+	}
+	for _, name := range names {
+		if _, ok := vm.branch(name); !ok {
+			vm.Branches[name] = &Branch{Name: name, Created: time.Now()}
+		}
+	}
+}
+
+// branch returns a branch by name, deleted or not. Versions of a deleted
+// branch still apply on top of its Base.
+func (vm *VersionManager) branch(name string) (*Branch, bool) {
+	if b, ok := vm.Branches[name]; ok {
+		return b, true
+	}
+	b, ok := vm.DeletedBranches[name]
+	return b, ok
+}
+
+// branchFiles returns the files of a branch as of its versions with an ID
+// up to upTo, keyed by path. Deleted files are left out.
+func (vm *VersionManager) branchFiles(branch string, upTo int) map[string]string {
+	files := make(map[string]string)
+	if b, ok := vm.branch(branch); ok {
+		maps.Copy(files, b.Base)
+	}
+	var versions []VersionGroup
+	for _, v := range vm.Versions {
+		if v.Branch == branch && v.ID <= upTo {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].ID < versions[j].ID })
+	for _, v := range versions {
+		for path, fv := range v.Files {
+			if fv.Deleted {
+				delete(files, path)
+				continue
+			}
+			files[path] = fv.Content
+		}
+	}
+	return files
+}
+
+// head returns the files of the latest version of a branch.
+func (vm *VersionManager) head(branch string) map[string]string {
+	return vm.branchFiles(branch, vm.NextVerID)
+}
+
+// latestVersion returns the ID of the latest version of a branch, 0 if it
+// has none.
+func (vm *VersionManager) latestVersion(branch string) int {
+	id := 0
+	for _, v := range vm.Versions {
+		if v.Branch == branch && v.ID > id {
+			id = v.ID
+		}
+	}
+	return id
+}
+
+// Current returns the name of the current branch.
+func (vm *VersionManager) Current() string {
+	vm.RLock()
+	defer vm.RUnlock()
+	return vm.CurrentBranch
+}
+
+// ListBranches lists the branches, ordered by name.
+func (vm *VersionManager) ListBranches() []BranchInfo {
+	vm.RLock()
+	defer vm.RUnlock()
+	pending := make(map[string]int)
+	for _, commit := range vm.PendingCommits {
+		pending[commit.Branch]++
+	}
+	branches := make([]BranchInfo, 0, len(vm.Branches))
+	for name, b := range vm.Branches {
+		branches = append(branches, BranchInfo{
+			Name:    name,
+			From:    b.From,
+			Created: b.Created,
+			Current: name == vm.CurrentBranch,
+			Version: vm.latestVersion(name),
+			Pending: pending[name],
+		})
+	}
+	sort.Slice(branches, func(i, j int) bool { return branches[i].Name < branches[j].Name })
+	return branches
+}
+
+// CreateBranch creates a branch from the latest version of another one.
+// The new branch starts with a clean working state holding those files.
+func (vm *VersionManager) CreateBranch(name, from, actor string) error {
+	vm.Lock()
+	defer vm.Unlock()
+	if strings.TrimSpace(name) == "" {
+		return errors.New("branch name is empty")
+	}
+	if _, ok := vm.Branches[name]; ok {
+		return fmt.Errorf("branch '%s' already exists", name)
+	}
+	if _, ok := vm.DeletedBranches[name]; ok {
+		return fmt.Errorf("branch '%s' was deleted but its versions are kept", name)
+	}
+	source, ok := vm.Branches[from]
+	if !ok {
+		return fmt.Errorf("%w: '%s'", ErrBranchNotFound, from)
+	}
+	base := vm.head(from)
+	b := &Branch{
+		Name:           name,
+		From:           from,
+		Created:        time.Now(),
+		Base:           base,
+		MergeBases:     map[string]map[string]string{from: base},
+		LatestFiles:    maps.Clone(base),
+		FileVersions:   make(map[string][]FileVersion),
+		CommittedFiles: maps.Clone(base),
+	}
+	for file, content := range base {
+		b.FileVersions[file] = []FileVersion{{Timestamp: b.Created, Content: content}}
+	}
+	if source.MergeBases == nil {
+		source.MergeBases = make(map[string]map[string]string)
+	}
+	source.MergeBases[name] = base
+	vm.Branches[name] = b
+	vm.audit(AuditEntry{
+		Actor:   actor,
+		Action:  AuditBranchCreate,
+		Targets: []string{auditRef("branch", name), auditRef("branch", from)},
+		After:   versionRef(vm.latestVersion(from)),
+		Message: fmt.Sprintf("Created branch '%s' from '%s'", name, from),
+	})
+	log.Info().Str("branch", name).Str("from", from).Msg("Created branch")
+	return nil
+}
+
+// DeleteBranch deletes a branch and its pending commits. Its versions are
+// kept, with the files it was created from, so that they can still be
+// deployed, rolled back to and verified; its name cannot be reused then.
+// The current branch cannot be deleted.
+func (vm *VersionManager) DeleteBranch(name, actor string) error {
+	vm.Lock()
+	defer vm.Unlock()
+	if _, ok := vm.Branches[name]; !ok {
+		return fmt.Errorf("%w: '%s'", ErrBranchNotFound, name)
+	}
+	if name == vm.CurrentBranch {
+		return fmt.Errorf("cannot delete the current branch '%s'", name)
+	}
+	if vm.Merge != nil && (vm.Merge.Branch == name || vm.Merge.Source == name) {
+		return ErrMergeInProgress
+	}
+	var remaining []Commit
+	var dropped []int
+	for _, commit := range vm.PendingCommits {
+		if commit.Branch != name {
+			remaining = append(remaining, commit)
+		} else {
+			dropped = append(dropped, commit.ID)
+		}
+	}
+	vm.PendingCommits = remaining
+	if b := vm.Branches[name]; vm.latestVersion(name) != 0 {
+		vm.DeletedBranches[name] = &Branch{Name: b.Name, From: b.From, Created: b.Created, Base: b.Base}
+	}
+	delete(vm.Branches, name)
+	for _, b := range vm.Branches {
+		delete(b.MergeBases, name)
+	}
+	vm.audit(AuditEntry{
+		Actor:   actor,
+		Action:  AuditBranchDelete,
+		Targets: append([]string{auditRef("branch", name)}, commitTargets(dropped)...),
+		Before:  versionRef(vm.latestVersion(name)),
+		Message: fmt.Sprintf("Deleted branch '%s'", name),
+	})
+	log.Info().Str("branch", name).Msg("Deleted branch")
+	return nil
+}
+
+// SwitchBranch makes branch the current branch. The working state of the
+// previous branch is kept with it and the one of branch restored, so that
+// changes and commits do not leak between branches.
+func (vm *VersionManager) SwitchBranch(branch, actor string) error {
+	vm.Lock()
+	defer vm.Unlock()
+	target, ok := vm.Branches[branch]
+	if !ok {
+		return fmt.Errorf("%w: '%s'", ErrBranchNotFound, branch)
+	}
+	if branch == vm.CurrentBranch {
+		return nil
+	}
+	current := vm.Branches[vm.CurrentBranch]
+	current.LatestFiles = vm.LatestFiles
+	current.FileVersions = vm.FileVersions
+	current.CommittedFiles = vm.CommittedFiles
+	vm.LatestFiles = orEmpty(target.LatestFiles)
+	vm.FileVersions = target.FileVersions
+	if vm.FileVersions == nil {
+		vm.FileVersions = make(map[string][]FileVersion)
+	}
+	vm.CommittedFiles = orEmpty(target.CommittedFiles)
+	target.LatestFiles, target.FileVersions, target.CommittedFiles = nil, nil, nil
+	previous := vm.CurrentBranch
+	vm.CurrentBranch = branch
+	vm.audit(AuditEntry{
+		Actor:   actor,
+		Action:  AuditBranchSwitch,
+		Targets: []string{auditRef("branch", branch)},
+		Before:  auditRef("branch", previous),
+		After:   auditRef("branch", branch),
+		Message: fmt.Sprintf("Switched to branch '%s'", branch),
+	})
+	log.Info().Str("branch", branch).Msg("Switched branch")
+	return nil
+}
+
+// orEmpty returns m, or an empty map if m is nil.
+func orEmpty(m map[string]string) map[string]string {
+	if m == nil {
+		return make(map[string]string)
+	}
+	return m
+}
+
+// CompareBranches returns the diff from the latest version of branch from
+// to the one of branch to, per file that differs.
+func (vm *VersionManager) CompareBranches(from, to string) (map[string]string, error) {
+	vm.RLock()
+	defer vm.RUnlock()
+	for _, name := range []string{from, to} {
+		if _, ok := vm.Branches[name]; !ok {
+			return nil, fmt.Errorf("%w: '%s'", ErrBranchNotFound, name)
+		}
+	}
+	a, b := vm.head(from), vm.head(to)
+	changes := make(map[string]string)
+	for _, file := range unionKeys(a, b) {
+		if a[file] != b[file] {
+			changes[file] = diffText(a[file], b[file])
+		}
+	}
+	return changes, nil
+}
+
+// unionKeys returns the keys of both maps, sorted.
+func unionKeys(a, b map[string]string) []string {
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// mergeBase returns the files source and target had in common when they
+// were last forked or merged, or nil if they never were.
+func (vm *VersionManager) mergeBase(source, target string) map[string]string {
+	if base, ok := vm.Branches[target].MergeBases[source]; ok {
+		return base
+	}
+	return vm.Branches[source].MergeBases[target]
+}
+
+// MergeBranch merges the latest version of branch source into branch
+// target, as a new version of target. Files changed only on source are
+// taken, files changed on both are merged three-way against their content
+// when the branches were last forked or merged. Conflicts are handled as for
+// MergeCommits. The merge is recorded on behalf of actor.
+func (vm *VersionManager) MergeBranch(source, target, tag, actor string) (VersionGroup, error) {
+	vm.Lock()
+	defer vm.Unlock()
+	if vm.Merge != nil {
+		return VersionGroup{}, ErrMergeInProgress
+	}
+	for _, name := range []string{source, target} {
+		if _, ok := vm.Branches[name]; !ok {
+			return VersionGroup{}, fmt.Errorf("%w: '%s'", ErrBranchNotFound, name)
+		}
+	}
+	if source == target {
+		return VersionGroup{}, errors.New("cannot merge a branch into itself")
+	}
+	base := vm.mergeBase(source, target)
+	ours, theirs := vm.head(target), vm.head(source)
+	merge := &PendingMerge{
+		Tag:           tag,
+		Branch:        target,
+		Source:        source,
+		SourceVersion: vm.latestVersion(source),
+		Message:       fmt.Sprintf("Merge branch '%s' into '%s'", source, target),
+		Files:         make(map[string]*FileMerge),
+	}
+	next := 0
+	for _, file := range unionKeys(ours, theirs) {
+		b, inBase := base[file]
+		t, inTheirs := theirs[file]
+		if (t == b && inTheirs == inBase) || t == ours[file] {
+			continue
+		}
+		fm := mergeFile(file, b, ours[file], t, &next)
+		fm.Deleted = !inTheirs
+		merge.Files[file] = fm
+	}
+	if len(merge.Files) == 0 {
+		return VersionGroup{}, fmt.Errorf("branch '%s' has nothing to merge into '%s'", source, target)
+	}
+	if hunks := merge.Hunks(); len(hunks) > 0 {
+		vm.Merge = merge
+		vm.audit(AuditEntry{
+			Actor:   actor,
+			Action:  AuditMergeConflict,
+			Targets: []string{auditRef("branch", target), auditRef("branch", source)},
+			Message: fmt.Sprintf("Merge of branch '%s' into '%s' has %d conflicting hunks", source, target, len(hunks)),
+		})
+		log.Warn().Str("branch", target).Str("source", source).Int("hunks", len(hunks)).Msg("Merge conflict")
+		return VersionGroup{}, &ConflictError{Hunks: hunks}
+	}
+	return vm.completeMerge(merge, actor)
+}
+
+// recordBranchMerge makes the merged files the base of the next merge
+// between the branches of a completed branch merge.
+func (vm *VersionManager) recordBranchMerge(merge *PendingMerge) {
+	source, ok := vm.Branches[merge.Source]
+	if !ok {
+		return
+	}
+	target := vm.Branches[merge.Branch]
+	base := vm.branchFiles(merge.Source, merge.SourceVersion)
+	if source.MergeBases == nil {
+		source.MergeBases = make(map[string]map[string]string)
+	}
+	if target.MergeBases == nil {
+		target.MergeBases = make(map[string]map[string]string)
+	}
+	source.MergeBases[merge.Branch] = base
+	target.MergeBases[merge.Source] = base
+}
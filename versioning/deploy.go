@@ -0,0 +1,195 @@
+package versioning
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/oarkflow/log"
+
+	"github.com/oarkflow/router"
+)
+
+// Deployer applies a version to a deploy target.
+type Deployer interface {
+	// Deploy applies the files of ver, keyed by their path relative to the
+	// watch root, and returns a function undoing it. files holds the whole
+	// configuration set as of ver, not only the files ver changed. Deploy
+	// must leave the target untouched when it returns an error.
+	Deploy(ver VersionGroup, files map[string]string) (undo func() error, err error)
+}
+
+// DirDeployer writes versions to a directory.
+type DirDeployer struct {
+	// Dir is the directory replaced by each deploy. The previous contents
+	// are kept in Dir + "_backup" until the next deploy, to undo it.
+	Dir string
+}
+
+// Deploy stages the files into a temporary folder next to the directory,
+// then swaps it in place of the directory.
+func (d DirDeployer) Deploy(ver VersionGroup, files map[string]string) (func() error, error) {
+	target := filepath.Clean(d.Dir)
+	tempDir := target + "_temp"
+	backupDir := target + "_backup"
+	if err := os.RemoveAll(tempDir); err != nil {
+		return nil, fmt.Errorf("failed to clear temp folder: %v", err)
+	}
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create temp folder: %v", err)
+	}
+	for rel, content := range files {
+		destPath := filepath.Join(tempDir, rel)
+		destDir := filepath.Dir(destPath)
+		if err := os.MkdirAll(destDir, 0755); err != nil {
+			os.RemoveAll(tempDir)
+			return nil, fmt.Errorf("failed to create directory %s: %v", destDir, err)
+		}
+		if err := os.WriteFile(destPath, []byte(content), 0644); err != nil {
+			os.RemoveAll(tempDir)
+			return nil, fmt.Errorf("failed to write file %s: %v", destPath, err)
+		}
+	}
+	if err := os.RemoveAll(backupDir); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, fmt.Errorf("failed to clear backup folder: %v", err)
+	}
+	hadTarget := false
+	if _, err := os.Stat(target); err == nil {
+		if err := os.Rename(target, backupDir); err != nil {
+			os.RemoveAll(tempDir)
+			return nil, fmt.Errorf("failed to backup deploy folder: %v", err)
+		}
+		hadTarget = true
+	}
+	if err := os.Rename(tempDir, target); err != nil {
+		if hadTarget {
+			os.Rename(backupDir, target)
+		}
+		os.RemoveAll(tempDir)
+		return nil, fmt.Errorf("failed to deploy new version: %v", err)
+	}
+	log.Info().Int("version", ver.ID).Str("dir", target).Msg("Deployed version")
+	return func() error {
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+		if !hadTarget {
+			return nil
+		}
+		return os.Rename(backupDir, target)
+	}, nil
+}
+
+// RouterDeployer deploys versions to a live router. Routes are loaded into
+// a staged router, so that handler keys are resolved and schemas compiled
+// as a dry run, then swapped in atomically.
+type RouterDeployer struct {
+	Router *router.Router
+	// Load registers on staged every route the router should serve for the
+	// given files, as after Router.ClearRoutes, typically with
+	// Router.LoadManifest. Any error aborts the deploy and leaves the live
+	// routes untouched.
+	Load func(staged *router.Router, files map[string]string) error
+}
+
+// Deploy stages the routes of the files and swaps them in.
+func (d RouterDeployer) Deploy(ver VersionGroup, files map[string]string) (func() error, error) {
+	staged := d.Router.Stage()
+	if err := d.Load(staged, files); err != nil {
+		return nil, fmt.Errorf("stage version %d: %w", ver.ID, err)
+	}
+	restore := d.Router.Swap(staged)
+	log.Info().Int("version", ver.ID).Msg("Deployed version to router")
+	return restore, nil
+}
+
+// Plan stages the routes of the files and reports what swapping them in
+// would change, without swapping them in.
+func (d RouterDeployer) Plan(files map[string]string) (router.RouteDiff, error) {
+	staged := d.Router.Stage()
+	if err := d.Load(staged, files); err != nil {
+		return router.RouteDiff{}, fmt.Errorf("stage routes: %w", err)
+	}
+	return d.Router.Diff(staged), nil
+}
+
+// snapshot returns the configuration set as of ver: the files of its
+// branch up to ver, keyed by path relative to the watch root. Deleted files
+// are left out.
+func (vm *VersionManager) snapshot(ver VersionGroup) map[string]string {
+	all := vm.contentSet(ver)
+	files := make(map[string]string, len(all))
+	for path, content := range all {
+		files[vm.relPath(path)] = content
+	}
+	return files
+}
+
+// deploy checks the signature of ver and validates it, then applies it with
+// every deployer of env. When a deployer fails, the ones that already
+// succeeded are undone. The returned function undoes the whole deploy and
+// returns the errors of the deployers that could not undo it.
+func (vm *VersionManager) deploy(env Environment, ver VersionGroup) (func() error, error) {
+	if err := vm.checkSignature(ver); err != nil {
+		return nil, err
+	}
+	files := vm.snapshot(ver)
+	if err := vm.validate(files); err != nil {
+		return nil, fmt.Errorf("version %d: %w", ver.ID, err)
+	}
+	var undos []func() error
+	undo := func() error {
+		var errs []error
+		for i := len(undos) - 1; i >= 0; i-- {
+			if err := undos[i](); err != nil {
+				log.Error().Err(err).Int("version", ver.ID).Str("environment", env.Name).Msg("Failed to undo deploy")
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+	for _, d := range env.Deployers {
+		u, err := d.Deploy(ver, files)
+		if err != nil {
+			if uerr := undo(); uerr != nil {
+				return nil, fmt.Errorf("%w; undoing the deployers that succeeded failed: %w", err, uerr)
+			}
+			return nil, err
+		}
+		undos = append(undos, u)
+	}
+	return undo, nil
+}
+
+// deployAndUpdate deploys ver to env, then applies update to the state and
+// persists it. If persisting fails, the state is restored and the deploy
+// undone, so that the state always matches what is deployed.
+func (vm *VersionManager) deployAndUpdate(env Environment, ver VersionGroup, update func()) error {
+	undo, err := vm.deploy(env, ver)
+	if err != nil {
+		return err
+	}
+	previous := vm.state()
+	update()
+	if err := vm.persistState(); err != nil {
+		vm.restoreState(previous)
+		if uerr := undo(); uerr != nil {
+			return fmt.Errorf("deploy version %d could not be rolled back after %w: %w", ver.ID, err, uerr)
+		}
+		return fmt.Errorf("deploy version %d rolled back: %w", ver.ID, err)
+	}
+	return nil
+}
+
+// relPath returns the path of a watched file relative to the watch root
+// containing it.
+func (vm *VersionManager) relPath(path string) string {
+	for _, root := range vm.watchConfig.Roots {
+		if rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(path)); err == nil && filepath.IsLocal(rel) {
+			return rel
+		}
+	}
+	return filepath.Clean(path)
+}
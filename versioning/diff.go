@@ -0,0 +1,35 @@
+package versioning
+
+import (
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// formatDiff produces a unified diff string using diffmatchpatch.
+func formatDiff(diffs []diffmatchpatch.Diff) string {
+	var result strings.Builder
+	for _, d := range diffs {
+		prefix := " "
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			prefix = "+"
+		case diffmatchpatch.DiffDelete:
+			prefix = "-"
+		}
+		for _, line := range strings.Split(d.Text, "\n") {
+			if line != "" {
+				result.WriteString(prefix + line + "\n")
+			}
+		}
+	}
+	return result.String()
+}
+
+// diffText returns the diff between two contents.
+func diffText(from, to string) string {
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffMain(from, to, false)
+	dmp.DiffCleanupSemantic(diffs)
+	return formatDiff(diffs)
+}
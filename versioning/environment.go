@@ -0,0 +1,305 @@
+package versioning
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/oarkflow/log"
+)
+
+// ErrEnvironmentNotFound is returned when an environment is not configured.
+var ErrEnvironmentNotFound = errors.New("environment not found")
+
+// Environment is a deploy stage of the pipeline, such as dev, staging or
+// prod. Versions are deployed to the first environment and promoted from
+// one environment to the next, in the order they are configured.
+type Environment struct {
+	Name string
+	// Deployers apply versions to the environment, in order. If one fails,
+	// the others are undone.
+	Deployers []Deployer
+	// Approvals is the number of distinct users who must approve a version
+	// before it is promoted into the environment.
+	//
+	// Optional. Default: 0
+	Approvals int
+}
+
+// WithEnvironment adds an environment to the pipeline. Environments are
+// promoted in the order they are added. Without environments, versions are
+// deployed to a single "prod" environment made of the deployers added with
+// WithDeployer.
+func WithEnvironment(env Environment) Option {
+	return func(vm *VersionManager) {
+		vm.environments = append(vm.environments, env)
+	}
+}
+
+// Deployment is an entry of the deploy history of an environment.
+type Deployment struct {
+	VersionID int       `json:"versionId"`
+	Tag       string    `json:"tag,omitempty"`
+	Branch    string    `json:"branch"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Deployment actions.
+const (
+	ActionDeploy   = "deploy"
+	ActionPromote  = "promote"
+	ActionRollback = "rollback"
+)
+
+// EnvironmentState is the deploy state of an environment.
+type EnvironmentState struct {
+	// Current is the deployment running in the environment, nil if none.
+	Current *Deployment  `json:"current,omitempty"`
+	History []Deployment `json:"history,omitempty"`
+	// Approvals holds the users who approved the promotion of a version
+	// into the environment, by version ID.
+	Approvals map[int][]string `json:"approvals,omitempty"`
+}
+
+// EnvironmentStatus describes what runs in an environment.
+type EnvironmentStatus struct {
+	Name              string           `json:"name"`
+	Current           *Deployment      `json:"current,omitempty"`
+	ApprovalsRequired int              `json:"approvalsRequired,omitempty"`
+	Approvals         map[int][]string `json:"approvals,omitempty"`
+	// Next is the environment versions are promoted to from this one.
+	Next string `json:"next,omitempty"`
+}
+
+// environment returns the index of an environment.
+func (vm *VersionManager) environment(name string) (int, error) {
+	for i, env := range vm.environments {
+		if env.Name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: '%s'", ErrEnvironmentNotFound, name)
+}
+
+// envState returns the state of an environment, creating it if needed.
+func (vm *VersionManager) envState(name string) *EnvironmentState {
+	if vm.Environments == nil {
+		vm.Environments = make(map[string]*EnvironmentState)
+	}
+	st, ok := vm.Environments[name]
+	if !ok {
+		st = &EnvironmentState{}
+		vm.Environments[name] = st
+	}
+	return st
+}
+
+// versionByID returns a version of any branch.
+func (vm *VersionManager) versionByID(id int) (*VersionGroup, error) {
+	for i := range vm.Versions {
+		if vm.Versions[i].ID == id {
+			ver := vm.Versions[i]
+			return &ver, nil
+		}
+	}
+	return nil, fmt.Errorf("version %d not found", id)
+}
+
+// deployToEnv deploys ver to the environment at index i, records it in its
+// history and audit log, then applies update to the state and persists it.
+// The environment and the state are left untouched on failure.
+func (vm *VersionManager) deployToEnv(i int, ver VersionGroup, action, actor string, update func()) error {
+	env := vm.environments[i]
+	return vm.deployAndUpdate(env, ver, func() {
+		st := vm.envState(env.Name)
+		before := 0
+		if st.Current != nil {
+			before = st.Current.VersionID
+		}
+		d := Deployment{
+			VersionID: ver.ID,
+			Tag:       ver.Tag,
+			Branch:    ver.Branch,
+			Action:    action,
+			Actor:     actor,
+			Timestamp: time.Now(),
+		}
+		// Replace the state rather than updating it, so that restoring a
+		// previous state on failure restores the environment.
+		next := &EnvironmentState{
+			Current:   &d,
+			History:   append(slices.Clip(st.History), d),
+			Approvals: st.Approvals,
+		}
+		vm.Environments[env.Name] = next
+		if i == 0 {
+			vm.DeployedVersion = &ver
+		}
+		vm.record(AuditEntry{
+			Actor:   actor,
+			Action:  "version." + action,
+			Targets: []string{auditRef("version", ver.ID), auditRef("environment", env.Name), auditRef("branch", ver.Branch)},
+			Before:  versionRef(before),
+			After:   auditRef("version", ver.ID),
+			Message: fmt.Sprintf("%s of version %d to environment '%s' by %s", action, ver.ID, env.Name, actorName(actor)),
+		})
+		if update != nil {
+			update()
+		}
+	})
+}
+
+// EnvironmentStatuses returns what runs in each environment, in pipeline
+// order.
+func (vm *VersionManager) EnvironmentStatuses() []EnvironmentStatus {
+	vm.RLock()
+	defer vm.RUnlock()
+	statuses := make([]EnvironmentStatus, len(vm.environments))
+	for i, env := range vm.environments {
+		statuses[i] = EnvironmentStatus{Name: env.Name, ApprovalsRequired: env.Approvals}
+		if st, ok := vm.Environments[env.Name]; ok {
+			statuses[i].Current = st.Current
+			statuses[i].Approvals = st.Approvals
+		}
+		if i+1 < len(vm.environments) {
+			statuses[i].Next = vm.environments[i+1].Name
+		}
+	}
+	return statuses
+}
+
+// EnvironmentHistory returns the deploy history of an environment, oldest
+// first.
+func (vm *VersionManager) EnvironmentHistory(name string) ([]Deployment, error) {
+	vm.RLock()
+	defer vm.RUnlock()
+	if _, err := vm.environment(name); err != nil {
+		return nil, err
+	}
+	if st, ok := vm.Environments[name]; ok {
+		return append([]Deployment(nil), st.History...), nil
+	}
+	return []Deployment{}, nil
+}
+
+// Approve records the approval by actor of the promotion of a version into
+// an environment.
+func (vm *VersionManager) Approve(name string, versionID int, actor string) error {
+	vm.Lock()
+	defer vm.Unlock()
+	if _, err := vm.environment(name); err != nil {
+		return err
+	}
+	if _, err := vm.versionByID(versionID); err != nil {
+		return err
+	}
+	if actor == "" {
+		return errors.New("approvals require an authenticated user")
+	}
+	st := vm.envState(name)
+	if slices.Contains(st.Approvals[versionID], actor) {
+		return nil
+	}
+	if st.Approvals == nil {
+		st.Approvals = make(map[int][]string)
+	}
+	st.Approvals[versionID] = append(st.Approvals[versionID], actor)
+	vm.audit(AuditEntry{
+		Actor:   actor,
+		Action:  AuditVersionApprove,
+		Targets: []string{auditRef("version", versionID), auditRef("environment", name)},
+		Message: fmt.Sprintf("%s approved version %d for environment '%s'", actor, versionID, name),
+	})
+	log.Info().Str("environment", name).Int("version", versionID).Str("actor", actor).Msg("Approved version")
+	return nil
+}
+
+// Promote deploys the version running in an environment to the next one.
+// The version needs the approvals the next environment requires; they are
+// consumed by the promotion.
+func (vm *VersionManager) Promote(from, actor string) (*Deployment, error) {
+	vm.Lock()
+	defer vm.Unlock()
+	i, err := vm.environment(from)
+	if err != nil {
+		return nil, err
+	}
+	if i+1 >= len(vm.environments) {
+		return nil, fmt.Errorf("environment '%s' is the last of the pipeline", from)
+	}
+	current := vm.envState(from).Current
+	if current == nil {
+		return nil, fmt.Errorf("nothing is deployed to environment '%s'", from)
+	}
+	ver, err := vm.versionByID(current.VersionID)
+	if err != nil {
+		return nil, err
+	}
+	target := vm.environments[i+1]
+	approvals := vm.envState(target.Name).Approvals[ver.ID]
+	if len(approvals) < target.Approvals {
+		return nil, fmt.Errorf("version %d has %d of the %d approvals environment '%s' requires",
+			ver.ID, len(approvals), target.Approvals, target.Name)
+	}
+	err = vm.deployToEnv(i+1, *ver, ActionPromote, actor, func() {
+		st := vm.Environments[target.Name]
+		st.Approvals = maps.Clone(st.Approvals)
+		delete(st.Approvals, ver.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Int("version", ver.ID).Str("from", from).Str("to", target.Name).Msg("Promoted version")
+	return vm.Environments[target.Name].Current, nil
+}
+
+// RollbackEnvironment deploys to an environment a version it ran before:
+// the given one, or the one deployed before the current one when versionID
+// is 0.
+func (vm *VersionManager) RollbackEnvironment(name string, versionID int, actor string) (*Deployment, error) {
+	vm.Lock()
+	defer vm.Unlock()
+	i, err := vm.environment(name)
+	if err != nil {
+		return nil, err
+	}
+	st := vm.envState(name)
+	if st.Current == nil {
+		return nil, fmt.Errorf("nothing is deployed to environment '%s'", name)
+	}
+	if versionID == 0 {
+		for j := len(st.History) - 1; j >= 0; j-- {
+			if st.History[j].VersionID != st.Current.VersionID {
+				versionID = st.History[j].VersionID
+				break
+			}
+		}
+		if versionID == 0 {
+			return nil, fmt.Errorf("environment '%s' has no previous version", name)
+		}
+	} else if !slices.ContainsFunc(st.History, func(d Deployment) bool { return d.VersionID == versionID }) {
+		return nil, fmt.Errorf("version %d never ran in environment '%s'", versionID, name)
+	}
+	ver, err := vm.versionByID(versionID)
+	if err != nil {
+		return nil, err
+	}
+	err = vm.deployToEnv(i, *ver, ActionRollback, actor, nil)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Int("version", ver.ID).Str("environment", name).Msg("Rolled back environment")
+	return vm.Environments[name].Current, nil
+}
+
+// actorName returns actor, or "anonymous" for unauthenticated requests.
+func actorName(actor string) string {
+	if actor == "" {
+		return "anonymous"
+	}
+	return actor
+}
@@ -0,0 +1,553 @@
+package versioning
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oarkflow/json"
+	"github.com/oarkflow/log"
+)
+
+// Bundle format.
+const (
+	bundleFormat   = "router-versioning-bundle"
+	bundleSchema   = 1
+	bundleManifest = "manifest.json"
+	bundleBlobs    = "blobs/"
+)
+
+// BundleManifest describes the versions of a bundle written by Export. The
+// bundle is a tar.gz archive holding the manifest as manifest.json and every
+// file content once, as blobs/<sha256 of the content>. Paths are relative
+// to the watch root.
+type BundleManifest struct {
+	Format   string          `json:"format"`
+	Schema   int             `json:"schema"`
+	Created  time.Time       `json:"created"`
+	Branches []BundleBranch  `json:"branches"`
+	Versions []BundleVersion `json:"versions"`
+}
+
+// BundleBranch is a branch of a bundle. Base maps the path of each file
+// the versions of the branch apply on to the blob of its content. Deleted
+// branches are exported with their versions and imported deleted.
+type BundleBranch struct {
+	Name    string            `json:"name"`
+	Deleted bool              `json:"deleted,omitempty"`
+	From    string            `json:"from,omitempty"`
+	Created time.Time         `json:"created"`
+	Base    map[string]string `json:"base,omitempty"`
+}
+
+// BundleVersion is a version of a bundle, with the files it changed.
+type BundleVersion struct {
+	ID            int                   `json:"id"`
+	Tag           string                `json:"tag,omitempty"`
+	CommitMessage string                `json:"commitMessage,omitempty"`
+	Timestamp     time.Time             `json:"timestamp"`
+	Branch        string                `json:"branch"`
+	Files         map[string]BundleFile `json:"files"`
+	Signature     *Signature            `json:"signature,omitempty"`
+}
+
+// BundleFile is a file changed by a version of a bundle.
+type BundleFile struct {
+	Blob    string `json:"blob,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// Export writes a bundle of one version, or of every version of every
+// branch when versionID is 0, to w. A bundle of one version holds the files
+// it applies on as the base of its branch, so that it imports on its own.
+func (vm *VersionManager) Export(w io.Writer, versionID int) error {
+	vm.RLock()
+	defer vm.RUnlock()
+	manifest := BundleManifest{Format: bundleFormat, Schema: bundleSchema, Created: time.Now()}
+	blobs := make(map[string]string)
+	addFiles := func(files map[string]string) map[string]string {
+		refs := make(map[string]string, len(files))
+		for p, content := range files {
+			ref := blobRef(content)
+			blobs[ref] = content
+			refs[vm.relPath(p)] = ref
+		}
+		return refs
+	}
+	addVersion := func(ver VersionGroup) {
+		bv := BundleVersion{
+			ID:            ver.ID,
+			Tag:           ver.Tag,
+			CommitMessage: ver.CommitMessage,
+			Timestamp:     ver.Timestamp,
+			Branch:        ver.Branch,
+			Files:         make(map[string]BundleFile, len(ver.Files)),
+			Signature:     ver.Signature,
+		}
+		for p, fv := range ver.Files {
+			bf := BundleFile{Deleted: fv.Deleted}
+			if !fv.Deleted {
+				bf.Blob = blobRef(fv.Content)
+				blobs[bf.Blob] = fv.Content
+			}
+			bv.Files[vm.relPath(p)] = bf
+		}
+		manifest.Versions = append(manifest.Versions, bv)
+	}
+	if versionID != 0 {
+		ver, err := vm.versionByID(versionID)
+		if err != nil {
+			return err
+		}
+		bb := vm.bundleBranch(ver.Branch)
+		bb.Base = addFiles(vm.branchFiles(ver.Branch, ver.ID-1))
+		manifest.Branches = []BundleBranch{bb}
+		addVersion(*ver)
+	} else {
+		names := slices.Collect(maps.Keys(vm.Branches))
+		names = slices.AppendSeq(names, maps.Keys(vm.DeletedBranches))
+		for _, ver := range vm.Versions {
+			names = append(names, ver.Branch)
+		}
+		slices.Sort(names)
+		for _, name := range slices.Compact(names) {
+			bb := vm.bundleBranch(name)
+			if b, ok := vm.branch(name); ok {
+				bb.Base = addFiles(b.Base)
+			}
+			manifest.Branches = append(manifest.Branches, bb)
+		}
+		versions := slices.Clone(vm.Versions)
+		sort.Slice(versions, func(i, j int) bool { return versions[i].ID < versions[j].ID })
+		for _, ver := range versions {
+			addVersion(ver)
+		}
+	}
+	delete(blobs, "")
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, bundleManifest, data, manifest.Created); err != nil {
+		return err
+	}
+	for _, ref := range slices.Sorted(maps.Keys(blobs)) {
+		if err := writeTarFile(tw, bundleBlobs+ref, []byte(blobs[ref]), manifest.Created); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeTarFile adds a regular file to a tar archive.
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modTime, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// bundleBranch describes a branch in a bundle, without its base. A
+// branch unknown here, such as one deleted before deleted branches were
+// kept, is exported as a deleted branch without base.
+func (vm *VersionManager) bundleBranch(name string) BundleBranch {
+	if b, ok := vm.Branches[name]; ok {
+		return BundleBranch{Name: b.Name, From: b.From, Created: b.Created}
+	}
+	if b, ok := vm.DeletedBranches[name]; ok {
+		return BundleBranch{Name: b.Name, Deleted: true, From: b.From, Created: b.Created}
+	}
+	return BundleBranch{Name: name, Deleted: true}
+}
+
+// readBundle reads the manifest and the blobs of a bundle. Blobs are
+// checked against their reference.
+func readBundle(r io.Reader) (BundleManifest, map[string]string, error) {
+	var manifest BundleManifest
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, nil, fmt.Errorf("read bundle: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	blobs := map[string]string{"": ""}
+	found := false
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return manifest, nil, fmt.Errorf("read bundle: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return manifest, nil, fmt.Errorf("read bundle: %w", err)
+		}
+		switch {
+		case hdr.Name == bundleManifest:
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				return manifest, nil, fmt.Errorf("read bundle manifest: %w", err)
+			}
+			found = true
+		case strings.HasPrefix(hdr.Name, bundleBlobs):
+			ref := strings.TrimPrefix(hdr.Name, bundleBlobs)
+			if blobRef(string(data)) != ref {
+				return manifest, nil, fmt.Errorf("read bundle: blob %s does not match its content", ref)
+			}
+			blobs[ref] = string(data)
+		}
+	}
+	if !found || manifest.Format != bundleFormat {
+		return manifest, nil, errors.New("read bundle: not a version bundle")
+	}
+	if manifest.Schema > bundleSchema {
+		return manifest, nil, fmt.Errorf("read bundle: schema %d is newer than %d", manifest.Schema, bundleSchema)
+	}
+	return manifest, blobs, nil
+}
+
+// localPath returns the path of a file of a bundle in the first watch
+// root.
+func (vm *VersionManager) localPath(rel string) string {
+	if len(vm.watchConfig.Roots) == 0 || !filepath.IsLocal(rel) {
+		return rel
+	}
+	return filepath.Join(vm.watchConfig.Roots[0], rel)
+}
+
+// Import adds the versions of a bundle written by Export, on behalf of
+// actor. Versions go to the branch of the same name, created if needed,
+// deleted if it is deleted in the bundle, and get the next version IDs. Each imported version holds the files its
+// branch needs to match the configuration set it had in the bundle, so
+// that it deploys the same files. Versions must pass the validators and
+// signed versions must verify against a trusted key; if one fails, nothing
+// is imported. A version keeps its signature when it keeps its ID, as the
+// signature covers the ID; otherwise it is imported unsigned.
+func (vm *VersionManager) Import(r io.Reader, actor string) ([]VersionGroup, error) {
+	manifest, blobs, err := readBundle(r)
+	if err != nil {
+		return nil, err
+	}
+	vm.Lock()
+	defer vm.Unlock()
+	previous := vm.state()
+	imported, err := vm.importBundle(manifest, blobs)
+	if err == nil {
+		targets := make([]string, len(imported))
+		for i, ver := range imported {
+			targets[i] = auditRef("version", ver.ID)
+		}
+		vm.record(AuditEntry{
+			Actor:   actor,
+			Action:  AuditVersionImport,
+			Targets: targets,
+			Message: fmt.Sprintf("Imported %d versions", len(imported)),
+		})
+		err = vm.persistState()
+	}
+	if err != nil {
+		vm.restoreState(previous)
+		return nil, err
+	}
+	log.Info().Int("versions", len(imported)).Msg("Imported bundle")
+	return imported, nil
+}
+
+// importBundle applies a bundle to the state.
+func (vm *VersionManager) importBundle(manifest BundleManifest, blobs map[string]string) ([]VersionGroup, error) {
+	content := func(ref string) (string, error) {
+		c, ok := blobs[ref]
+		if !ok {
+			return "", fmt.Errorf("read bundle: blob %s is missing", ref)
+		}
+		return c, nil
+	}
+	// expected holds the files of each branch of the bundle, keyed by
+	// local path, as of the last version imported.
+	expected := make(map[string]map[string]string)
+	var created []string
+	for _, bb := range manifest.Branches {
+		files := make(map[string]string, len(bb.Base))
+		for rel, ref := range bb.Base {
+			c, err := content(ref)
+			if err != nil {
+				return nil, err
+			}
+			files[vm.localPath(rel)] = c
+		}
+		expected[bb.Name] = files
+		if _, ok := vm.branch(bb.Name); ok {
+			continue
+		}
+		b := &Branch{Name: bb.Name, From: bb.From, Created: bb.Created, Base: maps.Clone(files)}
+		if bb.Deleted {
+			vm.DeletedBranches[bb.Name] = b
+			continue
+		}
+		vm.Branches[bb.Name] = b
+		created = append(created, bb.Name)
+	}
+	versions := slices.Clone(manifest.Versions)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].ID < versions[j].ID })
+	var imported []VersionGroup
+	for _, bv := range versions {
+		files, ok := expected[bv.Branch]
+		if !ok {
+			return nil, fmt.Errorf("read bundle: version %d is on unknown branch '%s'", bv.ID, bv.Branch)
+		}
+		for rel, bf := range bv.Files {
+			p := vm.localPath(rel)
+			if bf.Deleted {
+				delete(files, p)
+				continue
+			}
+			c, err := content(bf.Blob)
+			if err != nil {
+				return nil, err
+			}
+			files[p] = c
+		}
+		ver := VersionGroup{
+			ID:            vm.NextVerID,
+			Tag:           bv.Tag,
+			CommitMessage: bv.CommitMessage,
+			Timestamp:     bv.Timestamp,
+			Branch:        bv.Branch,
+			Files:         make(map[string]FileVersion),
+		}
+		head := vm.head(bv.Branch)
+		for _, p := range unionKeys(head, files) {
+			c, ok := files[p]
+			if h, inHead := head[p]; ok == inHead && c == h {
+				continue
+			}
+			ver.Files[p] = FileVersion{Timestamp: ver.Timestamp, Content: c, Diff: diffText(head[p], c), Deleted: !ok}
+		}
+		if err := vm.validate(vm.snapshot(ver)); err != nil {
+			return nil, fmt.Errorf("version %d: %w", bv.ID, err)
+		}
+		if bv.Signature != nil {
+			signed := VersionGroup{
+				ID:            bv.ID,
+				Tag:           bv.Tag,
+				CommitMessage: bv.CommitMessage,
+				Timestamp:     bv.Timestamp,
+				Branch:        bv.Branch,
+				Signature:     bv.Signature,
+			}
+			set := make(map[string]string, len(files))
+			for p, c := range files {
+				set[vm.relPath(p)] = c
+			}
+			if err := vm.verifyDigest(signed, digestFiles(signed, set)); err != nil {
+				return nil, err
+			}
+			if ver.ID == bv.ID {
+				ver.Signature = bv.Signature
+			}
+		}
+		vm.Versions = append(vm.Versions, ver)
+		vm.NextVerID++
+		imported = append(imported, ver)
+	}
+	// New branches start with a clean working state holding their files,
+	// as after CreateBranch.
+	for _, name := range created {
+		b := vm.Branches[name]
+		head := vm.head(name)
+		b.LatestFiles, b.CommittedFiles = head, maps.Clone(head)
+		b.FileVersions = make(map[string][]FileVersion, len(head))
+		for p, c := range head {
+			b.FileVersions[p] = []FileVersion{{Timestamp: time.Now(), Content: c}}
+		}
+	}
+	return imported, nil
+}
+
+// ExportGit writes the history of every branch to w as a git fast-import
+// stream, to be replayed with "git fast-import" into a repository. Each
+// version is a commit on the branch of the same name and each tagged
+// version a tag. A branch created from another one starts with a commit of
+// the files it was created with.
+func (vm *VersionManager) ExportGit(w io.Writer) error {
+	vm.RLock()
+	defer vm.RUnlock()
+	g := &gitStream{w: w, blobs: make(map[string]int)}
+	versions := slices.Clone(vm.Versions)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].ID < versions[j].ID })
+	heads := make(map[string]int) // branch → mark of its last commit
+	marks := make(map[int]int)    // version ID → mark of its commit
+	tags := make(map[string]bool) // tag names written
+	started := make(map[string]bool)
+	start := func(name string) {
+		started[name] = true
+		b, ok := vm.branch(name)
+		if !ok || len(b.Base) == 0 {
+			return
+		}
+		// Fork from the last version of From made before the branch.
+		parent := 0
+		for _, v := range versions {
+			if v.Branch == b.From && !v.Timestamp.After(b.Created) && marks[v.ID] != 0 {
+				parent = marks[v.ID]
+			}
+		}
+		files := make(map[string]*string, len(b.Base))
+		for p, c := range b.Base {
+			files[p] = &c
+		}
+		heads[name] = g.commit(name, b.Created, fmt.Sprintf("Create branch '%s' from '%s'", name, b.From), parent, true, vm.gitFiles(files))
+	}
+	for _, ver := range versions {
+		if !started[ver.Branch] {
+			start(ver.Branch)
+		}
+		files := make(map[string]*string, len(ver.Files))
+		for p, fv := range ver.Files {
+			if fv.Deleted {
+				files[p] = nil
+				continue
+			}
+			files[p] = &fv.Content
+		}
+		message := ver.CommitMessage
+		if message == "" {
+			message = fmt.Sprintf("Version %d", ver.ID)
+		}
+		message += fmt.Sprintf("\n\nVersion-Id: %d\n", ver.ID)
+		mark := g.commit(ver.Branch, ver.Timestamp, message, heads[ver.Branch], false, vm.gitFiles(files))
+		heads[ver.Branch], marks[ver.ID] = mark, mark
+		if tag := gitRefName(ver.Tag); tag != "" && !tags[tag] {
+			tags[tag] = true
+			g.printf("tag %s\nfrom :%d\ntagger %s\ndata %d\n%s\n", tag, mark, gitIdent(ver.Timestamp), len(ver.Tag), ver.Tag)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(vm.Branches)) {
+		if !started[name] {
+			start(name)
+		}
+	}
+	g.printf("done\n")
+	return g.err
+}
+
+// gitFiles returns files keyed by their path in the repository: relative
+// to the watch root, with forward slashes.
+func (vm *VersionManager) gitFiles(files map[string]*string) map[string]*string {
+	out := make(map[string]*string, len(files))
+	for p, c := range files {
+		out[strings.TrimLeft(filepath.ToSlash(vm.relPath(p)), "/")] = c
+	}
+	return out
+}
+
+// gitStream writes a git fast-import stream. Marks are numbered in order.
+type gitStream struct {
+	w     io.Writer
+	err   error
+	mark  int
+	blobs map[string]int // blob reference → mark
+}
+
+func (g *gitStream) printf(format string, args ...any) {
+	if g.err == nil {
+		_, g.err = fmt.Fprintf(g.w, format, args...)
+	}
+}
+
+// blob writes a file content once and returns its mark.
+func (g *gitStream) blob(content string) int {
+	ref := blobRef(content)
+	if mark, ok := g.blobs[ref]; ok {
+		return mark
+	}
+	g.mark++
+	g.blobs[ref] = g.mark
+	g.printf("blob\nmark :%d\ndata %d\n%s\n", g.mark, len(content), content)
+	return g.mark
+}
+
+// commit writes a commit on branch changing files, nil for deleted files,
+// on top of the commit of mark parent, or of nothing when parent is 0. With
+// all, the tree holds files only. It returns the mark of the commit.
+func (g *gitStream) commit(branch string, when time.Time, message string, parent int, all bool, files map[string]*string) int {
+	paths := slices.Sorted(maps.Keys(files))
+	blobs := make([]int, len(paths))
+	for i, p := range paths {
+		if files[p] != nil {
+			blobs[i] = g.blob(*files[p])
+		}
+	}
+	g.mark++
+	mark := g.mark
+	g.printf("commit refs/heads/%s\nmark :%d\ncommitter %s\ndata %d\n%s\n", gitRefName(branch), mark, gitIdent(when), len(message), message)
+	if parent != 0 {
+		g.printf("from :%d\n", parent)
+	}
+	if all {
+		g.printf("deleteall\n")
+	}
+	for i, p := range paths {
+		if blobs[i] == 0 {
+			g.printf("D %s\n", gitPath(p))
+			continue
+		}
+		g.printf("M 100644 :%d %s\n", blobs[i], gitPath(p))
+	}
+	g.printf("\n")
+	return mark
+}
+
+// gitIdent returns the committer of the exported history.
+func gitIdent(when time.Time) string {
+	return fmt.Sprintf("versioning <versioning@localhost> %d +0000", when.Unix())
+}
+
+// gitPath quotes a path for a file command when needed.
+func gitPath(p string) string {
+	if strings.HasPrefix(p, `"`) || strings.Contains(p, "\n") {
+		return strconv.Quote(p)
+	}
+	return p
+}
+
+// gitRefName turns a branch or tag name into a valid ref name, "" if
+// nothing is left of it.
+func gitRefName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r <= ' ' || r == 0x7f || strings.ContainsRune("~^:?*[\\", r):
+			b.WriteByte('-')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	ref := strings.Trim(strings.ReplaceAll(b.String(), "..", "-"), "/.")
+	ref = strings.TrimSuffix(ref, ".lock")
+	if ref == "@" {
+		return ""
+	}
+	return strings.ReplaceAll(ref, "@{", "-{")
+}
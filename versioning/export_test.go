@@ -0,0 +1,172 @@
+package versioning
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// newExportManager returns a manager with a version on main and one on a
+// deleted branch.
+func newExportManager(t *testing.T, opts ...Option) (*VersionManager, VersionGroup) {
+	t.Helper()
+	vm, err := New(append(opts, WithStoragePath(filepath.Join(t.TempDir(), "versions.db")))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { vm.Close() })
+	vm.UpdateFile("api.json", `{"a":1}`, false)
+	vm.CreateCommit([]string{"api.json"}, "add api", "alice")
+	if _, err := vm.MergeCommits("v1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.CreateBranch("feature", "main", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.SwitchBranch("feature", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	vm.UpdateFile("db.json", `{"b":2}`, false)
+	vm.CreateCommit([]string{"db.json"}, "add db", "alice")
+	ver, err := vm.MergeCommits("f1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.SwitchBranch("main", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.DeleteBranch("feature", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	return vm, ver
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src, _ := newExportManager(t)
+	var bundle bytes.Buffer
+	if err := src.Export(&bundle, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := New(WithStoragePath(filepath.Join(t.TempDir(), "versions.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	imported, err := dst.Import(&bundle, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 2 {
+		t.Fatalf("imported %d versions, want 2", len(imported))
+	}
+	if _, ok := dst.Branches["feature"]; ok {
+		t.Errorf("deleted branch feature imported as a live branch")
+	}
+	if _, ok := dst.DeletedBranches["feature"]; !ok {
+		t.Errorf("deleted branch feature not imported")
+	}
+	for _, ver := range imported {
+		got, want := dst.contentSet(ver), src.contentSet(*must(src.versionByID(ver.ID)))
+		if len(got) != len(want) {
+			t.Errorf("version %d files = %v, want %v", ver.ID, got, want)
+		}
+		for p, c := range want {
+			if got[p] != c {
+				t.Errorf("version %d file %s = %q, want %q", ver.ID, p, got[p], c)
+			}
+		}
+	}
+}
+
+func TestExportVersionOfDeletedBranch(t *testing.T) {
+	src, ver := newExportManager(t)
+	var bundle bytes.Buffer
+	if err := src.Export(&bundle, ver.ID); err != nil {
+		t.Fatal(err)
+	}
+	dst, err := New(WithStoragePath(filepath.Join(t.TempDir(), "versions.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	imported, err := dst.Import(&bundle, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := dst.contentSet(imported[0])
+	if files["api.json"] != `{"a":1}` || files["db.json"] != `{"b":2}` {
+		t.Errorf("imported files = %v", files)
+	}
+}
+
+func TestImportVerifiesSignatures(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, _ := newExportManager(t, WithSigningKey(key))
+	var bundle bytes.Buffer
+	if err := src.Export(&bundle, 0); err != nil {
+		t.Fatal(err)
+	}
+	data := bundle.Bytes()
+
+	untrusted, err := New(WithStoragePath(filepath.Join(t.TempDir(), "versions.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer untrusted.Close()
+	if _, err := untrusted.Import(bytes.NewReader(data), "bob"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("import signed by an untrusted key: err = %v, want %v", err, ErrInvalidSignature)
+	}
+	if len(untrusted.Versions) != 0 {
+		t.Errorf("versions imported despite the error: %d", len(untrusted.Versions))
+	}
+
+	pub := key.Public().(ed25519.PublicKey)
+	same, err := New(WithStoragePath(filepath.Join(t.TempDir(), "versions.db")), WithTrustedKeys(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer same.Close()
+	imported, err := same.Import(bytes.NewReader(data), "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ver := range imported {
+		if err := same.VerifyVersion(ver.ID); err != nil {
+			t.Errorf("version imported with its ID: %v", err)
+		}
+	}
+
+	trusted, err := New(WithStoragePath(filepath.Join(t.TempDir(), "versions.db")), WithTrustedKeys(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trusted.Close()
+	trusted.UpdateFile("local.json", `{"c":3}`, false)
+	trusted.CreateCommit([]string{"local.json"}, "add local", "carol")
+	if _, err := trusted.MergeCommits("", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	imported, err = trusted.Import(bytes.NewReader(data), "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ver := range imported {
+		if ver.Signature != nil {
+			t.Errorf("renumbered version %d kept a signature", ver.ID)
+		}
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -0,0 +1,701 @@
+package versioning
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/oarkflow/json"
+	"github.com/oarkflow/log"
+
+	"github.com/oarkflow/router"
+)
+
+// CommitPayload is the body of HandleCommit.
+type CommitPayload struct {
+	Message string   `json:"message"`
+	Files   []string `json:"files"`
+}
+
+// VersionPayload is the body of HandleCreateVersion.
+type VersionPayload struct {
+	Tag string `json:"tag"`
+}
+
+// MergeVersionPayload is the body of HandleMergeSelectedCommits.
+type MergeVersionPayload struct {
+	Tag       string `json:"tag"`
+	CommitIDs []int  `json:"commit_ids"`
+}
+
+// ResolveHunkPayload is the body of HandleResolveHunk. Take picks the
+// "ours", "theirs" or "base" side of the hunk; when empty, Content is used.
+type ResolveHunkPayload struct {
+	HunkID  int    `json:"hunk_id"`
+	Take    string `json:"take"`
+	Content string `json:"content"`
+}
+
+// SwitchVersionPayload is the body of HandleSwitchVersion.
+type SwitchVersionPayload struct {
+	VersionID int `json:"version_id"`
+}
+
+// SwitchBranchPayload is the body of HandleSwitchBranch.
+type SwitchBranchPayload struct {
+	Branch string `json:"branch"`
+}
+
+// CreateBranchPayload is the body of HandleCreateBranch.
+type CreateBranchPayload struct {
+	Name string `json:"name"`
+	From string `json:"from"`
+}
+
+// MergeBranchPayload is the body of HandleMergeBranch.
+type MergeBranchPayload struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Tag    string `json:"tag"`
+}
+
+// EnvironmentPayload is the body of HandleApprove, HandlePromote and
+// HandleRollbackEnvironment.
+type EnvironmentPayload struct {
+	Environment string `json:"environment"`
+	VersionID   int    `json:"version_id"`
+}
+
+// RollbackPayload is the body of HandleRollback.
+type RollbackPayload struct {
+	VersionID int `json:"version_id"`
+}
+
+// RestorePayload is the body of HandleRestore. Path is restored to At, see
+// VersionManager.Diff; every file is when Path is empty.
+type RestorePayload struct {
+	Path string `json:"path"`
+	At   string `json:"at"`
+}
+
+// Mount registers the HTTP API on g, behind the configured AuthProvider.
+// Without one every request is answered 401, unless WithoutAuth is set.
+// Each endpoint requires a role:
+//
+//	GET  /changes                 HandleChanges               viewer
+//	POST /commit                  HandleCommit                committer
+//	GET  /commits                 HandleGetCommits            viewer
+//	POST /version                 HandleCreateVersion         committer
+//	POST /version/mergeSelected   HandleMergeSelectedCommits  committer
+//	POST /version/revert          HandleRevertCommits         committer
+//	GET  /merge                   HandleGetMerge              viewer
+//	POST /merge/resolve           HandleResolveHunk           committer
+//	POST /merge/complete          HandleCompleteMerge         committer
+//	POST /merge/abort             HandleAbortMerge            committer
+//	GET  /versions                HandleGetVersions           viewer
+//	POST /version/dryrun          HandleDryRun                viewer
+//	GET  /version/verify          HandleVerifyVersion         viewer
+//	POST /version/switch          HandleSwitchVersion         deployer
+//	GET  /deployedVersion         HandleDeployedVersion       viewer
+//	GET  /branches                HandleListBranches          viewer
+//	POST /branch                  HandleCreateBranch          committer
+//	POST /branch/delete           HandleDeleteBranch          committer
+//	POST /branch/switch           HandleSwitchBranch          committer
+//	GET  /branch/compare          HandleCompareBranches       viewer
+//	POST /branch/merge            HandleMergeBranch           committer
+//	POST /deployment/rollback     HandleRollback              deployer
+//	GET  /environments            HandleEnvironments          viewer
+//	GET  /environment/history     HandleEnvironmentHistory    viewer
+//	POST /environment/approve     HandleApprove               approver
+//	POST /environment/promote     HandlePromote               deployer
+//	POST /environment/rollback    HandleRollbackEnvironment   deployer
+//	GET  /file/history            HandleFileHistory           viewer
+//	GET  /file/blame              HandleBlame                 viewer
+//	GET  /diff                    HandleDiff                  viewer
+//	POST /restore                 HandleRestore               committer
+//	GET  /audit                   HandleAudit                 viewer
+//	GET  /export                  HandleExport                viewer
+//	GET  /export/git              HandleExportGit             viewer
+//	POST /import                  HandleImport                committer
+//	POST /storage/compact         HandleCompact               deployer
+func (vm *VersionManager) Mount(g *router.Group) {
+	if vm.auth == nil && !vm.noAuth {
+		log.Warn().Msg("Versioning API has no AuthProvider, every request will be refused; set WithAuth or WithoutAuth")
+	}
+	g.Get("/changes", vm.authorize(RoleViewer), vm.HandleChanges)
+	g.Post("/commit", vm.authorize(RoleCommitter), vm.HandleCommit)
+	g.Get("/commits", vm.authorize(RoleViewer), vm.HandleGetCommits)
+	g.Post("/version", vm.authorize(RoleCommitter), vm.HandleCreateVersion)
+	g.Post("/version/mergeSelected", vm.authorize(RoleCommitter), vm.HandleMergeSelectedCommits)
+	g.Post("/version/revert", vm.authorize(RoleCommitter), vm.HandleRevertCommits)
+	g.Get("/merge", vm.authorize(RoleViewer), vm.HandleGetMerge)
+	g.Post("/merge/resolve", vm.authorize(RoleCommitter), vm.HandleResolveHunk)
+	g.Post("/merge/complete", vm.authorize(RoleCommitter), vm.HandleCompleteMerge)
+	g.Post("/merge/abort", vm.authorize(RoleCommitter), vm.HandleAbortMerge)
+	g.Get("/versions", vm.authorize(RoleViewer), vm.HandleGetVersions)
+	g.Post("/version/dryrun", vm.authorize(RoleViewer), vm.HandleDryRun)
+	g.Get("/version/verify", vm.authorize(RoleViewer), vm.HandleVerifyVersion)
+	g.Post("/version/switch", vm.authorize(RoleDeployer), vm.HandleSwitchVersion)
+	g.Get("/deployedVersion", vm.authorize(RoleViewer), vm.HandleDeployedVersion)
+	g.Get("/branches", vm.authorize(RoleViewer), vm.HandleListBranches)
+	g.Post("/branch", vm.authorize(RoleCommitter), vm.HandleCreateBranch)
+	g.Post("/branch/delete", vm.authorize(RoleCommitter), vm.HandleDeleteBranch)
+	g.Post("/branch/switch", vm.authorize(RoleCommitter), vm.HandleSwitchBranch)
+	g.Get("/branch/compare", vm.authorize(RoleViewer), vm.HandleCompareBranches)
+	g.Post("/branch/merge", vm.authorize(RoleCommitter), vm.HandleMergeBranch)
+	g.Post("/deployment/rollback", vm.authorize(RoleDeployer), vm.HandleRollback)
+	g.Get("/environments", vm.authorize(RoleViewer), vm.HandleEnvironments)
+	g.Get("/environment/history", vm.authorize(RoleViewer), vm.HandleEnvironmentHistory)
+	g.Post("/environment/approve", vm.authorize(RoleApprover), vm.HandleApprove)
+	g.Post("/environment/promote", vm.authorize(RoleDeployer), vm.HandlePromote)
+	g.Post("/environment/rollback", vm.authorize(RoleDeployer), vm.HandleRollbackEnvironment)
+	g.Get("/file/history", vm.authorize(RoleViewer), vm.HandleFileHistory)
+	g.Get("/file/blame", vm.authorize(RoleViewer), vm.HandleBlame)
+	g.Get("/diff", vm.authorize(RoleViewer), vm.HandleDiff)
+	g.Post("/restore", vm.authorize(RoleCommitter), vm.HandleRestore)
+	g.Get("/audit", vm.authorize(RoleViewer), vm.HandleAudit)
+	g.Get("/export", vm.authorize(RoleViewer), vm.HandleExport)
+	g.Get("/export/git", vm.authorize(RoleViewer), vm.HandleExportGit)
+	g.Post("/import", vm.authorize(RoleCommitter), vm.HandleImport)
+	g.Post("/storage/compact", vm.authorize(RoleDeployer), vm.HandleCompact)
+}
+
+// HandleChanges lists the uncommitted changes as diffs per file.
+func (vm *VersionManager) HandleChanges(c *fiber.Ctx) error {
+	return c.JSON(vm.GetChanges())
+}
+
+// HandleCommit creates a commit from a CommitPayload.
+func (vm *VersionManager) HandleCommit(c *fiber.Ctx) error {
+	var payload CommitPayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid payload")
+	}
+	return c.JSON(vm.CreateCommit(payload.Files, payload.Message, UserFromCtx(c)))
+}
+
+// HandleGetCommits lists the pending commits.
+func (vm *VersionManager) HandleGetCommits(c *fiber.Ctx) error {
+	return c.JSON(vm.Pending())
+}
+
+// HandleCreateVersion merges the pending commits into a version.
+func (vm *VersionManager) HandleCreateVersion(c *fiber.Ctx) error {
+	var payload VersionPayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid payload")
+	}
+	ver, err := vm.MergeCommits(payload.Tag, UserFromCtx(c))
+	if err != nil {
+		return mergeError(c, err)
+	}
+	return c.JSON(ver)
+}
+
+// HandleMergeSelectedCommits merges the selected pending commits into a
+// version.
+func (vm *VersionManager) HandleMergeSelectedCommits(c *fiber.Ctx) error {
+	var payload MergeVersionPayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid payload")
+	}
+	ver, err := vm.MergeSelectedCommits(payload.CommitIDs, payload.Tag, UserFromCtx(c))
+	if err != nil {
+		return mergeError(c, err)
+	}
+	return c.JSON(ver)
+}
+
+// HandleRevertCommits drops the pending commits of the current branch.
+func (vm *VersionManager) HandleRevertCommits(c *fiber.Ctx) error {
+	vm.RevertPendingCommits(UserFromCtx(c))
+	return c.SendString("Pending commits reverted.")
+}
+
+// mergeError answers a failed merge with 409. Conflicts are sent as JSON
+// with their hunks, to be resolved with HandleResolveHunk. Versions failing
+// validation are answered with 422.
+func mergeError(c *fiber.Ctx, err error) error {
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+			"hunks": conflict.Hunks,
+		})
+	}
+	if resp, ok := validationError(c, err); ok {
+		return resp
+	}
+	return c.Status(fiber.StatusConflict).SendString(err.Error())
+}
+
+// validationError answers a validation failure with 422 and the list of
+// errors. It reports false when err is not one.
+func validationError(c *fiber.Ctx, err error) (error, bool) {
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		return nil, false
+	}
+	errs := make([]string, len(verr.Errs))
+	for i, e := range verr.Errs {
+		errs[i] = e.Error()
+	}
+	return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+		"error":  err.Error(),
+		"errors": errs,
+	}), true
+}
+
+// signatureError answers a version refused by the signature policy with
+// 422. It reports false when err is not a signature error.
+func signatureError(c *fiber.Ctx, err error) (error, bool) {
+	if !errors.Is(err, ErrUnsignedVersion) && !errors.Is(err, ErrInvalidSignature) {
+		return nil, false
+	}
+	return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()}), true
+}
+
+// HandleGetMerge returns the merge waiting for conflict resolution.
+func (vm *VersionManager) HandleGetMerge(c *fiber.Ctx) error {
+	merge := vm.CurrentMerge()
+	if merge == nil {
+		return c.Status(fiber.StatusNotFound).SendString("No merge in progress")
+	}
+	return c.JSON(fiber.Map{
+		"tag":        merge.Tag,
+		"branch":     merge.Branch,
+		"commit_ids": merge.CommitIDs,
+		"hunks":      merge.Hunks(),
+		"unresolved": merge.Unresolved(),
+	})
+}
+
+// HandleResolveHunk resolves a hunk of the pending merge from a
+// ResolveHunkPayload.
+func (vm *VersionManager) HandleResolveHunk(c *fiber.Ctx) error {
+	var payload ResolveHunkPayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid payload")
+	}
+	content := payload.Content
+	if payload.Take != "" {
+		merge := vm.CurrentMerge()
+		if merge == nil {
+			return c.Status(fiber.StatusConflict).SendString(ErrNoMerge.Error())
+		}
+		var hunk *Hunk
+		for _, h := range merge.Hunks() {
+			if h.ID == payload.HunkID {
+				hunk = &h
+				break
+			}
+		}
+		if hunk == nil {
+			return c.Status(fiber.StatusNotFound).SendString("Hunk not found")
+		}
+		switch payload.Take {
+		case "ours":
+			content = hunk.Ours
+		case "theirs":
+			content = hunk.Theirs
+		case "base":
+			content = hunk.Base
+		default:
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid payload")
+		}
+	}
+	if err := vm.ResolveHunk(payload.HunkID, content, UserFromCtx(c)); err != nil {
+		return c.Status(fiber.StatusConflict).SendString(err.Error())
+	}
+	merge := vm.CurrentMerge()
+	if merge == nil {
+		return c.Status(fiber.StatusConflict).SendString(ErrNoMerge.Error())
+	}
+	return c.JSON(merge.Hunks())
+}
+
+// HandleCompleteMerge creates the version of the pending merge once its
+// hunks are resolved.
+func (vm *VersionManager) HandleCompleteMerge(c *fiber.Ctx) error {
+	ver, err := vm.CompleteMerge(UserFromCtx(c))
+	if err != nil {
+		return c.Status(fiber.StatusConflict).SendString(err.Error())
+	}
+	return c.JSON(ver)
+}
+
+// HandleAbortMerge aborts the pending merge.
+func (vm *VersionManager) HandleAbortMerge(c *fiber.Ctx) error {
+	vm.AbortMerge(UserFromCtx(c))
+	return c.SendString("Merge aborted.")
+}
+
+// HandleGetVersions lists the versions.
+func (vm *VersionManager) HandleGetVersions(c *fiber.Ctx) error {
+	return c.JSON(vm.ListVersions())
+}
+
+// HandleSwitchVersion deploys a version without changing the baseline.
+func (vm *VersionManager) HandleSwitchVersion(c *fiber.Ctx) error {
+	var payload SwitchVersionPayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid payload")
+	}
+	ver, err := vm.SwitchVersion(payload.VersionID, UserFromCtx(c))
+	if errors.Is(err, ErrVersionNotFound) {
+		return c.Status(fiber.StatusNotFound).SendString("Version not found")
+	}
+	if resp, ok := validationError(c, err); ok {
+		return resp
+	}
+	if resp, ok := signatureError(c, err); ok {
+		return resp
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(fmt.Sprintf("Failed to deploy version: %v", err))
+	}
+	return c.JSON(ver)
+}
+
+// HandleVerifyVersion checks the signature of the version of the "id" query
+// parameter.
+func (vm *VersionManager) HandleVerifyVersion(c *fiber.Ctx) error {
+	err := vm.VerifyVersion(c.QueryInt("id"))
+	if resp, ok := signatureError(c, err); ok {
+		return resp
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	}
+	return c.JSON(fiber.Map{"verified": true})
+}
+
+// HandleDryRun reports what deploying a version to an environment would
+// change, from an EnvironmentPayload. The environment defaults to the first
+// one.
+func (vm *VersionManager) HandleDryRun(c *fiber.Ctx) error {
+	var payload EnvironmentPayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid payload")
+	}
+	result, err := vm.DryRun(payload.VersionID, payload.Environment)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	}
+	return c.JSON(result)
+}
+
+// HandleDeployedVersion returns the deployed version.
+func (vm *VersionManager) HandleDeployedVersion(c *fiber.Ctx) error {
+	ver := vm.Deployed()
+	if ver == nil {
+		return c.Status(fiber.StatusNotFound).SendString("No deployed version")
+	}
+	return c.JSON(ver)
+}
+
+// HandleSwitchBranch switches the current branch.
+func (vm *VersionManager) HandleSwitchBranch(c *fiber.Ctx) error {
+	var payload SwitchBranchPayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil || strings.TrimSpace(payload.Branch) == "" {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid branch payload")
+	}
+	if err := vm.SwitchBranch(payload.Branch, UserFromCtx(c)); err != nil {
+		return branchError(c, err)
+	}
+	return c.SendString(fmt.Sprintf("Switched to branch '%s'", payload.Branch))
+}
+
+// branchError answers a failed branch operation with 404 for unknown
+// branches and 409 otherwise.
+func branchError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, ErrBranchNotFound) {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	}
+	return c.Status(fiber.StatusConflict).SendString(err.Error())
+}
+
+// HandleListBranches lists the branches.
+func (vm *VersionManager) HandleListBranches(c *fiber.Ctx) error {
+	return c.JSON(vm.ListBranches())
+}
+
+// HandleCreateBranch creates a branch from a CreateBranchPayload. From
+// defaults to the current branch.
+func (vm *VersionManager) HandleCreateBranch(c *fiber.Ctx) error {
+	var payload CreateBranchPayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil || strings.TrimSpace(payload.Name) == "" {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid branch payload")
+	}
+	if payload.From == "" {
+		payload.From = vm.Current()
+	}
+	if err := vm.CreateBranch(payload.Name, payload.From, UserFromCtx(c)); err != nil {
+		return branchError(c, err)
+	}
+	return c.SendString(fmt.Sprintf("Created branch '%s' from '%s'", payload.Name, payload.From))
+}
+
+// HandleDeleteBranch deletes the branch of a SwitchBranchPayload.
+func (vm *VersionManager) HandleDeleteBranch(c *fiber.Ctx) error {
+	var payload SwitchBranchPayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil || strings.TrimSpace(payload.Branch) == "" {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid branch payload")
+	}
+	if err := vm.DeleteBranch(payload.Branch, UserFromCtx(c)); err != nil {
+		return branchError(c, err)
+	}
+	return c.SendString(fmt.Sprintf("Deleted branch '%s'", payload.Branch))
+}
+
+// HandleCompareBranches returns the diff per file from the branch of the
+// "from" query parameter to the one of "to".
+func (vm *VersionManager) HandleCompareBranches(c *fiber.Ctx) error {
+	changes, err := vm.CompareBranches(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return branchError(c, err)
+	}
+	return c.JSON(changes)
+}
+
+// HandleMergeBranch merges a branch into another from a MergeBranchPayload.
+// Target defaults to the current branch.
+func (vm *VersionManager) HandleMergeBranch(c *fiber.Ctx) error {
+	var payload MergeBranchPayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil || strings.TrimSpace(payload.Source) == "" {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid payload")
+	}
+	if payload.Target == "" {
+		payload.Target = vm.Current()
+	}
+	ver, err := vm.MergeBranch(payload.Source, payload.Target, payload.Tag, UserFromCtx(c))
+	if errors.Is(err, ErrBranchNotFound) {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	}
+	if err != nil {
+		return mergeError(c, err)
+	}
+	return c.JSON(ver)
+}
+
+// HandleRollback rolls the deployment back to a version.
+func (vm *VersionManager) HandleRollback(c *fiber.Ctx) error {
+	var payload RollbackPayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid payload")
+	}
+	if err := vm.RollbackDeployment(payload.VersionID, UserFromCtx(c)); err != nil {
+		if resp, ok := signatureError(c, err); ok {
+			return resp
+		}
+		return c.Status(fiber.StatusConflict).SendString(err.Error())
+	}
+	return c.SendString(fmt.Sprintf("Rolled back deployment to version %d", payload.VersionID))
+}
+
+// environmentError answers a failed environment operation with 404 for
+// unknown environments, 422 for versions failing validation or the
+// signature policy and 409 otherwise.
+func environmentError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, ErrEnvironmentNotFound) {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	}
+	if resp, ok := validationError(c, err); ok {
+		return resp
+	}
+	if resp, ok := signatureError(c, err); ok {
+		return resp
+	}
+	return c.Status(fiber.StatusConflict).SendString(err.Error())
+}
+
+// HandleEnvironments returns which version runs in each environment.
+func (vm *VersionManager) HandleEnvironments(c *fiber.Ctx) error {
+	return c.JSON(vm.EnvironmentStatuses())
+}
+
+// HandleEnvironmentHistory returns the deploy history of the environment of
+// the "name" query parameter.
+func (vm *VersionManager) HandleEnvironmentHistory(c *fiber.Ctx) error {
+	history, err := vm.EnvironmentHistory(c.Query("name"))
+	if err != nil {
+		return environmentError(c, err)
+	}
+	return c.JSON(history)
+}
+
+// HandleApprove approves the promotion of a version into an environment,
+// as the authenticated user.
+func (vm *VersionManager) HandleApprove(c *fiber.Ctx) error {
+	var payload EnvironmentPayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid payload")
+	}
+	if err := vm.Approve(payload.Environment, payload.VersionID, UserFromCtx(c)); err != nil {
+		return environmentError(c, err)
+	}
+	return c.SendString(fmt.Sprintf("Approved version %d for environment '%s'", payload.VersionID, payload.Environment))
+}
+
+// HandlePromote promotes the version running in an environment to the next
+// one.
+func (vm *VersionManager) HandlePromote(c *fiber.Ctx) error {
+	var payload EnvironmentPayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid payload")
+	}
+	d, err := vm.Promote(payload.Environment, UserFromCtx(c))
+	if err != nil {
+		return environmentError(c, err)
+	}
+	return c.JSON(d)
+}
+
+// HandleRollbackEnvironment rolls an environment back to a version it ran
+// before, the previous one when no version is given.
+func (vm *VersionManager) HandleRollbackEnvironment(c *fiber.Ctx) error {
+	var payload EnvironmentPayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid payload")
+	}
+	d, err := vm.RollbackEnvironment(payload.Environment, payload.VersionID, UserFromCtx(c))
+	if err != nil {
+		return environmentError(c, err)
+	}
+	return c.JSON(d)
+}
+
+// pointError answers a point of the history that cannot be resolved with
+// 404 when its commit or version does not exist and 400 when it is
+// invalid. Other errors are answered with 500.
+func pointError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ErrVersionNotFound), errors.Is(err, ErrCommitNotFound):
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	case errors.Is(err, ErrInvalidPoint):
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+}
+
+// HandleFileHistory returns the history of the file of the "path" query
+// parameter.
+func (vm *VersionManager) HandleFileHistory(c *fiber.Ctx) error {
+	path := c.Query("path")
+	if path == "" {
+		return c.Status(fiber.StatusBadRequest).SendString("Missing path")
+	}
+	return c.JSON(vm.FileHistory(path))
+}
+
+// HandleBlame returns the lines of the file of the "path" query parameter
+// with the commit or version that introduced each, at the point of "at".
+func (vm *VersionManager) HandleBlame(c *fiber.Ctx) error {
+	path := c.Query("path")
+	if path == "" {
+		return c.Status(fiber.StatusBadRequest).SendString("Missing path")
+	}
+	lines, err := vm.Blame(path, c.Query("at"))
+	if err != nil {
+		return pointError(c, err)
+	}
+	return c.JSON(lines)
+}
+
+// HandleDiff returns the diff per file from the point of the "from" query
+// parameter to the one of "to", only for "path" when set.
+func (vm *VersionManager) HandleDiff(c *fiber.Ctx) error {
+	changes, err := vm.Diff(c.Query("from"), c.Query("to"), c.Query("path"))
+	if err != nil {
+		return pointError(c, err)
+	}
+	return c.JSON(changes)
+}
+
+// HandleRestore restores files from a RestorePayload as uncommitted changes
+// and returns their paths.
+func (vm *VersionManager) HandleRestore(c *fiber.Ctx) error {
+	var payload RestorePayload
+	if err := json.Unmarshal(c.Body(), &payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid payload")
+	}
+	restored, err := vm.Restore(payload.Path, payload.At, UserFromCtx(c))
+	if err != nil {
+		return pointError(c, err)
+	}
+	return c.JSON(restored)
+}
+
+// HandleAudit returns a page of the audit log, filtered by the "actor",
+// "action", "target", "since" and "until" query parameters, the latter two
+// in RFC 3339. "after" and "limit" page through the entries; the next page
+// starts after the "next" of the response.
+func (vm *VersionManager) HandleAudit(c *fiber.Ctx) error {
+	q := AuditQuery{
+		Actor:  c.Query("actor"),
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+		After:  c.QueryInt("after"),
+		Limit:  c.QueryInt("limit"),
+	}
+	for param, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if v := c.Query(param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid %s", param))
+			}
+			*t = parsed
+		}
+	}
+	return c.JSON(vm.QueryAudit(q))
+}
+
+// HandleExport sends a bundle of the version of the "version" query
+// parameter, or of the whole history without it.
+func (vm *VersionManager) HandleExport(c *fiber.Ctx) error {
+	var buf bytes.Buffer
+	if err := vm.Export(&buf, c.QueryInt("version")); err != nil {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	}
+	name := "history.tar.gz"
+	if id := c.QueryInt("version"); id != 0 {
+		name = fmt.Sprintf("version-%d.tar.gz", id)
+	}
+	c.Set(fiber.HeaderContentType, "application/gzip")
+	c.Attachment(name)
+	return c.Send(buf.Bytes())
+}
+
+// HandleExportGit sends the history as a git fast-import stream.
+func (vm *VersionManager) HandleExportGit(c *fiber.Ctx) error {
+	var buf bytes.Buffer
+	if err := vm.ExportGit(&buf); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	return c.Send(buf.Bytes())
+}
+
+// HandleImport imports the bundle of the request body and returns the
+// versions it added.
+func (vm *VersionManager) HandleImport(c *fiber.Ctx) error {
+	versions, err := vm.Import(bytes.NewReader(c.Body()), UserFromCtx(c))
+	if resp, ok := validationError(c, err); ok {
+		return resp
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	return c.JSON(versions)
+}
+
+// HandleCompact compacts the storage.
+func (vm *VersionManager) HandleCompact(c *fiber.Ctx) error {
+	if err := vm.Compact(UserFromCtx(c)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	return c.SendString("Storage compacted.")
+}
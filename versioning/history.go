@@ -0,0 +1,422 @@
+package versioning
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oarkflow/log"
+)
+
+// ErrCommitNotFound is returned for a commit that is not on the current
+// branch.
+var ErrCommitNotFound = errors.New("commit not found on current branch")
+
+// ErrInvalidPoint is returned for a point of the history that is neither a
+// commit, a version nor a time.
+var ErrInvalidPoint = errors.New("invalid point: use commit:<id>, version:<id> or an RFC 3339 time")
+
+// FileEvent is a point of the history of a file.
+type FileEvent struct {
+	// Ref identifies the event: "commit:<id>" or "version:<id>" for a
+	// commit or version changing the file, "branch:<name>" for the content
+	// the branch was created with from branch name, "change" for an
+	// uncommitted change.
+	Ref string `json:"ref"`
+	// Path is the path of the file at the event, which differs from the
+	// current one before a rename.
+	Path      string    `json:"path"`
+	Timestamp time.Time `json:"timestamp"`
+	Author    string    `json:"author,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Content   string    `json:"content"`
+	Deleted   bool      `json:"deleted,omitempty"`
+}
+
+// committed reports whether the event is a commit, a version or the base
+// of a branch.
+func (e FileEvent) committed() bool {
+	return e.Ref != refChange
+}
+
+// refChange is the Ref of uncommitted changes.
+const refChange = "change"
+
+// BlameLine is a line of a file with the event that introduced it.
+type BlameLine struct {
+	Line      int       `json:"line"`
+	Text      string    `json:"text"`
+	Ref       string    `json:"ref"`
+	Timestamp time.Time `json:"timestamp"`
+	Author    string    `json:"author,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// timeline returns the history of a file of the current branch, oldest
+// first: its content when the branch was created, its commits, pending or
+// merged, its versions and its uncommitted changes.
+func (vm *VersionManager) timeline(path string) []FileEvent {
+	var events []FileEvent
+	branch := vm.Branches[vm.CurrentBranch]
+	if content, ok := branch.Base[path]; ok {
+		events = append(events, FileEvent{
+			Ref:       auditRef("branch", branch.From),
+			Path:      path,
+			Timestamp: branch.Created,
+			Message:   fmt.Sprintf("Branch '%s' created from '%s'", branch.Name, branch.From),
+			Content:   content,
+		})
+	}
+	for _, commit := range slices.Concat(vm.MergedCommits, vm.PendingCommits) {
+		if fv, ok := commit.Files[path]; ok && commit.Branch == vm.CurrentBranch {
+			events = append(events, FileEvent{
+				Ref:       auditRef("commit", commit.ID),
+				Path:      path,
+				Timestamp: commit.Timestamp,
+				Author:    commit.Author,
+				Message:   commit.Message,
+				Content:   fv.Content,
+				Deleted:   fv.Deleted,
+			})
+		}
+	}
+	for _, ver := range vm.Versions {
+		if fv, ok := ver.Files[path]; ok && ver.Branch == vm.CurrentBranch {
+			message := ver.Tag
+			if message == "" {
+				message = ver.CommitMessage
+			}
+			events = append(events, FileEvent{
+				Ref:       auditRef("version", ver.ID),
+				Path:      path,
+				Timestamp: ver.Timestamp,
+				Author:    ver.Author,
+				Message:   message,
+				Content:   fv.Content,
+				Deleted:   fv.Deleted,
+			})
+		}
+	}
+	for _, fv := range vm.FileVersions[path] {
+		e := FileEvent{Ref: refChange, Path: path, Timestamp: fv.Timestamp, Content: fv.Content, Deleted: fv.Deleted}
+		if fv.RenamedFrom != "" {
+			e.Message = fmt.Sprintf("Renamed from %s", fv.RenamedFrom)
+		}
+		events = append(events, e)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+	return events
+}
+
+// history returns the timeline of a file followed across renames: it
+// starts with the timeline of the file it was renamed from, up to the
+// rename.
+func (vm *VersionManager) history(path string) []FileEvent {
+	events := vm.timeline(path)
+	seen := map[string]bool{path: true}
+	var until time.Time
+	for {
+		from, at := vm.renamedFrom(path, until)
+		if from == "" || seen[from] {
+			return events
+		}
+		var before []FileEvent
+		for _, e := range vm.timeline(from) {
+			if e.Timestamp.Before(at) {
+				before = append(before, e)
+			}
+		}
+		events = append(before, events...)
+		path, until, seen[from] = from, at, true
+	}
+}
+
+// renamedFrom returns the path a file was last renamed from, and when,
+// ignoring renames after until unless it is zero.
+func (vm *VersionManager) renamedFrom(path string, until time.Time) (string, time.Time) {
+	var from string
+	var at time.Time
+	for _, fv := range vm.FileVersions[path] {
+		if fv.RenamedFrom != "" && (until.IsZero() || fv.Timestamp.Before(until)) {
+			from, at = fv.RenamedFrom, fv.Timestamp
+		}
+	}
+	return from, at
+}
+
+// FileHistory returns the history of a file of the current branch, oldest
+// first, including its history under the paths it was renamed from.
+func (vm *VersionManager) FileHistory(path string) []FileEvent {
+	vm.RLock()
+	defer vm.RUnlock()
+	return vm.history(path)
+}
+
+// point is a resolved point of the history of the current branch.
+type point struct {
+	// ref is the commit or version of the point, "" for a time.
+	ref string
+	at  time.Time
+	// files overrides the contents at the point, for commits and versions.
+	files map[string]FileVersion
+}
+
+// resolvePoint parses a point of the history: "commit:<id>",
+// "version:<id>", a time in RFC 3339, or "" for now.
+func (vm *VersionManager) resolvePoint(s string) (point, error) {
+	if s == "" {
+		return point{at: time.Now()}, nil
+	}
+	if at, err := time.Parse(time.RFC3339, s); err == nil {
+		return point{at: at}, nil
+	}
+	kind, rawID, _ := strings.Cut(s, ":")
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		return point{}, fmt.Errorf("%q: %w", s, ErrInvalidPoint)
+	}
+	switch kind {
+	case "commit":
+		for _, commit := range slices.Concat(vm.MergedCommits, vm.PendingCommits) {
+			if commit.ID == id && commit.Branch == vm.CurrentBranch {
+				return point{ref: s, at: commit.Timestamp, files: commit.Files}, nil
+			}
+		}
+		return point{}, fmt.Errorf("commit %d: %w", id, ErrCommitNotFound)
+	case "version":
+		ver, err := vm.findVersion(id)
+		if err != nil {
+			return point{}, err
+		}
+		return point{ref: s, at: ver.Timestamp, files: ver.Files}, nil
+	}
+	return point{}, fmt.Errorf("%q: %w", s, ErrInvalidPoint)
+}
+
+// eventsAt returns the events of a timeline up to a point. The events of
+// a version or commit point end with it; uncommitted changes made after
+// the last commit or version before it are left out.
+func eventsAt(events []FileEvent, p point) []FileEvent {
+	var out []FileEvent
+	for _, e := range events {
+		if e.Timestamp.After(p.at) {
+			break
+		}
+		out = append(out, e)
+		if p.ref != "" && e.Ref == p.ref {
+			break
+		}
+	}
+	if p.ref != "" {
+		for len(out) > 0 && !out[len(out)-1].committed() {
+			out = out[:len(out)-1]
+		}
+	}
+	return out
+}
+
+// filesAt returns the files of the current branch at a point, keyed by
+// path. Deleted files are left out.
+func (vm *VersionManager) filesAt(p point) map[string]string {
+	paths := make(map[string]bool)
+	for path := range vm.Branches[vm.CurrentBranch].Base {
+		paths[path] = true
+	}
+	for path := range vm.FileVersions {
+		paths[path] = true
+	}
+	for _, commit := range slices.Concat(vm.MergedCommits, vm.PendingCommits) {
+		if commit.Branch == vm.CurrentBranch {
+			for path := range commit.Files {
+				paths[path] = true
+			}
+		}
+	}
+	for _, ver := range vm.Versions {
+		if ver.Branch == vm.CurrentBranch {
+			for path := range ver.Files {
+				paths[path] = true
+			}
+		}
+	}
+	files := make(map[string]string)
+	for path := range paths {
+		if fv, ok := p.files[path]; ok {
+			if !fv.Deleted {
+				files[path] = fv.Content
+			}
+			continue
+		}
+		events := eventsAt(vm.timeline(path), p)
+		if len(events) == 0 {
+			continue
+		}
+		if last := events[len(events)-1]; !last.Deleted {
+			files[path] = last.Content
+		}
+	}
+	return files
+}
+
+// Blame returns the lines of a file of the current branch at a point (see
+// Diff) with the commit or version that introduced each of them. Lines
+// changed since the last commit are attributed to "change".
+func (vm *VersionManager) Blame(path, at string) ([]BlameLine, error) {
+	vm.RLock()
+	defer vm.RUnlock()
+	p, err := vm.resolvePoint(at)
+	if err != nil {
+		return nil, err
+	}
+	events := eventsAt(vm.history(path), p)
+	// Only the last uncommitted change counts: the earlier ones were either
+	// committed or replaced.
+	var committed []FileEvent
+	for i, e := range events {
+		if e.committed() || i == len(events)-1 {
+			committed = append(committed, e)
+		}
+	}
+	var lines []string
+	var owners []int
+	for i, e := range committed {
+		next := blameLines(e)
+		var nextOwners []int
+		pos := 0
+		for _, ed := range tokenEdits(lines, next) {
+			nextOwners = append(nextOwners, owners[pos:ed.start]...)
+			for range ed.tokens {
+				nextOwners = append(nextOwners, i)
+			}
+			pos = ed.end
+		}
+		lines, owners = next, append(nextOwners, owners[pos:]...)
+	}
+	blame := make([]BlameLine, len(lines))
+	for i, text := range lines {
+		e := committed[owners[i]]
+		blame[i] = BlameLine{Line: i + 1, Text: text, Ref: e.Ref, Timestamp: e.Timestamp, Author: e.Author, Message: e.Message}
+	}
+	return blame, nil
+}
+
+// blameLines returns the lines of the content of an event, ignoring
+// surrounding whitespace as commits do.
+func blameLines(e FileEvent) []string {
+	content := strings.TrimSpace(e.Content)
+	if e.Deleted || content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
+
+// Diff returns the diff per file from one point of the history of the
+// current branch to another, only for path when it is not "". A point is
+// "commit:<id>", "version:<id>", a time in RFC 3339, or "" for the latest
+// content.
+func (vm *VersionManager) Diff(from, to, path string) (map[string]string, error) {
+	vm.RLock()
+	defer vm.RUnlock()
+	pf, err := vm.resolvePoint(from)
+	if err != nil {
+		return nil, err
+	}
+	pt, err := vm.resolvePoint(to)
+	if err != nil {
+		return nil, err
+	}
+	a, b := vm.filesAt(pf), vm.filesAt(pt)
+	changes := make(map[string]string)
+	for _, file := range unionKeys(a, b) {
+		if path != "" && file != path {
+			continue
+		}
+		if strings.TrimSpace(a[file]) != strings.TrimSpace(b[file]) {
+			changes[file] = diffText(strings.TrimSpace(a[file]), strings.TrimSpace(b[file]))
+		}
+	}
+	return changes, nil
+}
+
+// Restore brings back the content of a file of the current branch at a
+// point (see Diff), or of every file when path is "", as uncommitted
+// changes to be committed as usual. Files below a watch root are written
+// back to disk, or removed if they did not exist at the point. It returns
+// the paths of the files restored, also when writing one fails.
+func (vm *VersionManager) Restore(path, at, actor string) ([]string, error) {
+	vm.Lock()
+	defer vm.Unlock()
+	p, err := vm.resolvePoint(at)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	target, current := vm.filesAt(p), vm.filesAt(point{at: now})
+	paths := unionKeys(current, target)
+	if path != "" {
+		paths = []string{path}
+	}
+	var restored []string
+	for _, file := range paths {
+		content, exists := target[file]
+		latest, existed := current[file]
+		if exists == existed && strings.TrimSpace(content) == strings.TrimSpace(latest) {
+			continue
+		}
+		if err = vm.writeWatched(file, content, exists); err != nil {
+			break
+		}
+		vm.LatestFiles[file] = content
+		vm.addFileVersion(file, FileVersion{Timestamp: now, Content: content, Deleted: !exists})
+		restored = append(restored, file)
+	}
+	if len(restored) == 0 {
+		return restored, err
+	}
+	targets := make([]string, 0, len(restored)+1)
+	for _, file := range restored {
+		targets = append(targets, auditRef("file", file))
+	}
+	vm.audit(AuditEntry{
+		Actor:   actor,
+		Action:  AuditFileRestore,
+		Targets: append(targets, auditRef("branch", vm.CurrentBranch)),
+		After:   at,
+		Message: fmt.Sprintf("Restored %d files to %s", len(restored), orNow(at)),
+	})
+	log.Info().Strs("files", restored).Str("at", orNow(at)).Msg("Restored files")
+	return restored, err
+}
+
+// orNow returns at, or "now" for the latest point.
+func orNow(at string) string {
+	if at == "" {
+		return "now"
+	}
+	return at
+}
+
+// writeWatched writes a restored file to disk when it is one of the watched
+// files, so that the watcher and editors see it, or removes it when it must
+// not exist.
+func (vm *VersionManager) writeWatched(path, content string, exists bool) error {
+	if !vm.watchConfig.Matches(path) {
+		return nil
+	}
+	if !exists {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
@@ -0,0 +1,593 @@
+package versioning
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/oarkflow/json"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Hunk is a region of a file changed differently by both sides of a merge.
+// Ours is the content the merge applies changes to, theirs the content of
+// the commit being merged and base the content that commit was made
+// against.
+type Hunk struct {
+	ID   int    `json:"id"`
+	File string `json:"file"`
+	// Path is the JSON pointer of the conflicting value for structurally
+	// merged JSON files.
+	Path string `json:"path,omitempty"`
+	// Line is the first line of the hunk in base, for line merges.
+	Line int `json:"line,omitempty"`
+	// Base, Ours and Theirs hold lines for line merges and JSON values for
+	// structural merges, where "" stands for a missing key.
+	Base   string `json:"base"`
+	Ours   string `json:"ours"`
+	Theirs string `json:"theirs"`
+	// Resolution is the content chosen for the hunk, nil while unresolved.
+	// For structural merges it is a JSON value, or "" to remove the key.
+	Resolution *string `json:"resolution,omitempty"`
+}
+
+// FileMerge is the merge of one file.
+type FileMerge struct {
+	// Parts is the line-merged content, as text and hunk references in
+	// order. It is empty for structural merges.
+	Parts []MergePart `json:"parts,omitempty"`
+	// Doc is the structurally merged JSON document, holding our side at
+	// conflicting paths, and Indent the indentation used to encode it.
+	Doc    json.RawMessage `json:"doc,omitempty"`
+	Indent string          `json:"indent,omitempty"`
+	// Deleted is set when the merged commits delete the file.
+	Deleted bool   `json:"deleted,omitempty"`
+	Hunks   []Hunk `json:"hunks,omitempty"`
+}
+
+// MergePart is merged text, or a reference to a hunk when Hunk is not 0.
+type MergePart struct {
+	Text string `json:"text,omitempty"`
+	Hunk int    `json:"hunk,omitempty"`
+}
+
+// PendingMerge is a merge waiting for its conflicts to be resolved.
+type PendingMerge struct {
+	Tag       string `json:"tag"`
+	Branch    string `json:"branch"`
+	CommitIDs []int  `json:"commitIds"`
+	// Source is the branch merged into Branch, as of its version
+	// SourceVersion, for merges between branches.
+	Source        string                `json:"source,omitempty"`
+	SourceVersion int                   `json:"sourceVersion,omitempty"`
+	Message       string                `json:"message"`
+	Files         map[string]*FileMerge `json:"files"`
+}
+
+// Hunks returns the hunks of every file, ordered by ID.
+func (m *PendingMerge) Hunks() []Hunk {
+	var hunks []Hunk
+	for _, fm := range m.Files {
+		hunks = append(hunks, fm.Hunks...)
+	}
+	slices.SortFunc(hunks, func(a, b Hunk) int { return a.ID - b.ID })
+	return hunks
+}
+
+// clone returns a deep copy of the merge.
+func (m *PendingMerge) clone() *PendingMerge {
+	c := *m
+	c.CommitIDs = slices.Clone(m.CommitIDs)
+	c.Files = make(map[string]*FileMerge, len(m.Files))
+	for path, fm := range m.Files {
+		f := *fm
+		f.Parts = slices.Clone(fm.Parts)
+		f.Doc = slices.Clone(fm.Doc)
+		f.Hunks = slices.Clone(fm.Hunks)
+		for i, h := range f.Hunks {
+			if h.Resolution != nil {
+				resolution := *h.Resolution
+				f.Hunks[i].Resolution = &resolution
+			}
+		}
+		c.Files[path] = &f
+	}
+	return &c
+}
+
+// hunk returns the hunk with the given ID.
+func (m *PendingMerge) hunk(id int) (*FileMerge, *Hunk) {
+	for _, fm := range m.Files {
+		for i := range fm.Hunks {
+			if fm.Hunks[i].ID == id {
+				return fm, &fm.Hunks[i]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Unresolved returns the number of hunks without a resolution.
+func (m *PendingMerge) Unresolved() int {
+	n := 0
+	for _, h := range m.Hunks() {
+		if h.Resolution == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// ConflictError is returned by a merge with conflicting hunks. The merge
+// stays pending until its hunks are resolved and it is completed, or until
+// it is aborted.
+type ConflictError struct {
+	Hunks []Hunk
+}
+
+func (e *ConflictError) Error() string {
+	var files []string
+	for _, h := range e.Hunks {
+		if !slices.Contains(files, h.File) {
+			files = append(files, h.File)
+		}
+	}
+	return fmt.Sprintf("merge conflict in files: %s (%d hunks)", strings.Join(files, ", "), len(e.Hunks))
+}
+
+// mergeFile merges the change from base to theirs into ours. JSON files
+// are merged by key path when all sides parse, other files by line. Hunk
+// IDs are allocated from next.
+func mergeFile(file, base, ours, theirs string, next *int) *FileMerge {
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		if fm, ok := mergeJSON(file, base, ours, theirs, next); ok {
+			return fm
+		}
+	}
+	return mergeLines(file, base, ours, theirs, next)
+}
+
+// render returns the merged content, using the resolution of each hunk.
+// Unresolved hunks keep our side.
+func (fm *FileMerge) render() (string, error) {
+	if fm.Doc != nil {
+		return fm.renderJSON()
+	}
+	resolutions := make(map[int]string, len(fm.Hunks))
+	for _, h := range fm.Hunks {
+		if h.Resolution != nil {
+			resolutions[h.ID] = *h.Resolution
+		} else {
+			resolutions[h.ID] = h.Ours
+		}
+	}
+	var out strings.Builder
+	for _, p := range fm.Parts {
+		if p.Hunk != 0 {
+			out.WriteString(resolutions[p.Hunk])
+			continue
+		}
+		out.WriteString(p.Text)
+	}
+	return out.String(), nil
+}
+
+// splitLines splits text after each newline.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// mergeLines performs a line-based three-way merge.
+func mergeLines(file, base, ours, theirs string, next *int) *FileMerge {
+	fm := &FileMerge{}
+	for _, c := range merge3(splitLines(base), splitLines(ours), splitLines(theirs)) {
+		if !c.conflict {
+			fm.Parts = append(fm.Parts, MergePart{Text: strings.Join(c.tokens, "")})
+			continue
+		}
+		*next++
+		fm.Hunks = append(fm.Hunks, Hunk{
+			ID:     *next,
+			File:   file,
+			Line:   c.start + 1,
+			Base:   strings.Join(c.base, ""),
+			Ours:   strings.Join(c.ours, ""),
+			Theirs: strings.Join(c.theirs, ""),
+		})
+		fm.Parts = append(fm.Parts, MergePart{Hunk: *next})
+	}
+	return fm
+}
+
+// edit replaces the tokens [start, end) of a base sequence with tokens.
+type edit struct {
+	start, end int
+	tokens     []string
+}
+
+// tokenEdits returns the edits turning base into other, diffing the token
+// sequences with diffmatchpatch by mapping each distinct token to a rune.
+func tokenEdits(base, other []string) []edit {
+	codes := make(map[string]rune)
+	encode := func(tokens []string) []rune {
+		out := make([]rune, len(tokens))
+		for i, t := range tokens {
+			r, ok := codes[t]
+			if !ok {
+				r = rune(len(codes)) + 0x100
+				if r >= 0xD800 {
+					r += 0x800 // skip surrogates
+				}
+				codes[t] = r
+			}
+			out[i] = r
+		}
+		return out
+	}
+	a, b := encode(base), encode(other)
+	diffs := diffmatchpatch.New().DiffMainRunes(a, b, false)
+	var edits []edit
+	pos, opos := 0, 0
+	for _, d := range diffs {
+		n := utf8.RuneCountInString(d.Text)
+		last := len(edits) - 1
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			pos += n
+			opos += n
+		case diffmatchpatch.DiffDelete:
+			if last >= 0 && edits[last].end == pos {
+				edits[last].end += n
+			} else {
+				edits = append(edits, edit{start: pos, end: pos + n})
+			}
+			pos += n
+		case diffmatchpatch.DiffInsert:
+			if last >= 0 && edits[last].end == pos {
+				edits[last].tokens = append(edits[last].tokens, other[opos:opos+n]...)
+			} else {
+				edits = append(edits, edit{start: pos, end: pos, tokens: append([]string(nil), other[opos:opos+n]...)})
+			}
+			opos += n
+		}
+	}
+	return edits
+}
+
+// chunk is a piece of a three-way merge: merged tokens, or a conflict
+// starting at token start of the base.
+type chunk struct {
+	tokens             []string
+	conflict           bool
+	start              int
+	base, ours, theirs []string
+}
+
+// merge3 merges the changes from base to ours and from base to theirs.
+// Changes to separate regions are combined; changes to the same region,
+// including insertions at the same point, conflict unless identical.
+func merge3(base, ours, theirs []string) []chunk {
+	oe, te := tokenEdits(base, ours), tokenEdits(base, theirs)
+	var chunks []chunk
+	emit := func(tokens []string) {
+		if len(tokens) == 0 {
+			return
+		}
+		if n := len(chunks); n > 0 && !chunks[n-1].conflict {
+			chunks[n-1].tokens = append(chunks[n-1].tokens, tokens...)
+			return
+		}
+		chunks = append(chunks, chunk{tokens: append([]string(nil), tokens...)})
+	}
+	pos, i, j := 0, 0, 0
+	for i < len(oe) || j < len(te) {
+		var start, end int
+		var os, ts []edit
+		if j >= len(te) || (i < len(oe) && oe[i].start <= te[j].start) {
+			start, end = oe[i].start, oe[i].end
+			os = append(os, oe[i])
+			i++
+		} else {
+			start, end = te[j].start, te[j].end
+			ts = append(ts, te[j])
+			j++
+		}
+		overlaps := func(e edit) bool { return e.start < end || e.start == start }
+		for {
+			if i < len(oe) && overlaps(oe[i]) {
+				os = append(os, oe[i])
+				end = max(end, oe[i].end)
+				i++
+			} else if j < len(te) && overlaps(te[j]) {
+				ts = append(ts, te[j])
+				end = max(end, te[j].end)
+				j++
+			} else {
+				break
+			}
+		}
+		emit(base[pos:start])
+		oursRegion := applyEdits(base, start, end, os)
+		theirsRegion := applyEdits(base, start, end, ts)
+		switch {
+		case len(ts) == 0:
+			emit(oursRegion)
+		case len(os) == 0, slices.Equal(oursRegion, theirsRegion):
+			emit(theirsRegion)
+		default:
+			chunks = append(chunks, chunk{conflict: true, start: start, base: base[start:end], ours: oursRegion, theirs: theirsRegion})
+		}
+		pos = end
+	}
+	emit(base[pos:])
+	return chunks
+}
+
+// applyEdits returns base[start:end] with the edits applied.
+func applyEdits(base []string, start, end int, edits []edit) []string {
+	var out []string
+	k := start
+	for _, e := range edits {
+		out = append(out, base[k:e.start]...)
+		out = append(out, e.tokens...)
+		k = e.end
+	}
+	return append(out, base[k:end]...)
+}
+
+// missing stands for a key absent from one side of a structural merge.
+type missing struct{}
+
+// decodeJSON decodes a document keeping numbers as written. An empty
+// document is missing.
+func decodeJSON(text string) (any, bool) {
+	if strings.TrimSpace(text) == "" {
+		return missing{}, true
+	}
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return nil, false
+	}
+	return v, true
+}
+
+// canonical returns a comparable encoding of a value.
+func canonical(v any) string {
+	if _, ok := v.(missing); ok {
+		return ""
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// encodeValue encodes a hunk side, "" for a missing value.
+func encodeValue(v any, indent string) string {
+	if _, ok := v.(missing); ok {
+		return ""
+	}
+	data, _ := json.MarshalIndent(v, "", indent)
+	return string(data)
+}
+
+// jsonIndent guesses the indentation of a document.
+func jsonIndent(texts ...string) string {
+	for _, text := range texts {
+		for _, line := range strings.Split(text, "\n")[1:] {
+			if trimmed := strings.TrimLeft(line, " \t"); trimmed != "" && len(trimmed) < len(line) {
+				return line[:len(line)-len(trimmed)]
+			}
+		}
+	}
+	return "    "
+}
+
+// mergeJSON merges JSON documents by key path. Objects are merged key by
+// key and arrays element by element; values changed differently on both
+// sides become hunks. ok is false if a side is not valid JSON.
+func mergeJSON(file, base, ours, theirs string, next *int) (*FileMerge, bool) {
+	b, okB := decodeJSON(base)
+	o, okO := decodeJSON(ours)
+	t, okT := decodeJSON(theirs)
+	if !okB || !okO || !okT {
+		return nil, false
+	}
+	fm := &FileMerge{Indent: jsonIndent(ours, theirs, base)}
+	merged := mergeValue(fm, file, "", b, o, t, next)
+	if _, ok := merged.(missing); ok {
+		merged = nil
+	}
+	doc, err := json.Marshal(merged)
+	if err != nil {
+		return nil, false
+	}
+	fm.Doc = doc
+	if len(fm.Hunks) == 0 {
+		switch canonical(merged) {
+		case canonical(o):
+			fm.Doc, fm.Parts = nil, []MergePart{{Text: ours}}
+		case canonical(t):
+			fm.Doc, fm.Parts = nil, []MergePart{{Text: theirs}}
+		}
+	}
+	return fm, true
+}
+
+// mergeValue merges the value at path and records conflicts as hunks of fm.
+func mergeValue(fm *FileMerge, file, path string, base, ours, theirs any, next *int) any {
+	cb, co, ct := canonical(base), canonical(ours), canonical(theirs)
+	switch {
+	case co == ct, cb == ct:
+		return ours
+	case cb == co:
+		return theirs
+	}
+	if om, ok := ours.(map[string]any); ok {
+		if tm, ok := theirs.(map[string]any); ok {
+			bm, _ := base.(map[string]any)
+			out := make(map[string]any, len(om))
+			keys := make(map[string]bool)
+			for _, m := range []map[string]any{bm, om, tm} {
+				for k := range m {
+					keys[k] = true
+				}
+			}
+			for k := range keys {
+				v := mergeValue(fm, file, path+"/"+escapePointer(k), member(bm, k), member(om, k), member(tm, k), next)
+				if _, gone := v.(missing); !gone {
+					out[k] = v
+				}
+			}
+			return out
+		}
+	}
+	if ol, ok := ours.([]any); ok {
+		if tl, ok := theirs.([]any); ok {
+			bl, _ := base.([]any)
+			if merged, ok := mergeArray(fm, file, path, bl, ol, tl, next); ok {
+				return merged
+			}
+		}
+	}
+	*next++
+	fm.Hunks = append(fm.Hunks, Hunk{
+		ID:     *next,
+		File:   file,
+		Path:   path,
+		Base:   encodeValue(base, fm.Indent),
+		Ours:   encodeValue(ours, fm.Indent),
+		Theirs: encodeValue(theirs, fm.Indent),
+	})
+	return ours
+}
+
+// mergeArray merges arrays as sequences of elements. Conflicting regions
+// of the same length on all sides are merged element by element; ok is
+// false for other conflicts, which make the whole array conflict.
+func mergeArray(fm *FileMerge, file, path string, base, ours, theirs []any, next *int) ([]any, bool) {
+	values := make(map[string]any)
+	tokens := func(list []any) []string {
+		out := make([]string, len(list))
+		for i, v := range list {
+			out[i] = canonical(v)
+			values[out[i]] = v
+		}
+		return out
+	}
+	chunks := merge3(tokens(base), tokens(ours), tokens(theirs))
+	for _, c := range chunks {
+		if c.conflict && (len(c.base) != len(c.ours) || len(c.base) != len(c.theirs)) {
+			return nil, false
+		}
+	}
+	var out []any
+	for _, c := range chunks {
+		if !c.conflict {
+			for _, t := range c.tokens {
+				out = append(out, values[t])
+			}
+			continue
+		}
+		for k := range c.base {
+			index := strconv.Itoa(len(out))
+			out = append(out, mergeValue(fm, file, path+"/"+index, values[c.base[k]], values[c.ours[k]], values[c.theirs[k]], next))
+		}
+	}
+	if out == nil {
+		out = []any{}
+	}
+	return out, true
+}
+
+// member returns m[k], or missing.
+func member(m map[string]any, k string) any {
+	if v, ok := m[k]; ok {
+		return v
+	}
+	return missing{}
+}
+
+// escapePointer escapes a JSON pointer token.
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+// unescapePointer reverses escapePointer.
+func unescapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+}
+
+// renderJSON encodes the merged document with the resolutions applied.
+// Hunks are applied last to first, so that removing an array element does
+// not shift the elements later hunks point at.
+func (fm *FileMerge) renderJSON() (string, error) {
+	doc, ok := decodeJSON(string(fm.Doc))
+	if !ok {
+		return "", fmt.Errorf("invalid merged document")
+	}
+	for i := len(fm.Hunks) - 1; i >= 0; i-- {
+		h := fm.Hunks[i]
+		if h.Resolution == nil {
+			continue
+		}
+		value, ok := decodeJSON(*h.Resolution)
+		if !ok {
+			return "", fmt.Errorf("hunk %d: invalid JSON resolution", h.ID)
+		}
+		doc = setPointer(doc, h.Path, value)
+	}
+	if _, ok := doc.(missing); ok {
+		return "", nil
+	}
+	data, err := json.MarshalIndent(doc, "", fm.Indent)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// setPointer sets, or removes for a missing value, the value at a JSON
+// pointer and returns the updated document.
+func setPointer(doc any, pointer string, value any) any {
+	if pointer == "" {
+		return value
+	}
+	token, rest, more := strings.Cut(pointer[1:], "/")
+	key := unescapePointer(token)
+	_, remove := value.(missing)
+	switch node := doc.(type) {
+	case map[string]any:
+		switch {
+		case more:
+			node[key] = setPointer(node[key], "/"+rest, value)
+		case remove:
+			delete(node, key)
+		default:
+			node[key] = value
+		}
+		return node
+	case []any:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(node) {
+			return node
+		}
+		switch {
+		case more:
+			node[i] = setPointer(node[i], "/"+rest, value)
+		case remove:
+			return append(node[:i], node[i+1:]...)
+		default:
+			node[i] = value
+		}
+		return node
+	}
+	return doc
+}
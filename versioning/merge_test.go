@@ -0,0 +1,135 @@
+package versioning
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/json"
+)
+
+func TestMergeLines(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		hunks              int
+	}{
+		{
+			name: "separate regions",
+			base: "a\nb\nc\nd\n", ours: "A\nb\nc\nd\n", theirs: "a\nb\nc\nD\n",
+			want: "A\nb\nc\nD\n",
+		},
+		{
+			name: "identical changes",
+			base: "a\nb\n", ours: "a\nB\n", theirs: "a\nB\n",
+			want: "a\nB\n",
+		},
+		{
+			name: "only theirs",
+			base: "a\nb\n", ours: "a\nb\n", theirs: "a\nb\nc\n",
+			want: "a\nb\nc\n",
+		},
+		{
+			name: "same line",
+			base: "a\nb\nc\n", ours: "a\nours\nc\n", theirs: "a\ntheirs\nc\n",
+			want: "a\nours\nc\n", hunks: 1,
+		},
+		{
+			name: "insertions at the same point",
+			base: "a\nb\n", ours: "a\nx\nb\n", theirs: "a\ny\nb\n",
+			want: "a\nx\nb\n", hunks: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := 0
+			fm := mergeLines("f.txt", tt.base, tt.ours, tt.theirs, &next)
+			if len(fm.Hunks) != tt.hunks {
+				t.Fatalf("hunks = %+v, want %d", fm.Hunks, tt.hunks)
+			}
+			got, err := fm.render()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("merged = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeLinesConflictHunk(t *testing.T) {
+	next := 0
+	fm := mergeLines("f.txt", "a\nb\nc\n", "a\nours\nc\n", "a\ntheirs\nc\n", &next)
+	h := fm.Hunks[0]
+	if h.Line != 2 || h.Base != "b\n" || h.Ours != "ours\n" || h.Theirs != "theirs\n" {
+		t.Errorf("hunk = %+v", h)
+	}
+	resolution := "both\n"
+	fm.Hunks[0].Resolution = &resolution
+	if got, _ := fm.render(); got != "a\nboth\nc\n" {
+		t.Errorf("resolved = %q", got)
+	}
+}
+
+func TestMergeJSON(t *testing.T) {
+	base := `{"port": 8080, "host": "a", "tags": ["x", "y"]}`
+	ours := `{"port": 8081, "host": "a", "tags": ["x", "y"]}`
+	theirs := `{"port": 8080, "host": "b", "tags": ["x", "y", "z"], "debug": true}`
+	next := 0
+	fm, ok := mergeJSON("cfg.json", base, ours, theirs, &next)
+	if !ok {
+		t.Fatal("not merged as JSON")
+	}
+	if len(fm.Hunks) != 0 {
+		t.Fatalf("hunks = %+v, want none", fm.Hunks)
+	}
+	got, err := fm.render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(got), &doc); err != nil {
+		t.Fatalf("merged document %q: %v", got, err)
+	}
+	if doc["port"] != float64(8081) || doc["host"] != "b" || doc["debug"] != true || len(doc["tags"].([]any)) != 3 {
+		t.Errorf("merged = %s", got)
+	}
+}
+
+func TestMergeJSONConflict(t *testing.T) {
+	next := 0
+	fm, ok := mergeJSON("cfg.json", `{"db": {"port": 1}}`, `{"db": {"port": 2}}`, `{"db": {"port": 3}}`, &next)
+	if !ok {
+		t.Fatal("not merged as JSON")
+	}
+	if len(fm.Hunks) != 1 {
+		t.Fatalf("hunks = %+v, want 1", fm.Hunks)
+	}
+	h := fm.Hunks[0]
+	if h.Path != "/db/port" || h.Base != "1" || h.Ours != "2" || h.Theirs != "3" {
+		t.Errorf("hunk = %+v", h)
+	}
+	resolution := "4"
+	fm.Hunks[0].Resolution = &resolution
+	got, err := fm.render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, `"port": 4`) {
+		t.Errorf("resolved = %s", got)
+	}
+}
+
+func TestCurrentMergeIsACopy(t *testing.T) {
+	next := 0
+	vm := &VersionManager{Merge: &PendingMerge{Files: map[string]*FileMerge{
+		"f.txt": mergeLines("f.txt", "a\n", "b\n", "c\n", &next),
+	}}}
+	merge := vm.CurrentMerge()
+	resolution := "d\n"
+	merge.Files["f.txt"].Hunks[0].Resolution = &resolution
+	if vm.Merge.Unresolved() != 1 {
+		t.Errorf("resolving a hunk of the copy resolved the pending merge")
+	}
+}
@@ -0,0 +1,297 @@
+package versioning
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/oarkflow/log"
+)
+
+// Signature errors.
+var (
+	ErrUnsignedVersion  = errors.New("version is not signed")
+	ErrInvalidSignature = errors.New("invalid version signature")
+)
+
+// Signature signs the content and metadata of a version, see
+// VersionManager.VerifyVersion.
+type Signature struct {
+	// KeyID identifies the public key verifying the signature, see KeyID.
+	KeyID  string    `json:"keyId"`
+	Value  []byte    `json:"value"`
+	Signer string    `json:"signer,omitempty"`
+	Signed time.Time `json:"signed"`
+}
+
+// SignaturePolicy decides which versions may be deployed.
+type SignaturePolicy int
+
+const (
+	// SignaturesVerified refuses versions whose signature does not verify
+	// against a trusted key. Unsigned versions are deployed.
+	SignaturesVerified SignaturePolicy = iota
+	// SignaturesRequired also refuses unsigned versions.
+	SignaturesRequired
+	// SignaturesIgnored deploys every version.
+	SignaturesIgnored
+)
+
+// WithSigningKey signs every version merged with key. Its public key is
+// trusted.
+//
+// Optional. Default: versions are not signed
+func WithSigningKey(key ed25519.PrivateKey) Option {
+	return func(vm *VersionManager) {
+		vm.signingKey = key
+	}
+}
+
+// WithTrustedKeys trusts the signatures of keys, e.g. those of the
+// instances merging the versions deployed by this one.
+func WithTrustedKeys(keys ...ed25519.PublicKey) Option {
+	return func(vm *VersionManager) {
+		vm.trustedKeys = append(vm.trustedKeys, keys...)
+	}
+}
+
+// WithSignaturePolicy sets which versions may be deployed, promoted and
+// rolled back to.
+//
+// Optional. Default: SignaturesRequired when a signing key or trusted keys
+// are set, SignaturesVerified otherwise
+func WithSignaturePolicy(p SignaturePolicy) Option {
+	return func(vm *VersionManager) {
+		vm.signaturePolicy = p
+		vm.policySet = true
+	}
+}
+
+// GenerateKey creates an ed25519 key pair and writes the private key to
+// path, readable by its owner only, and the public key to path + ".pub".
+func GenerateKey(path string) (ed25519.PrivateKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		return nil, err
+	}
+	return priv, nil
+}
+
+// LoadPrivateKey reads a PEM encoded PKCS #8 ed25519 private key, as
+// written by GenerateKey or "openssl genpkey -algorithm ed25519".
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ed25519 key", path)
+	}
+	return priv, nil
+}
+
+// LoadPublicKey reads a PEM encoded PKIX ed25519 public key, as written by
+// GenerateKey or "openssl pkey -pubout".
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ed25519 key", path)
+	}
+	return pub, nil
+}
+
+// LoadTrustedKeys reads every public key of dir whose name ends in ".pub".
+func LoadTrustedKeys(dir string) ([]ed25519.PublicKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pub"))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]ed25519.PublicKey, 0, len(paths))
+	for _, path := range paths {
+		key, err := LoadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// readPEM returns the content of the first PEM block of a file, which must
+// be of type typ.
+func readPEM(path, typ string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != typ {
+		return nil, fmt.Errorf("%s: no %s PEM block", path, typ)
+	}
+	return block.Bytes, nil
+}
+
+// KeyID returns the identifier of a public key in signatures: the first 16
+// hex digits of its SHA-256.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// contentSet returns the files of the configuration set as of ver, keyed
+// by path. Deleted files are left out.
+func (vm *VersionManager) contentSet(ver VersionGroup) map[string]string {
+	// ver is applied explicitly, as it may not be one of vm.Versions yet.
+	files := vm.branchFiles(ver.Branch, ver.ID-1)
+	for path, fv := range ver.Files {
+		if fv.Deleted {
+			delete(files, path)
+			continue
+		}
+		files[path] = fv.Content
+	}
+	return files
+}
+
+// digest returns what the signature of ver signs: its metadata, the signer
+// and signing time of the signature and the hash of every file of its
+// configuration set, as deployed, so that a signed version cannot be
+// deployed with other contents. Paths are relative
+// to the watch root, so that signatures hold in the instances a version is
+// imported into.
+func (vm *VersionManager) digest(ver VersionGroup) []byte {
+	return digestFiles(ver, vm.snapshot(ver))
+}
+
+// digestFiles returns the digest of ver with the configuration set files,
+// keyed by path relative to the watch root.
+func digestFiles(ver VersionGroup, files map[string]string) []byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "version %d\ntag %q\nbranch %q\nmessage %q\ntimestamp %s\n",
+		ver.ID, ver.Tag, ver.Branch, ver.CommitMessage, ver.Timestamp.UTC().Format(time.RFC3339Nano))
+	if sig := ver.Signature; sig != nil {
+		fmt.Fprintf(h, "signer %q\nsigned %s\n", sig.Signer, sig.Signed.UTC().Format(time.RFC3339Nano))
+	}
+	for _, path := range slices.Sorted(maps.Keys(files)) {
+		sum := sha256.Sum256([]byte(files[path]))
+		fmt.Fprintf(h, "file %q %x\n", path, sum)
+	}
+	return h.Sum(nil)
+}
+
+// sign signs ver with the signing key, if one is configured.
+func (vm *VersionManager) sign(ver *VersionGroup, actor string) {
+	if vm.signingKey == nil {
+		return
+	}
+	ver.Signature = &Signature{
+		KeyID:  KeyID(vm.signingKey.Public().(ed25519.PublicKey)),
+		Signer: actor,
+		Signed: time.Now(),
+	}
+	ver.Signature.Value = ed25519.Sign(vm.signingKey, vm.digest(*ver))
+}
+
+// trustedKey returns the trusted public key of a key ID.
+func (vm *VersionManager) trustedKey(id string) (ed25519.PublicKey, bool) {
+	if vm.signingKey != nil {
+		if pub := vm.signingKey.Public().(ed25519.PublicKey); KeyID(pub) == id {
+			return pub, true
+		}
+	}
+	for _, key := range vm.trustedKeys {
+		if KeyID(key) == id {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// verify checks the signature of ver. Unsigned versions return
+// ErrUnsignedVersion.
+func (vm *VersionManager) verify(ver VersionGroup) error {
+	return vm.verifyDigest(ver, vm.digest(ver))
+}
+
+// verifyDigest checks that the signature of ver signs digest.
+func (vm *VersionManager) verifyDigest(ver VersionGroup, digest []byte) error {
+	sig := ver.Signature
+	if sig == nil {
+		return fmt.Errorf("version %d: %w", ver.ID, ErrUnsignedVersion)
+	}
+	key, ok := vm.trustedKey(sig.KeyID)
+	if !ok {
+		return fmt.Errorf("version %d: %w: key %s is not trusted", ver.ID, ErrInvalidSignature, sig.KeyID)
+	}
+	if !ed25519.Verify(key, digest, sig.Value) {
+		return fmt.Errorf("version %d: %w: content or metadata changed since it was signed", ver.ID, ErrInvalidSignature)
+	}
+	return nil
+}
+
+// checkSignature applies the signature policy to a version about to be
+// deployed.
+func (vm *VersionManager) checkSignature(ver VersionGroup) error {
+	switch vm.signaturePolicy {
+	case SignaturesIgnored:
+		return nil
+	case SignaturesVerified:
+		if ver.Signature == nil {
+			return nil
+		}
+	}
+	if err := vm.verify(ver); err != nil {
+		log.Warn().Err(err).Int("version", ver.ID).Msg("Refused version")
+		return err
+	}
+	return nil
+}
+
+// VerifyVersion checks that a version is signed by a trusted key and that
+// its configuration set and metadata did not change since.
+func (vm *VersionManager) VerifyVersion(versionID int) error {
+	vm.RLock()
+	defer vm.RUnlock()
+	ver, err := vm.versionByID(versionID)
+	if err != nil {
+		return err
+	}
+	return vm.verify(*ver)
+}
@@ -0,0 +1,61 @@
+package versioning
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func newSigningManager(t *testing.T, opts ...Option) *VersionManager {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	opts = append([]Option{
+		WithStoragePath(filepath.Join(dir, "versions.db")),
+		WithDeployDir(filepath.Join(dir, "prod")),
+		WithSigningKey(key),
+	}, opts...)
+	vm, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { vm.Close() })
+	vm.UpdateFile("api.json", `{"a":1}`, false)
+	vm.CreateCommit([]string{"api.json"}, "add api", "alice")
+	if _, err := vm.MergeCommits("v1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	return vm
+}
+
+func TestSigningKeyRequiresSignatures(t *testing.T) {
+	vm := newSigningManager(t)
+	vm.Versions[0].Signature = nil
+	if err := vm.RollbackDeployment(vm.Versions[0].ID, "alice"); !errors.Is(err, ErrUnsignedVersion) {
+		t.Errorf("deploy of a version stripped of its signature: err = %v, want %v", err, ErrUnsignedVersion)
+	}
+
+	vm = newSigningManager(t, WithSignaturePolicy(SignaturesVerified))
+	vm.Versions[0].Signature = nil
+	if err := vm.RollbackDeployment(vm.Versions[0].ID, "alice"); err != nil {
+		t.Errorf("deploy of an unsigned version with SignaturesVerified: %v", err)
+	}
+}
+
+func TestSignatureCoversSigner(t *testing.T) {
+	vm := newSigningManager(t)
+	if err := vm.VerifyVersion(vm.Versions[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	sig := *vm.Versions[0].Signature
+	sig.Signer = "mallory"
+	vm.Versions[0].Signature = &sig
+	if err := vm.VerifyVersion(vm.Versions[0].ID); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("verify with a changed signer: err = %v, want %v", err, ErrInvalidSignature)
+	}
+}
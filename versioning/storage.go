@@ -0,0 +1,972 @@
+package versioning
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/oarkflow/json"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// Buckets of the storage. Commits, versions and audit entries are keyed by
+// their ID as a big-endian uint64, so that they iterate in order, and the
+// bucket sequence holds the last ID allocated. File contents are stored once
+// in the blobs bucket, keyed by their SHA-256, and referenced by hash.
+const (
+	metaBucket     = "Meta"
+	blobsBucket    = "Blobs"
+	commitsBucket  = "Commits"
+	versionsBucket = "Versions"
+	filesBucket    = "Files"
+	branchesBucket = "Branches"
+	auditBucket    = "Audit"
+	envsBucket     = "Environments"
+
+	metaKey       = "manager"
+	schemaVersion = 2
+
+	// legacyBucket and legacyKey hold the whole state as one JSON document
+	// in storages written before schema version 2.
+	legacyBucket = "State"
+	legacyKey    = "manager"
+)
+
+var buckets = []string{metaBucket, blobsBucket, commitsBucket, versionsBucket, filesBucket, branchesBucket, auditBucket, envsBucket}
+
+// ManagerState holds all persistent state.
+type ManagerState struct {
+	LatestFiles     map[string]string            `json:"latestFiles"`
+	FileVersions    map[string][]FileVersion     `json:"fileVersions"`
+	PendingCommits  []Commit                     `json:"pendingCommits"`
+	MergedCommits   []Commit                     `json:"mergedCommits,omitempty"`
+	CommittedFiles  map[string]string            `json:"committedFiles"`
+	Versions        []VersionGroup               `json:"versions"`
+	NextCommitID    int                          `json:"nextCommitId"`
+	NextVerID       int                          `json:"nextVerId"`
+	CurrentBranch   string                       `json:"currentBranch"`
+	AuditLog        []AuditEntry                 `json:"auditLog"`
+	DeployedVersion *VersionGroup                `json:"deployedVersion,omitempty"`
+	Environments    map[string]*EnvironmentState `json:"environments,omitempty"`
+	Merge           *PendingMerge                `json:"merge,omitempty"`
+	Branches        map[string]*Branch           `json:"branches,omitempty"`
+	DeletedBranches map[string]*Branch           `json:"deletedBranches,omitempty"`
+	// AuditOffset is the number of audit entries dropped by retention
+	// before AuditLog[0].
+	AuditOffset int `json:"auditOffset,omitempty"`
+}
+
+// errNoState is returned by LoadState when nothing has been saved yet.
+var errNoState = errors.New("state not found")
+
+// storedVersion is a FileVersion whose contents are blob references.
+type storedVersion struct {
+	Timestamp time.Time `json:"timestamp"`
+	Content   string    `json:"content,omitempty"`
+	Diff      string    `json:"diff,omitempty"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	Base      string    `json:"base,omitempty"`
+	// RenamedFrom is the FileVersion.RenamedFrom of the version.
+	RenamedFrom string `json:"renamedFrom,omitempty"`
+}
+
+// storedCommit is a Commit or a VersionGroup whose file contents are blob
+// references.
+type storedCommit struct {
+	ID        int                      `json:"id"`
+	Tag       string                   `json:"tag,omitempty"`
+	Message   string                   `json:"message,omitempty"`
+	Timestamp time.Time                `json:"timestamp"`
+	Branch    string                   `json:"branch"`
+	Files     map[string]storedVersion `json:"files"`
+	Signature *Signature               `json:"signature,omitempty"`
+	Author    string                   `json:"author,omitempty"`
+	Version   int                      `json:"version,omitempty"`
+}
+
+// storedFile is the working state of a file of the current branch, with
+// blob references. Latest and Committed are nil when the file is missing
+// from LatestFiles or CommittedFiles.
+type storedFile struct {
+	Latest    *string         `json:"latest,omitempty"`
+	Committed *string         `json:"committed,omitempty"`
+	Versions  []storedVersion `json:"versions,omitempty"`
+}
+
+// storedBranch is a Branch whose file contents are blob references.
+type storedBranch struct {
+	Name           string                       `json:"name"`
+	Deleted        bool                         `json:"deleted,omitempty"`
+	From           string                       `json:"from,omitempty"`
+	Created        time.Time                    `json:"created"`
+	Base           map[string]string            `json:"base,omitempty"`
+	MergeBases     map[string]map[string]string `json:"mergeBases,omitempty"`
+	LatestFiles    map[string]string            `json:"latestFiles,omitempty"`
+	FileVersions   map[string][]storedVersion   `json:"fileVersions,omitempty"`
+	CommittedFiles map[string]string            `json:"committedFiles,omitempty"`
+}
+
+// storedMeta holds the scalar state.
+type storedMeta struct {
+	Schema          int           `json:"schema"`
+	CurrentBranch   string        `json:"currentBranch"`
+	DeployedVersion int           `json:"deployedVersion,omitempty"`
+	Merge           *PendingMerge `json:"merge,omitempty"`
+}
+
+// storageCache remembers what is stored, so that SaveState only writes what
+// changed.
+type storageCache struct {
+	blobs map[string]bool
+	// commits holds the version each stored commit was merged into, -1
+	// when unknown.
+	commits  map[int]int
+	versions map[int]bool
+	// files and branches hold a fingerprint of each stored file and branch.
+	files    map[string]string
+	branches map[string]string
+	// audit is the ID of the last stored audit entry.
+	audit int
+	// envs holds the encoded state of each stored environment.
+	envs map[string]string
+	meta string
+}
+
+// Storage persists the manager state in a bbolt database, with one bucket
+// per entity.
+type Storage struct {
+	db    *bbolt.DB
+	path  string
+	cache *storageCache
+}
+
+// NewStorage opens (or creates) a bbolt database and ensures the buckets
+// exist.
+func NewStorage(path string) (*Storage, error) {
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{db: db, path: path}, nil
+}
+
+func openDB(path string) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// itob encodes an ID as a bucket key.
+func itob(id int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
+
+// btoi decodes a bucket key into an ID.
+func btoi(b []byte) int {
+	return int(binary.BigEndian.Uint64(b))
+}
+
+// blobRef returns the reference of a content, "" for empty contents.
+func blobRef(content string) string {
+	if content == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadCache builds the cache from the stored keys. Files and branches get
+// no fingerprint, so that the next save rewrites them.
+func (s *Storage) loadCache(tx *bbolt.Tx) *storageCache {
+	c := &storageCache{
+		blobs:    make(map[string]bool),
+		commits:  make(map[int]int),
+		versions: make(map[int]bool),
+		files:    make(map[string]string),
+		branches: make(map[string]string),
+		envs:     make(map[string]string),
+	}
+	tx.Bucket([]byte(blobsBucket)).ForEach(func(k, _ []byte) error {
+		c.blobs[string(k)] = true
+		return nil
+	})
+	tx.Bucket([]byte(commitsBucket)).ForEach(func(k, _ []byte) error {
+		c.commits[btoi(k)] = -1
+		return nil
+	})
+	tx.Bucket([]byte(versionsBucket)).ForEach(func(k, _ []byte) error {
+		c.versions[btoi(k)] = true
+		return nil
+	})
+	tx.Bucket([]byte(filesBucket)).ForEach(func(k, _ []byte) error {
+		c.files[string(k)] = ""
+		return nil
+	})
+	tx.Bucket([]byte(branchesBucket)).ForEach(func(k, _ []byte) error {
+		c.branches[string(k)] = ""
+		return nil
+	})
+	if k, _ := tx.Bucket([]byte(auditBucket)).Cursor().Last(); k != nil {
+		c.audit = btoi(k)
+	}
+	return c
+}
+
+// storageWriter writes a state within a transaction.
+type storageWriter struct {
+	tx    *bbolt.Tx
+	cache *storageCache
+}
+
+// blob stores a content if it is not stored yet and returns its reference.
+func (w *storageWriter) blob(content string) (string, error) {
+	ref := blobRef(content)
+	if ref == "" || w.cache.blobs[ref] {
+		return ref, nil
+	}
+	if err := w.tx.Bucket([]byte(blobsBucket)).Put([]byte(ref), []byte(content)); err != nil {
+		return "", err
+	}
+	w.cache.blobs[ref] = true
+	return ref, nil
+}
+
+func (w *storageWriter) version(fv FileVersion) (storedVersion, error) {
+	content, err := w.blob(fv.Content)
+	if err != nil {
+		return storedVersion{}, err
+	}
+	base, err := w.blob(fv.Base)
+	if err != nil {
+		return storedVersion{}, err
+	}
+	return storedVersion{Timestamp: fv.Timestamp, Content: content, Diff: fv.Diff, Deleted: fv.Deleted, Base: base, RenamedFrom: fv.RenamedFrom}, nil
+}
+
+func (w *storageWriter) versions(fvs []FileVersion) ([]storedVersion, error) {
+	stored := make([]storedVersion, len(fvs))
+	for i, fv := range fvs {
+		var err error
+		if stored[i], err = w.version(fv); err != nil {
+			return nil, err
+		}
+	}
+	return stored, nil
+}
+
+func (w *storageWriter) files(files map[string]FileVersion) (map[string]storedVersion, error) {
+	stored := make(map[string]storedVersion, len(files))
+	for path, fv := range files {
+		sv, err := w.version(fv)
+		if err != nil {
+			return nil, err
+		}
+		stored[path] = sv
+	}
+	return stored, nil
+}
+
+func (w *storageWriter) contents(files map[string]string) (map[string]string, error) {
+	if files == nil {
+		return nil, nil
+	}
+	refs := make(map[string]string, len(files))
+	for path, content := range files {
+		ref, err := w.blob(content)
+		if err != nil {
+			return nil, err
+		}
+		refs[path] = ref
+	}
+	return refs, nil
+}
+
+func (w *storageWriter) put(bucket string, key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return w.tx.Bucket([]byte(bucket)).Put(key, data)
+}
+
+// fingerprint identifies the working state of a file by the hashes of its
+// contents, so that any change to them, even one keeping their length, is
+// saved.
+func fingerprint(state ManagerState, path string) string {
+	h := sha256.New()
+	if latest, ok := state.LatestFiles[path]; ok {
+		fmt.Fprintf(h, "latest %s\n", blobRef(latest))
+	}
+	if committed, ok := state.CommittedFiles[path]; ok {
+		fmt.Fprintf(h, "committed %s\n", blobRef(committed))
+	}
+	fingerprintVersions(h, state.FileVersions[path])
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// branchFingerprint identifies the state of a branch by the hashes of its
+// contents.
+func branchFingerprint(b *Branch, deleted bool) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "from %q %d %t\n", b.From, b.Created.UnixNano(), deleted)
+	fingerprintFiles(h, "base", b.Base)
+	fingerprintFiles(h, "latest", b.LatestFiles)
+	fingerprintFiles(h, "committed", b.CommittedFiles)
+	for _, path := range slices.Sorted(maps.Keys(b.FileVersions)) {
+		fmt.Fprintf(h, "versions %q\n", path)
+		fingerprintVersions(h, b.FileVersions[path])
+	}
+	for _, other := range slices.Sorted(maps.Keys(b.MergeBases)) {
+		fingerprintFiles(h, "mergeBase "+other, b.MergeBases[other])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fingerprintFiles writes the path and content hash of each file to h.
+func fingerprintFiles(h io.Writer, kind string, files map[string]string) {
+	for _, path := range slices.Sorted(maps.Keys(files)) {
+		fmt.Fprintf(h, "%s %q %s\n", kind, path, blobRef(files[path]))
+	}
+}
+
+// fingerprintVersions writes the metadata and content hashes of each
+// version of a file to h.
+func fingerprintVersions(h io.Writer, fvs []FileVersion) {
+	for _, fv := range fvs {
+		fmt.Fprintf(h, "version %d %t %s %s %s %q\n", fv.Timestamp.UnixNano(), fv.Deleted,
+			blobRef(fv.Content), blobRef(fv.Base), blobRef(fv.Diff), fv.RenamedFrom)
+	}
+}
+
+// SaveState persists a ManagerState. Only the entities that changed since
+// the previous save are written.
+func (s *Storage) SaveState(state ManagerState) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		if s.cache == nil {
+			s.cache = s.loadCache(tx)
+		}
+		return s.save(&storageWriter{tx: tx, cache: s.cache}, state)
+	})
+	if err != nil {
+		// The cache may hold writes that were rolled back.
+		s.cache = nil
+	}
+	return err
+}
+
+func (s *Storage) save(w *storageWriter, state ManagerState) error {
+	c := w.cache
+	// Versions do not change once created, they are only written. Commits
+	// only change when they are merged, and are deleted when reverted.
+	commits := w.tx.Bucket([]byte(commitsBucket))
+	kept := make(map[int]bool, len(state.PendingCommits)+len(state.MergedCommits))
+	for _, commit := range slices.Concat(state.PendingCommits, state.MergedCommits) {
+		kept[commit.ID] = true
+		if version, ok := c.commits[commit.ID]; ok && version == commit.Version {
+			continue
+		}
+		files, err := w.files(commit.Files)
+		if err != nil {
+			return err
+		}
+		record := storedCommit{ID: commit.ID, Message: commit.Message, Timestamp: commit.Timestamp, Branch: commit.Branch, Files: files, Author: commit.Author, Version: commit.Version}
+		if err := w.put(commitsBucket, itob(commit.ID), record); err != nil {
+			return err
+		}
+		c.commits[commit.ID] = commit.Version
+	}
+	for id := range c.commits {
+		if !kept[id] {
+			if err := commits.Delete(itob(id)); err != nil {
+				return err
+			}
+			delete(c.commits, id)
+		}
+	}
+	if err := commits.SetSequence(uint64(state.NextCommitID - 1)); err != nil {
+		return err
+	}
+	versions := w.tx.Bucket([]byte(versionsBucket))
+	for _, ver := range state.Versions {
+		if c.versions[ver.ID] {
+			continue
+		}
+		files, err := w.files(ver.Files)
+		if err != nil {
+			return err
+		}
+		record := storedCommit{ID: ver.ID, Tag: ver.Tag, Message: ver.CommitMessage, Timestamp: ver.Timestamp, Branch: ver.Branch, Files: files, Signature: ver.Signature, Author: ver.Author}
+		if err := w.put(versionsBucket, itob(ver.ID), record); err != nil {
+			return err
+		}
+		c.versions[ver.ID] = true
+	}
+	if err := versions.SetSequence(uint64(state.NextVerID - 1)); err != nil {
+		return err
+	}
+
+	paths := make(map[string]bool)
+	for path := range state.LatestFiles {
+		paths[path] = true
+	}
+	for path := range state.FileVersions {
+		paths[path] = true
+	}
+	for path := range state.CommittedFiles {
+		paths[path] = true
+	}
+	for path := range paths {
+		fp := fingerprint(state, path)
+		if stored, ok := c.files[path]; ok && stored == fp && fp != "" {
+			continue
+		}
+		var record storedFile
+		if latest, ok := state.LatestFiles[path]; ok {
+			ref, err := w.blob(latest)
+			if err != nil {
+				return err
+			}
+			record.Latest = &ref
+		}
+		if committed, ok := state.CommittedFiles[path]; ok {
+			ref, err := w.blob(committed)
+			if err != nil {
+				return err
+			}
+			record.Committed = &ref
+		}
+		stored, err := w.versions(state.FileVersions[path])
+		if err != nil {
+			return err
+		}
+		record.Versions = stored
+		if err := w.put(filesBucket, []byte(path), record); err != nil {
+			return err
+		}
+		c.files[path] = fp
+	}
+	for path := range c.files {
+		if !paths[path] {
+			if err := w.tx.Bucket([]byte(filesBucket)).Delete([]byte(path)); err != nil {
+				return err
+			}
+			delete(c.files, path)
+		}
+	}
+
+	// Deleted branches are stored with the others, flagged as deleted.
+	branches := make(map[string]*Branch, len(state.Branches)+len(state.DeletedBranches))
+	maps.Copy(branches, state.Branches)
+	deleted := make(map[string]bool, len(state.DeletedBranches))
+	for name, b := range state.DeletedBranches {
+		branches[name], deleted[name] = b, true
+	}
+	for name, b := range branches {
+		fp := branchFingerprint(b, deleted[name])
+		if c.branches[name] == fp {
+			continue
+		}
+		record := storedBranch{Name: b.Name, Deleted: deleted[name], From: b.From, Created: b.Created}
+		var err error
+		if record.Base, err = w.contents(b.Base); err != nil {
+			return err
+		}
+		if b.MergeBases != nil {
+			record.MergeBases = make(map[string]map[string]string, len(b.MergeBases))
+			for other, files := range b.MergeBases {
+				if record.MergeBases[other], err = w.contents(files); err != nil {
+					return err
+				}
+			}
+		}
+		if record.LatestFiles, err = w.contents(b.LatestFiles); err != nil {
+			return err
+		}
+		if record.CommittedFiles, err = w.contents(b.CommittedFiles); err != nil {
+			return err
+		}
+		if b.FileVersions != nil {
+			record.FileVersions = make(map[string][]storedVersion, len(b.FileVersions))
+			for path, fvs := range b.FileVersions {
+				if record.FileVersions[path], err = w.versions(fvs); err != nil {
+					return err
+				}
+			}
+		}
+		if err := w.put(branchesBucket, []byte(name), record); err != nil {
+			return err
+		}
+		c.branches[name] = fp
+	}
+	for name := range c.branches {
+		if _, ok := branches[name]; !ok {
+			if err := w.tx.Bucket([]byte(branchesBucket)).Delete([]byte(name)); err != nil {
+				return err
+			}
+			delete(c.branches, name)
+		}
+	}
+
+	// Audit entry i of the log has the ID AuditOffset+i+1. Entries past the
+	// log were rolled back with the state, entries before it were dropped
+	// by retention.
+	audit := w.tx.Bucket([]byte(auditBucket))
+	last := state.AuditOffset + len(state.AuditLog)
+	for id := c.audit; id > last; id-- {
+		if err := audit.Delete(itob(id)); err != nil {
+			return err
+		}
+	}
+	for id := max(c.audit, state.AuditOffset) + 1; id <= last; id++ {
+		if err := w.put(auditBucket, itob(id), state.AuditLog[id-state.AuditOffset-1]); err != nil {
+			return err
+		}
+	}
+	var dropped [][]byte
+	cursor := audit.Cursor()
+	for k, _ := cursor.First(); k != nil && btoi(k) <= state.AuditOffset; k, _ = cursor.Next() {
+		dropped = append(dropped, append([]byte(nil), k...))
+	}
+	for _, k := range dropped {
+		if err := audit.Delete(k); err != nil {
+			return err
+		}
+	}
+	c.audit = last
+	if err := audit.SetSequence(uint64(last)); err != nil {
+		return err
+	}
+
+	for name, st := range state.Environments {
+		data, err := json.Marshal(st)
+		if err != nil {
+			return err
+		}
+		if c.envs[name] == string(data) {
+			continue
+		}
+		if err := w.tx.Bucket([]byte(envsBucket)).Put([]byte(name), data); err != nil {
+			return err
+		}
+		c.envs[name] = string(data)
+	}
+
+	meta := storedMeta{Schema: schemaVersion, CurrentBranch: state.CurrentBranch, Merge: state.Merge}
+	if state.DeployedVersion != nil {
+		meta.DeployedVersion = state.DeployedVersion.ID
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if c.meta != string(data) {
+		if err := w.tx.Bucket([]byte(metaBucket)).Put([]byte(metaKey), data); err != nil {
+			return err
+		}
+		c.meta = string(data)
+	}
+	return nil
+}
+
+// LoadState loads the ManagerState from the database. A state stored in the
+// single-key format of earlier releases is migrated to the current layout.
+func (s *Storage) LoadState() (ManagerState, error) {
+	var state ManagerState
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(metaBucket)).Get([]byte(metaKey)) == nil {
+			return errNoState
+		}
+		var err error
+		state, err = s.load(tx)
+		return err
+	})
+	if errors.Is(err, errNoState) {
+		return s.migrate()
+	}
+	return state, err
+}
+
+// migrate moves a state from the legacy single-key format to the current
+// layout and removes it.
+func (s *Storage) migrate() (ManagerState, error) {
+	var state ManagerState
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		legacy := tx.Bucket([]byte(legacyBucket))
+		if legacy == nil {
+			return errNoState
+		}
+		data := legacy.Get([]byte(legacyKey))
+		if data == nil {
+			return errNoState
+		}
+		if err := json.Unmarshal(data, &state); err != nil {
+			return fmt.Errorf("decode legacy state: %w", err)
+		}
+		s.cache = s.loadCache(tx)
+		if err := s.save(&storageWriter{tx: tx, cache: s.cache}, state); err != nil {
+			return fmt.Errorf("migrate legacy state: %w", err)
+		}
+		return tx.DeleteBucket([]byte(legacyBucket))
+	})
+	if err != nil {
+		s.cache = nil
+	}
+	return state, err
+}
+
+// storageReader reads a state within a transaction.
+type storageReader struct {
+	blobs *bbolt.Bucket
+	err   error
+}
+
+func (r *storageReader) blob(ref string) string {
+	if ref == "" {
+		return ""
+	}
+	content := r.blobs.Get([]byte(ref))
+	if content == nil && r.err == nil {
+		r.err = fmt.Errorf("blob %s not found", ref)
+	}
+	return string(content)
+}
+
+func (r *storageReader) version(sv storedVersion) FileVersion {
+	return FileVersion{Timestamp: sv.Timestamp, Content: r.blob(sv.Content), Diff: sv.Diff, Deleted: sv.Deleted, Base: r.blob(sv.Base), RenamedFrom: sv.RenamedFrom}
+}
+
+func (r *storageReader) versions(svs []storedVersion) []FileVersion {
+	fvs := make([]FileVersion, len(svs))
+	for i, sv := range svs {
+		fvs[i] = r.version(sv)
+	}
+	return fvs
+}
+
+func (r *storageReader) files(stored map[string]storedVersion) map[string]FileVersion {
+	files := make(map[string]FileVersion, len(stored))
+	for path, sv := range stored {
+		files[path] = r.version(sv)
+	}
+	return files
+}
+
+func (r *storageReader) contents(refs map[string]string) map[string]string {
+	if refs == nil {
+		return nil
+	}
+	files := make(map[string]string, len(refs))
+	for path, ref := range refs {
+		files[path] = r.blob(ref)
+	}
+	return files
+}
+
+func (s *Storage) load(tx *bbolt.Tx) (ManagerState, error) {
+	r := &storageReader{blobs: tx.Bucket([]byte(blobsBucket))}
+	var meta storedMeta
+	if err := json.Unmarshal(tx.Bucket([]byte(metaBucket)).Get([]byte(metaKey)), &meta); err != nil {
+		return ManagerState{}, err
+	}
+	if meta.Schema > schemaVersion {
+		return ManagerState{}, fmt.Errorf("storage schema %d is newer than %d", meta.Schema, schemaVersion)
+	}
+	state := ManagerState{
+		LatestFiles:     make(map[string]string),
+		FileVersions:    make(map[string][]FileVersion),
+		PendingCommits:  []Commit{},
+		MergedCommits:   []Commit{},
+		CommittedFiles:  make(map[string]string),
+		Versions:        []VersionGroup{},
+		CurrentBranch:   meta.CurrentBranch,
+		AuditLog:        []AuditEntry{},
+		Merge:           meta.Merge,
+		Branches:        make(map[string]*Branch),
+		DeletedBranches: make(map[string]*Branch),
+	}
+	commits := tx.Bucket([]byte(commitsBucket))
+	state.NextCommitID = int(commits.Sequence()) + 1
+	err := commits.ForEach(func(_, data []byte) error {
+		var record storedCommit
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		commit := Commit{
+			ID:        record.ID,
+			Timestamp: record.Timestamp,
+			Message:   record.Message,
+			Branch:    record.Branch,
+			Files:     r.files(record.Files),
+			Author:    record.Author,
+			Version:   record.Version,
+		}
+		if commit.Version != 0 {
+			state.MergedCommits = append(state.MergedCommits, commit)
+		} else {
+			state.PendingCommits = append(state.PendingCommits, commit)
+		}
+		return nil
+	})
+	if err != nil {
+		return ManagerState{}, err
+	}
+	versions := tx.Bucket([]byte(versionsBucket))
+	state.NextVerID = int(versions.Sequence()) + 1
+	err = versions.ForEach(func(_, data []byte) error {
+		var record storedCommit
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		ver := VersionGroup{
+			ID:            record.ID,
+			Tag:           record.Tag,
+			CommitMessage: record.Message,
+			Timestamp:     record.Timestamp,
+			Branch:        record.Branch,
+			Files:         r.files(record.Files),
+			Signature:     record.Signature,
+			Author:        record.Author,
+		}
+		state.Versions = append(state.Versions, ver)
+		if ver.ID == meta.DeployedVersion {
+			state.DeployedVersion = &ver
+		}
+		return nil
+	})
+	if err != nil {
+		return ManagerState{}, err
+	}
+	err = tx.Bucket([]byte(filesBucket)).ForEach(func(k, data []byte) error {
+		var record storedFile
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		path := string(k)
+		if record.Latest != nil {
+			state.LatestFiles[path] = r.blob(*record.Latest)
+		}
+		if record.Committed != nil {
+			state.CommittedFiles[path] = r.blob(*record.Committed)
+		}
+		if len(record.Versions) > 0 {
+			state.FileVersions[path] = r.versions(record.Versions)
+		}
+		return nil
+	})
+	if err != nil {
+		return ManagerState{}, err
+	}
+	err = tx.Bucket([]byte(branchesBucket)).ForEach(func(k, data []byte) error {
+		var record storedBranch
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		b := &Branch{
+			Name:           record.Name,
+			From:           record.From,
+			Created:        record.Created,
+			Base:           r.contents(record.Base),
+			LatestFiles:    r.contents(record.LatestFiles),
+			CommittedFiles: r.contents(record.CommittedFiles),
+		}
+		if record.MergeBases != nil {
+			b.MergeBases = make(map[string]map[string]string, len(record.MergeBases))
+			for other, refs := range record.MergeBases {
+				b.MergeBases[other] = r.contents(refs)
+			}
+		}
+		if record.FileVersions != nil {
+			b.FileVersions = make(map[string][]FileVersion, len(record.FileVersions))
+			for path, svs := range record.FileVersions {
+				b.FileVersions[path] = r.versions(svs)
+			}
+		}
+		if record.Deleted {
+			state.DeletedBranches[string(k)] = b
+		} else {
+			state.Branches[string(k)] = b
+		}
+		return nil
+	})
+	if err != nil {
+		return ManagerState{}, err
+	}
+	err = tx.Bucket([]byte(envsBucket)).ForEach(func(k, data []byte) error {
+		var st EnvironmentState
+		if err := json.Unmarshal(data, &st); err != nil {
+			return err
+		}
+		if state.Environments == nil {
+			state.Environments = make(map[string]*EnvironmentState)
+		}
+		state.Environments[string(k)] = &st
+		return nil
+	})
+	if err != nil {
+		return ManagerState{}, err
+	}
+	cursor := tx.Bucket([]byte(auditBucket)).Cursor()
+	for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		if len(state.AuditLog) == 0 {
+			state.AuditOffset = btoi(k) - 1
+		}
+		// Entries of earlier releases are plain-text messages.
+		e := AuditEntry{ID: btoi(k), Message: string(v)}
+		if len(v) > 0 && v[0] == '{' {
+			if err := json.Unmarshal(v, &e); err != nil {
+				return ManagerState{}, err
+			}
+		}
+		state.AuditLog = append(state.AuditLog, e)
+	}
+	return state, r.err
+}
+
+// Compact deletes the blobs no longer referenced, then rewrites the
+// database file to release the space of deleted entries.
+func (s *Storage) Compact() error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		refs, err := referencedBlobs(tx)
+		if err != nil {
+			return err
+		}
+		blobs := tx.Bucket([]byte(blobsBucket))
+		var unused [][]byte
+		blobs.ForEach(func(k, _ []byte) error {
+			if !refs[string(k)] {
+				unused = append(unused, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range unused {
+			if err := blobs.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	s.cache = nil
+	if err != nil {
+		return err
+	}
+	tmpPath := s.path + ".compact"
+	os.Remove(tmpPath)
+	dst, err := bbolt.Open(tmpPath, 0600, &bbolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return err
+	}
+	if err := bbolt.Compact(dst, s.db, 1<<20); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		if s.db, err = openDB(s.path); err != nil {
+			return err
+		}
+		return fmt.Errorf("replace compacted database: %w", err)
+	}
+	s.db, err = openDB(s.path)
+	return err
+}
+
+// referencedBlobs returns the references held by every stored record.
+func referencedBlobs(tx *bbolt.Tx) (map[string]bool, error) {
+	refs := make(map[string]bool)
+	addVersions := func(svs ...storedVersion) {
+		for _, sv := range svs {
+			refs[sv.Content] = true
+			refs[sv.Base] = true
+		}
+	}
+	addContents := func(files map[string]string) {
+		for _, ref := range files {
+			refs[ref] = true
+		}
+	}
+	for _, name := range []string{commitsBucket, versionsBucket} {
+		err := tx.Bucket([]byte(name)).ForEach(func(_, data []byte) error {
+			var record storedCommit
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+			for _, sv := range record.Files {
+				addVersions(sv)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := tx.Bucket([]byte(filesBucket)).ForEach(func(_, data []byte) error {
+		var record storedFile
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		if record.Latest != nil {
+			refs[*record.Latest] = true
+		}
+		if record.Committed != nil {
+			refs[*record.Committed] = true
+		}
+		addVersions(record.Versions...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Bucket([]byte(branchesBucket)).ForEach(func(_, data []byte) error {
+		var record storedBranch
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		addContents(record.Base)
+		addContents(record.LatestFiles)
+		addContents(record.CommittedFiles)
+		for _, files := range record.MergeBases {
+			addContents(files)
+		}
+		for _, svs := range record.FileVersions {
+			addVersions(svs...)
+		}
+		return nil
+	})
+	return refs, err
+}
+
+// Close closes the database.
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
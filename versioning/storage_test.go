@@ -0,0 +1,122 @@
+package versioning
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStorageReloadKeepsSameLengthCommits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "versions.db")
+	vm, err := New(WithStoragePath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.UpdateFile("api.json", `{"port":8080}`, false)
+	vm.CreateCommit([]string{"api.json"}, "first", "alice")
+	vm.UpdateFile("api.json", `{"port":8081}`, false)
+	vm.CreateCommit([]string{"api.json"}, "second", "alice")
+	if err := vm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err = New(WithStoragePath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if got := vm.CommittedFiles["api.json"]; got != `{"port":8081}` {
+		t.Errorf("committed content after reload = %q, want %q", got, `{"port":8081}`)
+	}
+	if changes := vm.GetChanges(); len(changes) != 0 {
+		t.Errorf("changes after reload = %v, want none", changes)
+	}
+	if pending := vm.Pending(); len(pending) != 2 {
+		t.Errorf("pending commits after reload = %d, want 2", len(pending))
+	}
+}
+
+func TestStorageReloadKeepsVersionsAndBranches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "versions.db")
+	vm, err := New(WithStoragePath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.UpdateFile("api.json", `{"a":1}`, false)
+	vm.CreateCommit([]string{"api.json"}, "add api", "alice")
+	ver, err := vm.MergeCommits("v1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.CreateBranch("feature", "main", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err = New(WithStoragePath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	got, err := vm.versionByID(ver.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Tag != "v1" || got.Author != "alice" || got.Files["api.json"].Content != `{"a":1}` {
+		t.Errorf("version after reload = %+v", got)
+	}
+	if _, ok := vm.Branches["feature"]; !ok {
+		t.Errorf("branch feature lost after reload")
+	}
+}
+
+func TestStorageReloadKeepsDeletedBranchBase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "versions.db")
+	vm, err := New(WithStoragePath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.UpdateFile("api.json", `{"a":1}`, false)
+	vm.CreateCommit([]string{"api.json"}, "add api", "alice")
+	if _, err := vm.MergeCommits("v1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.CreateBranch("feature", "main", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.SwitchBranch("feature", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	vm.UpdateFile("db.json", `{"b":2}`, false)
+	vm.CreateCommit([]string{"db.json"}, "add db", "alice")
+	ver, err := vm.MergeCommits("f1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.SwitchBranch("main", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.DeleteBranch("feature", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err = New(WithStoragePath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if _, ok := vm.Branches["feature"]; ok {
+		t.Errorf("deleted branch feature came back after reload")
+	}
+	files := vm.branchFiles("feature", ver.ID)
+	if files["api.json"] != `{"a":1}` || files["db.json"] != `{"b":2}` {
+		t.Errorf("files of deleted branch after reload = %v", files)
+	}
+	if err := vm.CreateBranch("feature", "main", "alice"); err == nil {
+		t.Errorf("CreateBranch reused the name of a deleted branch with versions")
+	}
+}
@@ -0,0 +1,210 @@
+package versioning
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/oarkflow/json"
+
+	"github.com/oarkflow/router"
+)
+
+// Validator checks the configuration set of a version before it is merged
+// or deployed.
+type Validator interface {
+	// Validate checks files, keyed by their path relative to the watch
+	// root, as passed to Deployer.Deploy.
+	Validate(files map[string]string) error
+}
+
+// ValidatorFunc adapts a function to the Validator interface.
+type ValidatorFunc func(files map[string]string) error
+
+// Validate calls f(files).
+func (f ValidatorFunc) Validate(files map[string]string) error {
+	return f(files)
+}
+
+// WithValidators sets the validators run when a version is merged and
+// before it is deployed. A version that fails one is not created or
+// deployed.
+//
+// Optional. Default: JSONSyntax()
+func WithValidators(validators ...Validator) Option {
+	return func(vm *VersionManager) {
+		vm.validators = append(vm.validators, validators...)
+	}
+}
+
+// ValidationError is returned when a version fails validation.
+type ValidationError struct {
+	Errs []error
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = err.Error()
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return e.Errs
+}
+
+// validate runs every validator on files.
+func (vm *VersionManager) validate(files map[string]string) error {
+	var errs []error
+	for _, v := range vm.validators {
+		if err := v.Validate(files); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errs: errs}
+	}
+	return nil
+}
+
+// JSONSyntax returns a validator checking that every .json file parses.
+func JSONSyntax() Validator {
+	return ValidatorFunc(func(files map[string]string) error {
+		paths := make([]string, 0, len(files))
+		for path := range files {
+			if strings.EqualFold(filepath.Ext(path), ".json") {
+				paths = append(paths, path)
+			}
+		}
+		sort.Strings(paths)
+		var errs []error
+		for _, path := range paths {
+			var v any
+			if err := json.Unmarshal([]byte(files[path]), &v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// ManifestValidator checks the route manifest of a configuration set: its
+// fields, that handler keys resolve in Registry, that schemas compile and
+// that no two routes are served at the same path.
+type ManifestValidator struct {
+	// File is the manifest, in the format of api.json. A configuration set
+	// without it passes.
+	//
+	// Optional. Default: "api.json"
+	File string
+	// SchemaFile binds schemas to the routes of the manifest, in the format
+	// of schema.json. It may be missing.
+	//
+	// Optional. Default: "schema.json"
+	SchemaFile string
+	Registry   router.HandlerRegistry
+}
+
+// Manifest decodes the manifest of files, with the schemas of SchemaFile
+// appended. It reports false when files have no manifest.
+func (v ManifestValidator) Manifest(files map[string]string) (router.Manifest, bool, error) {
+	file, schemaFile := v.File, v.SchemaFile
+	if file == "" {
+		file = "api.json"
+	}
+	if schemaFile == "" {
+		schemaFile = "schema.json"
+	}
+	content, ok := files[file]
+	if !ok {
+		return router.Manifest{}, false, nil
+	}
+	manifest, err := router.DecodeManifest([]byte(content))
+	if err != nil {
+		return router.Manifest{}, true, fmt.Errorf("%s: %w", file, err)
+	}
+	if schemas, ok := files[schemaFile]; ok {
+		var entries []router.SchemaConfig
+		if err := json.Unmarshal([]byte(schemas), &entries); err != nil {
+			return router.Manifest{}, true, fmt.Errorf("%s: %w", schemaFile, err)
+		}
+		manifest.Schemas = append(manifest.Schemas, entries...)
+	}
+	return manifest, true, nil
+}
+
+// Validate checks the manifest of files.
+func (v ManifestValidator) Validate(files map[string]string) error {
+	manifest, ok, err := v.Manifest(files)
+	if err != nil || !ok {
+		return err
+	}
+	source := v.File
+	if source == "" {
+		source = "api.json"
+	}
+	return manifest.Validate(source, v.Registry, router.NewSchemaRegistry())
+}
+
+// RoutePlanner is implemented by deployers that serve routes, to report
+// what deploying a configuration set would change.
+type RoutePlanner interface {
+	Plan(files map[string]string) (router.RouteDiff, error)
+}
+
+// DryRun is the outcome of deploying a version without applying it.
+type DryRun struct {
+	VersionID   int    `json:"versionId"`
+	Environment string `json:"environment"`
+	// Errors lists why the deploy would fail, empty if it would succeed.
+	Errors []string `json:"errors"`
+	// Routes is what the deploy would change in the live router, nil when
+	// the environment has no router.
+	Routes *router.RouteDiff `json:"routes,omitempty"`
+}
+
+// DryRun validates a version and reports what deploying it to an
+// environment would change, without deploying it. env defaults to the first
+// environment.
+func (vm *VersionManager) DryRun(versionID int, env string) (DryRun, error) {
+	vm.RLock()
+	defer vm.RUnlock()
+	if env == "" {
+		env = vm.environments[0].Name
+	}
+	i, err := vm.environment(env)
+	if err != nil {
+		return DryRun{}, err
+	}
+	ver, err := vm.versionByID(versionID)
+	if err != nil {
+		return DryRun{}, err
+	}
+	files := vm.snapshot(*ver)
+	result := DryRun{VersionID: ver.ID, Environment: env, Errors: []string{}}
+	if err := vm.checkSignature(*ver); err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	var verr *ValidationError
+	if err := vm.validate(files); errors.As(err, &verr) {
+		for _, err := range verr.Errs {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+	for _, d := range vm.environments[i].Deployers {
+		planner, ok := d.(RoutePlanner)
+		if !ok {
+			continue
+		}
+		diff, err := planner.Plan(files)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		result.Routes = &diff
+	}
+	return result, nil
+}
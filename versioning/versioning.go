@@ -0,0 +1,839 @@
+// Package versioning tracks changes to configuration files, groups them into
+// commits and versions, and deploys or rolls back versions. Its HTTP API is
+// exposed as Fiber handlers that can be mounted on a router.Group.
+package versioning
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oarkflow/log"
+
+	"github.com/oarkflow/router/watcher"
+)
+
+// FileVersion holds file content, diff, and deletion flag.
+type FileVersion struct {
+	Timestamp time.Time `json:"timestamp"`
+	Content   string    `json:"content"`
+	Diff      string    `json:"diff,omitempty"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	// Base is the content a committed change was made against.
+	Base string `json:"base,omitempty"`
+	// RenamedFrom is the path the file was renamed from by this change.
+	RenamedFrom string `json:"renamedFrom,omitempty"`
+}
+
+// Commit represents a commit with a set of file versions.
+type Commit struct {
+	ID        int                    `json:"id"`
+	Timestamp time.Time              `json:"timestamp"`
+	Message   string                 `json:"message"`
+	Branch    string                 `json:"branch"`
+	Files     map[string]FileVersion `json:"files"`
+	Author    string                 `json:"author,omitempty"`
+	// Version is the ID of the version the commit was merged into, 0 while
+	// it is pending.
+	Version int `json:"version,omitempty"`
+}
+
+// VersionGroup represents a merged version (tag) which can be deployed.
+type VersionGroup struct {
+	ID            int                    `json:"id"`
+	Tag           string                 `json:"tag,omitempty"`
+	CommitMessage string                 `json:"commitMessage,omitempty"`
+	Timestamp     time.Time              `json:"timestamp"`
+	Branch        string                 `json:"branch"`
+	Files         map[string]FileVersion `json:"files"`
+	Author        string                 `json:"author,omitempty"`
+	// Signature is set when the version was merged with a signing key.
+	Signature *Signature `json:"signature,omitempty"`
+}
+
+// ErrVersionNotFound is returned when a version does not exist on the
+// current branch.
+var ErrVersionNotFound = errors.New("version not found on current branch")
+
+// ErrMergeInProgress is returned when merging while another merge waits for
+// its conflicts to be resolved.
+var ErrMergeInProgress = errors.New("a merge is in progress; complete or abort it first")
+
+// ErrNoMerge is returned when no merge is pending.
+var ErrNoMerge = errors.New("no merge in progress")
+
+// Option configures a VersionManager.
+type Option func(*VersionManager)
+
+// WithStoragePath sets the path of the bbolt database holding the state.
+//
+// Optional. Default: "versionmanager.db"
+func WithStoragePath(path string) Option {
+	return func(vm *VersionManager) {
+		vm.storagePath = path
+	}
+}
+
+// WithWatchRoots sets the directories watched for file changes. Without
+// roots, changes are only recorded through UpdateFile and RenameFile.
+func WithWatchRoots(roots ...string) Option {
+	return func(vm *VersionManager) {
+		vm.watchConfig.Roots = roots
+	}
+}
+
+// WithWatchConfig configures the file watcher: its roots, the globs of the
+// files recorded and ignored, and how long bursts of writes settle before
+// they are recorded. It replaces the roots set by WithWatchRoots.
+//
+// Optional. Default: watcher.Config{Roots: roots of WithWatchRoots}
+func WithWatchConfig(cfg watcher.Config) Option {
+	return func(vm *VersionManager) {
+		vm.watchConfig = cfg
+	}
+}
+
+// WithAuth sets the provider authenticating requests to the HTTP API.
+//
+// Required, unless WithoutAuth is set: without a provider every request is
+// refused.
+func WithAuth(provider AuthProvider) Option {
+	return func(vm *VersionManager) {
+		vm.auth = provider
+	}
+}
+
+// WithoutAuth opens the HTTP API to every request when no provider is set,
+// with every role. Protect the group it is mounted on then.
+func WithoutAuth() Option {
+	return func(vm *VersionManager) {
+		vm.noAuth = true
+	}
+}
+
+// WithDeployDir deploys versions to dir, with a DirDeployer.
+func WithDeployDir(dir string) Option {
+	return WithDeployer(DirDeployer{Dir: dir})
+}
+
+// WithDeployer adds a target versions are deployed to, when no environment
+// is configured with WithEnvironment. Deployers run in the order they are
+// added; if one fails, the others are undone.
+//
+// Optional. Default: DirDeployer{Dir: "Prod"}
+func WithDeployer(d Deployer) Option {
+	return func(vm *VersionManager) {
+		vm.deployers = append(vm.deployers, d)
+	}
+}
+
+// Retention limits the history kept by a VersionManager. Zero keeps
+// everything.
+type Retention struct {
+	// FileVersions is the number of recorded versions kept per file.
+	FileVersions int
+	// AuditEntries is the number of audit log entries kept.
+	AuditEntries int
+}
+
+// WithRetention limits the history kept. Dropped entries are deleted from
+// the storage when the state is next saved; call Compact to release their
+// space.
+//
+// Optional. Default: Retention{} (keep everything)
+func WithRetention(r Retention) Option {
+	return func(vm *VersionManager) {
+		vm.retention = r
+	}
+}
+
+// VersionManager holds all versioning data and a pointer to persistent storage.
+type VersionManager struct {
+	sync.RWMutex
+	LatestFiles     map[string]string            // latest file content snapshot of the current branch
+	FileVersions    map[string][]FileVersion     // history of file versions per file of the current branch
+	PendingCommits  []Commit                     // pending commits of every branch
+	MergedCommits   []Commit                     // commits merged into versions, for file history
+	CommittedFiles  map[string]string            // baseline committed file contents of the current branch
+	Versions        []VersionGroup               // merged version groups
+	NextCommitID    int                          // auto-increment commit ID
+	NextVerID       int                          // auto-increment version group ID
+	CurrentBranch   string                       // current branch name (e.g. "main", "feature")
+	AuditLog        []AuditEntry                 // audit log entries, oldest first
+	DeployedVersion *VersionGroup                // version deployed to the first environment
+	Environments    map[string]*EnvironmentState // deploy state per environment
+	Merge           *PendingMerge                // merge waiting for conflict resolution
+	Branches        map[string]*Branch           // branches by name
+	DeletedBranches map[string]*Branch           // deleted branches that have versions, by name
+	storage         *Storage
+	storagePath     string
+	retention       Retention
+	auditOffset     int
+	watchConfig     watcher.Config
+	deployers       []Deployer
+	environments    []Environment
+	validators      []Validator
+	auth            AuthProvider
+	noAuth          bool
+	roles           map[string][]Role
+	signingKey      ed25519.PrivateKey
+	trustedKeys     []ed25519.PublicKey
+	signaturePolicy SignaturePolicy
+	policySet       bool
+	stopWatch       func() error
+}
+
+// New opens the storage, loads the previous state if there is one and
+// starts watching the configured roots. Call Close to release them.
+func New(opts ...Option) (*VersionManager, error) {
+	vm := &VersionManager{
+		LatestFiles:     make(map[string]string),
+		FileVersions:    make(map[string][]FileVersion),
+		PendingCommits:  []Commit{},
+		MergedCommits:   []Commit{},
+		CommittedFiles:  make(map[string]string),
+		Versions:        []VersionGroup{},
+		NextCommitID:    1,
+		NextVerID:       1,
+		CurrentBranch:   "main",
+		AuditLog:        []AuditEntry{},
+		Branches:        map[string]*Branch{"main": {Name: "main", Created: time.Now()}},
+		DeletedBranches: make(map[string]*Branch),
+		storagePath:     "versionmanager.db",
+	}
+	for _, opt := range opts {
+		opt(vm)
+	}
+	if len(vm.validators) == 0 {
+		vm.validators = []Validator{JSONSyntax()}
+	}
+	if !vm.policySet && (vm.signingKey != nil || len(vm.trustedKeys) > 0) {
+		vm.signaturePolicy = SignaturesRequired
+	}
+	if len(vm.environments) == 0 {
+		if len(vm.deployers) == 0 {
+			vm.deployers = []Deployer{DirDeployer{Dir: "Prod"}}
+		}
+		vm.environments = []Environment{{Name: "prod", Deployers: vm.deployers}}
+	} else if len(vm.deployers) > 0 {
+		return nil, errors.New("deployers must be set per environment when environments are configured")
+	}
+	storage, err := NewStorage(vm.storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("open storage %s: %w", vm.storagePath, err)
+	}
+	vm.storage = storage
+	if state, err := storage.LoadState(); err == nil {
+		vm.restoreState(state)
+		// States saved before environments existed only know the version
+		// deployed to the single target.
+		if first := vm.envState(vm.environments[0].Name); first.Current == nil && vm.DeployedVersion != nil {
+			ver := vm.DeployedVersion
+			d := Deployment{VersionID: ver.ID, Tag: ver.Tag, Branch: ver.Branch, Action: ActionDeploy, Timestamp: ver.Timestamp}
+			first.Current = &d
+			first.History = []Deployment{d}
+		}
+		log.Info().Str("path", vm.storagePath).Msg("Loaded persisted version state")
+	} else if errors.Is(err, errNoState) {
+		if err := vm.persistState(); err != nil {
+			storage.Close()
+			return nil, err
+		}
+	} else {
+		storage.Close()
+		return nil, err
+	}
+	if len(vm.watchConfig.Roots) > 0 {
+		stop, err := vm.watch()
+		if err != nil {
+			storage.Close()
+			return nil, err
+		}
+		vm.stopWatch = stop
+	}
+	return vm, nil
+}
+
+// Compact releases the space of the history dropped from the storage, such
+// as file contents no longer referenced and entries dropped by retention, on
+// behalf of actor.
+func (vm *VersionManager) Compact(actor string) error {
+	vm.Lock()
+	defer vm.Unlock()
+	vm.record(AuditEntry{Actor: actor, Action: AuditStorageCompact, Message: "Compacted version storage"})
+	if err := vm.persistState(); err != nil {
+		return err
+	}
+	if err := vm.storage.Compact(); err != nil {
+		return fmt.Errorf("compact storage: %w", err)
+	}
+	log.Info().Str("path", vm.storagePath).Msg("Compacted version storage")
+	return nil
+}
+
+// Close stops watching and closes the storage.
+func (vm *VersionManager) Close() error {
+	if vm.stopWatch != nil {
+		vm.stopWatch()
+	}
+	return vm.storage.Close()
+}
+
+// state returns a copy of the manager state. Maps are copied so that the
+// copy is not affected by later updates.
+func (vm *VersionManager) state() ManagerState {
+	return ManagerState{
+		LatestFiles:     maps.Clone(vm.LatestFiles),
+		FileVersions:    maps.Clone(vm.FileVersions),
+		PendingCommits:  vm.PendingCommits,
+		MergedCommits:   vm.MergedCommits,
+		CommittedFiles:  maps.Clone(vm.CommittedFiles),
+		Versions:        vm.Versions,
+		NextCommitID:    vm.NextCommitID,
+		NextVerID:       vm.NextVerID,
+		CurrentBranch:   vm.CurrentBranch,
+		AuditLog:        vm.AuditLog,
+		DeployedVersion: vm.DeployedVersion,
+		Environments:    maps.Clone(vm.Environments),
+		Merge:           vm.Merge,
+		Branches:        maps.Clone(vm.Branches),
+		DeletedBranches: maps.Clone(vm.DeletedBranches),
+		AuditOffset:     vm.auditOffset,
+	}
+}
+
+// restoreState replaces the manager state.
+func (vm *VersionManager) restoreState(state ManagerState) {
+	vm.LatestFiles = state.LatestFiles
+	vm.FileVersions = state.FileVersions
+	vm.PendingCommits = state.PendingCommits
+	vm.MergedCommits = state.MergedCommits
+	vm.CommittedFiles = state.CommittedFiles
+	vm.Versions = state.Versions
+	vm.NextCommitID = state.NextCommitID
+	vm.NextVerID = state.NextVerID
+	vm.CurrentBranch = state.CurrentBranch
+	vm.AuditLog = state.AuditLog
+	vm.DeployedVersion = state.DeployedVersion
+	vm.Environments = state.Environments
+	vm.Merge = state.Merge
+	vm.Branches = state.Branches
+	vm.DeletedBranches = state.DeletedBranches
+	vm.auditOffset = state.AuditOffset
+	for i := range vm.AuditLog {
+		// Entries of the plain-text log of earlier releases have no ID.
+		vm.AuditLog[i].ID = vm.auditOffset + i + 1
+	}
+	vm.ensureBranches()
+}
+
+// persistState writes the manager state to storage.
+func (vm *VersionManager) persistState() error {
+	return vm.storage.SaveState(vm.state())
+}
+
+// UpdateFile records a new version of a file. Updates that change nothing,
+// such as a file saved unchanged, are not recorded.
+func (vm *VersionManager) UpdateFile(path, content string, deleted bool) {
+	vm.Lock()
+	defer vm.Unlock()
+	if versions := vm.FileVersions[path]; len(versions) > 0 {
+		if last := versions[len(versions)-1]; last.Content == content && last.Deleted == deleted {
+			return
+		}
+	}
+	before := vm.LatestFiles[path]
+	vm.LatestFiles[path] = content
+	vm.addFileVersion(path, FileVersion{Timestamp: time.Now(), Content: content, Deleted: deleted})
+	vm.audit(AuditEntry{
+		Action:  AuditFileUpdate,
+		Targets: []string{auditRef("file", path), auditRef("branch", vm.CurrentBranch)},
+		Before:  blobRef(before),
+		After:   blobRef(content),
+		Message: fmt.Sprintf("%s updated (deleted=%v)", path, deleted),
+	})
+	log.Info().Str("file", path).Bool("deleted", deleted).Msg("File updated")
+}
+
+// RenameFile records that the file at from was moved to to, with content.
+// The history of to continues the one of from, see FileHistory.
+func (vm *VersionManager) RenameFile(from, to, content string) {
+	vm.Lock()
+	defer vm.Unlock()
+	now := time.Now()
+	before := vm.LatestFiles[from]
+	vm.LatestFiles[from] = ""
+	vm.addFileVersion(from, FileVersion{Timestamp: now, Deleted: true})
+	vm.LatestFiles[to] = content
+	vm.addFileVersion(to, FileVersion{Timestamp: now, Content: content, RenamedFrom: from})
+	vm.audit(AuditEntry{
+		Action:  AuditFileRename,
+		Targets: []string{auditRef("file", from), auditRef("file", to), auditRef("branch", vm.CurrentBranch)},
+		Before:  blobRef(before),
+		After:   blobRef(content),
+		Message: fmt.Sprintf("%s renamed to %s", from, to),
+	})
+	log.Info().Str("from", from).Str("to", to).Msg("File renamed")
+}
+
+// addFileVersion appends to the history of a file of the current branch,
+// keeping the number of versions the retention allows. The rename of the
+// file is kept on the oldest version left, so that its history still
+// follows it.
+func (vm *VersionManager) addFileVersion(path string, fv FileVersion) {
+	versions := append(vm.FileVersions[path], fv)
+	if n := vm.retention.FileVersions; n > 0 && len(versions) > n {
+		dropped := versions[:len(versions)-n]
+		versions = append([]FileVersion(nil), versions[len(versions)-n:]...)
+		for _, old := range slices.Backward(dropped) {
+			if old.RenamedFrom != "" {
+				if versions[0].RenamedFrom == "" {
+					versions[0].RenamedFrom = old.RenamedFrom
+				}
+				break
+			}
+		}
+	}
+	vm.FileVersions[path] = versions
+}
+
+// GetChanges returns the diff of every file whose latest version differs
+// from its committed baseline.
+func (vm *VersionManager) GetChanges() map[string]string {
+	vm.RLock()
+	defer vm.RUnlock()
+	changes := make(map[string]string)
+	for file, versions := range vm.FileVersions {
+		if len(versions) == 0 {
+			continue
+		}
+		baseline := strings.TrimSpace(vm.CommittedFiles[file])
+		last := versions[len(versions)-1]
+		latest := strings.TrimSpace(last.Content)
+		if last.Deleted {
+			latest = ""
+		}
+		if latest == baseline {
+			continue
+		}
+		if diff := diffText(baseline, latest); strings.TrimSpace(diff) != "" {
+			changes[file] = diff
+		}
+	}
+	return changes
+}
+
+// CreateCommit records the latest version of the selected files as a
+// pending commit on the current branch, on behalf of actor.
+func (vm *VersionManager) CreateCommit(selectedFiles []string, message, actor string) Commit {
+	vm.Lock()
+	defer vm.Unlock()
+	commit := Commit{
+		ID:        vm.NextCommitID,
+		Timestamp: time.Now(),
+		Message:   message,
+		Branch:    vm.CurrentBranch,
+		Files:     make(map[string]FileVersion),
+		Author:    actor,
+	}
+	for _, file := range selectedFiles {
+		versions := vm.FileVersions[file]
+		if len(versions) == 0 {
+			continue
+		}
+		baseline := strings.TrimSpace(vm.CommittedFiles[file])
+		currentVersion := versions[len(versions)-1]
+		current := strings.TrimSpace(currentVersion.Content)
+		commit.Files[file] = FileVersion{
+			Timestamp: time.Now(),
+			Content:   current,
+			Diff:      diffText(baseline, current),
+			Deleted:   currentVersion.Deleted,
+			Base:      baseline,
+		}
+		vm.CommittedFiles[file] = current
+	}
+	vm.PendingCommits = append(vm.PendingCommits, commit)
+	vm.NextCommitID++
+	targets := []string{auditRef("commit", commit.ID), auditRef("branch", vm.CurrentBranch)}
+	for _, file := range slices.Sorted(maps.Keys(commit.Files)) {
+		targets = append(targets, auditRef("file", file))
+	}
+	vm.audit(AuditEntry{
+		Actor:   actor,
+		Action:  AuditCommitCreate,
+		Targets: targets,
+		After:   auditRef("commit", commit.ID),
+		Message: fmt.Sprintf("Commit %d created on branch '%s'", commit.ID, vm.CurrentBranch),
+	})
+	log.Info().Int("commit", commit.ID).Str("branch", vm.CurrentBranch).Str("message", message).Msg("Created commit")
+	return commit
+}
+
+// Pending returns the pending commits.
+func (vm *VersionManager) Pending() []Commit {
+	vm.RLock()
+	defer vm.RUnlock()
+	return append([]Commit(nil), vm.PendingCommits...)
+}
+
+// ListVersions returns the merged versions.
+func (vm *VersionManager) ListVersions() []VersionGroup {
+	vm.RLock()
+	defer vm.RUnlock()
+	return append([]VersionGroup(nil), vm.Versions...)
+}
+
+// Deployed returns the deployed version, or nil if none was deployed.
+func (vm *VersionManager) Deployed() *VersionGroup {
+	vm.RLock()
+	defer vm.RUnlock()
+	return vm.DeployedVersion
+}
+
+// MergeCommits merges every pending commit of the current branch into a
+// new version, on behalf of actor. When commits conflict it returns a
+// *ConflictError and the merge stays pending, see PendingMerge.
+func (vm *VersionManager) MergeCommits(tag, actor string) (VersionGroup, error) {
+	vm.Lock()
+	defer vm.Unlock()
+	return vm.mergeCommits(tag, nil, actor)
+}
+
+// MergeSelectedCommits merges the given pending commits of the current
+// branch into a new version, like MergeCommits.
+func (vm *VersionManager) MergeSelectedCommits(commitIDs []int, tag, actor string) (VersionGroup, error) {
+	vm.Lock()
+	defer vm.Unlock()
+	selected := make(map[int]bool, len(commitIDs))
+	for _, id := range commitIDs {
+		selected[id] = true
+	}
+	return vm.mergeCommits(tag, selected, actor)
+}
+
+// releasedContent returns the content of a file in the latest version of
+// a branch, or the content it had when the branch was created if no version
+// has it.
+func (vm *VersionManager) releasedContent(branch, file string) string {
+	content := ""
+	if b, ok := vm.branch(branch); ok {
+		content = b.Base[file]
+	}
+	for _, ver := range vm.Versions {
+		if fv, ok := ver.Files[file]; ok && ver.Branch == branch {
+			content = fv.Content
+		}
+	}
+	return content
+}
+
+// mergeCommits merges the pending commits of the current branch, or only
+// the selected ones when selected is not nil. The commits touching a file
+// are applied in order with a three-way merge against the file's content
+// in the latest version of the branch. When one conflicts, the commits
+// after it are squashed into it, so that each region conflicts once.
+func (vm *VersionManager) mergeCommits(tag string, selected map[int]bool, actor string) (VersionGroup, error) {
+	if vm.Merge != nil {
+		return VersionGroup{}, ErrMergeInProgress
+	}
+	merge := &PendingMerge{
+		Tag:    tag,
+		Branch: vm.CurrentBranch,
+		Files:  make(map[string]*FileMerge),
+	}
+	var messages []string
+	fileCommits := make(map[string][]FileVersion)
+	var files []string
+	for _, commit := range vm.PendingCommits {
+		if commit.Branch != vm.CurrentBranch || (selected != nil && !selected[commit.ID]) {
+			continue
+		}
+		merge.CommitIDs = append(merge.CommitIDs, commit.ID)
+		messages = append(messages, fmt.Sprintf("Commit %d: %s", commit.ID, commit.Message))
+		for file, fv := range commit.Files {
+			if _, seen := fileCommits[file]; !seen {
+				files = append(files, file)
+			}
+			fileCommits[file] = append(fileCommits[file], fv)
+		}
+	}
+	merge.Message = strings.Join(messages, " | ")
+	sort.Strings(files)
+	next := 0
+	for _, file := range files {
+		changes := fileCommits[file]
+		ours := vm.releasedContent(vm.CurrentBranch, file)
+		var fm *FileMerge
+		last := changes[len(changes)-1]
+		for _, fv := range changes {
+			// Merge this commit alone first; squash the rest into it only
+			// if it conflicts.
+			step := mergeFile(file, fv.Base, ours, fv.Content, new(int))
+			if len(step.Hunks) > 0 {
+				fm = mergeFile(file, fv.Base, ours, last.Content, &next)
+				break
+			}
+			ours, _ = step.render()
+			fm = &FileMerge{Parts: []MergePart{{Text: ours}}}
+		}
+		fm.Deleted = last.Deleted
+		merge.Files[file] = fm
+	}
+	if hunks := merge.Hunks(); len(hunks) > 0 {
+		vm.Merge = merge
+		vm.audit(AuditEntry{
+			Actor:   actor,
+			Action:  AuditMergeConflict,
+			Targets: append(commitTargets(merge.CommitIDs), auditRef("branch", vm.CurrentBranch)),
+			Message: fmt.Sprintf("Merge on branch '%s' has %d conflicting hunks", vm.CurrentBranch, len(hunks)),
+		})
+		log.Warn().Str("branch", vm.CurrentBranch).Int("hunks", len(hunks)).Msg("Merge conflict")
+		return VersionGroup{}, &ConflictError{Hunks: hunks}
+	}
+	return vm.completeMerge(merge, actor)
+}
+
+// commitTargets returns the audit targets of commits.
+func commitTargets(ids []int) []string {
+	targets := make([]string, len(ids))
+	for i, id := range ids {
+		targets[i] = auditRef("commit", id)
+	}
+	return targets
+}
+
+// completeMerge creates the version of a merge whose hunks are all resolved
+// and removes its commits from the pending list. The version must pass the
+// validators.
+func (vm *VersionManager) completeMerge(merge *PendingMerge, actor string) (VersionGroup, error) {
+	mergedFiles := make(map[string]FileVersion, len(merge.Files))
+	for file, fm := range merge.Files {
+		content, err := fm.render()
+		if err != nil {
+			return VersionGroup{}, fmt.Errorf("merge %s: %w", file, err)
+		}
+		content = strings.TrimSpace(content)
+		base := vm.releasedContent(merge.Branch, file)
+		mergedFiles[file] = FileVersion{
+			Timestamp: time.Now(),
+			Content:   content,
+			Diff:      diffText(base, content),
+			Deleted:   fm.Deleted && content == "",
+		}
+	}
+	ver := VersionGroup{
+		ID:            vm.NextVerID,
+		Tag:           merge.Tag,
+		CommitMessage: merge.Message,
+		Timestamp:     time.Now(),
+		Branch:        merge.Branch,
+		Files:         mergedFiles,
+		Author:        actor,
+	}
+	if err := vm.validate(vm.snapshot(ver)); err != nil {
+		return VersionGroup{}, err
+	}
+	vm.sign(&ver, actor)
+	previous := vm.latestVersion(merge.Branch)
+	vm.Versions = append(vm.Versions, ver)
+	vm.NextVerID++
+	var remaining []Commit
+	for _, commit := range vm.PendingCommits {
+		if !slices.Contains(merge.CommitIDs, commit.ID) {
+			remaining = append(remaining, commit)
+			continue
+		}
+		commit.Version = ver.ID
+		vm.MergedCommits = append(vm.MergedCommits, commit)
+	}
+	vm.PendingCommits = remaining
+	vm.Merge = nil
+	entry := AuditEntry{
+		Actor:   actor,
+		Action:  AuditVersionCreate,
+		Targets: append([]string{auditRef("version", ver.ID), auditRef("branch", merge.Branch)}, commitTargets(merge.CommitIDs)...),
+		Before:  versionRef(previous),
+		After:   auditRef("version", ver.ID),
+		Message: fmt.Sprintf("Merged commits %v on branch '%s' into version %d", merge.CommitIDs, merge.Branch, ver.ID),
+	}
+	if merge.Source != "" {
+		vm.recordBranchMerge(merge)
+		entry.Targets = append(entry.Targets, auditRef("branch", merge.Source))
+		entry.Message = fmt.Sprintf("Merged branch '%s' into '%s' as version %d", merge.Source, merge.Branch, ver.ID)
+	}
+	vm.audit(entry)
+	log.Info().Int("version", ver.ID).Str("branch", merge.Branch).Str("tag", merge.Tag).Ints("commits", merge.CommitIDs).Msg("Created version")
+	return ver, nil
+}
+
+// CurrentMerge returns a copy of the merge waiting for conflict
+// resolution, or nil.
+func (vm *VersionManager) CurrentMerge() *PendingMerge {
+	vm.RLock()
+	defer vm.RUnlock()
+	if vm.Merge == nil {
+		return nil
+	}
+	return vm.Merge.clone()
+}
+
+// ResolveHunk sets the content of a conflicting hunk of the pending merge.
+// For JSON files merged by key path, resolution must be a JSON value, or ""
+// to remove the key.
+func (vm *VersionManager) ResolveHunk(id int, resolution, actor string) error {
+	vm.Lock()
+	defer vm.Unlock()
+	if vm.Merge == nil {
+		return ErrNoMerge
+	}
+	fm, hunk := vm.Merge.hunk(id)
+	if hunk == nil {
+		return fmt.Errorf("hunk %d not found", id)
+	}
+	if fm.Doc != nil {
+		if _, ok := decodeJSON(resolution); !ok {
+			return fmt.Errorf("hunk %d: resolution is not valid JSON", id)
+		}
+	}
+	hunk.Resolution = &resolution
+	vm.audit(AuditEntry{
+		Actor:   actor,
+		Action:  AuditMergeResolve,
+		Targets: []string{auditRef("hunk", id), auditRef("file", hunk.File), auditRef("branch", vm.Merge.Branch)},
+		After:   blobRef(resolution),
+		Message: fmt.Sprintf("Resolved hunk %d of %s", id, hunk.File),
+	})
+	return nil
+}
+
+// CompleteMerge creates the version of the pending merge once all of its
+// hunks are resolved, on behalf of actor.
+func (vm *VersionManager) CompleteMerge(actor string) (VersionGroup, error) {
+	vm.Lock()
+	defer vm.Unlock()
+	if vm.Merge == nil {
+		return VersionGroup{}, ErrNoMerge
+	}
+	if n := vm.Merge.Unresolved(); n > 0 {
+		return VersionGroup{}, fmt.Errorf("%d hunks are not resolved", n)
+	}
+	return vm.completeMerge(vm.Merge, actor)
+}
+
+// RevertPendingCommits drops the pending commits of the current branch. The
+// committed baseline of their files goes back to the latest version, so
+// that the reverted changes show up as uncommitted again.
+func (vm *VersionManager) RevertPendingCommits(actor string) {
+	vm.Lock()
+	defer vm.Unlock()
+	var remaining []Commit
+	var reverted []int
+	for _, commit := range vm.PendingCommits {
+		if commit.Branch != vm.CurrentBranch {
+			remaining = append(remaining, commit)
+			continue
+		}
+		reverted = append(reverted, commit.ID)
+		for file := range commit.Files {
+			vm.CommittedFiles[file] = vm.releasedContent(vm.CurrentBranch, file)
+		}
+	}
+	vm.PendingCommits = remaining
+	vm.audit(AuditEntry{
+		Actor:   actor,
+		Action:  AuditCommitRevert,
+		Targets: append(commitTargets(reverted), auditRef("branch", vm.CurrentBranch)),
+		Message: fmt.Sprintf("Pending commits on branch '%s' reverted.", vm.CurrentBranch),
+	})
+	log.Info().Str("branch", vm.CurrentBranch).Msg("Pending commits reverted")
+}
+
+// AbortMerge drops the pending merge, if any. Its commits stay pending.
+func (vm *VersionManager) AbortMerge(actor string) {
+	vm.Lock()
+	defer vm.Unlock()
+	var targets []string
+	if vm.Merge != nil {
+		targets = commitTargets(vm.Merge.CommitIDs)
+	}
+	vm.Merge = nil
+	vm.audit(AuditEntry{
+		Actor:   actor,
+		Action:  AuditMergeAbort,
+		Targets: append(targets, auditRef("branch", vm.CurrentBranch)),
+		Message: fmt.Sprintf("Merge aborted on branch '%s'", vm.CurrentBranch),
+	})
+	log.Info().Str("branch", vm.CurrentBranch).Msg("Merge aborted")
+}
+
+// GetDiff returns the diff between the latest content of a file and
+// newContent.
+func (vm *VersionManager) GetDiff(filePath, newContent string) string {
+	vm.RLock()
+	defer vm.RUnlock()
+	return diffText(vm.LatestFiles[filePath], newContent)
+}
+
+// findVersion returns the version with the given ID on the current branch.
+func (vm *VersionManager) findVersion(versionID int) (*VersionGroup, error) {
+	for i := range vm.Versions {
+		if vm.Versions[i].ID == versionID && vm.Versions[i].Branch == vm.CurrentBranch {
+			ver := vm.Versions[i]
+			return &ver, nil
+		}
+	}
+	return nil, ErrVersionNotFound
+}
+
+// SwitchVersion deploys a version on behalf of actor, without changing the
+// committed baseline.
+func (vm *VersionManager) SwitchVersion(versionID int, actor string) (*VersionGroup, error) {
+	vm.Lock()
+	defer vm.Unlock()
+	target, err := vm.findVersion(versionID)
+	if err != nil {
+		return nil, err
+	}
+	err = vm.deployToEnv(0, *target, ActionDeploy, actor, nil)
+	if err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// RollbackDeployment deploys a version and resets the committed baseline to
+// its files, dropping the pending commits of the current branch, on behalf of
+// actor.
+func (vm *VersionManager) RollbackDeployment(versionID int, actor string) error {
+	vm.Lock()
+	defer vm.Unlock()
+	target, err := vm.findVersion(versionID)
+	if err != nil {
+		return err
+	}
+	err = vm.deployToEnv(0, *target, ActionRollback, actor, func() {
+		for file, fv := range target.Files {
+			vm.CommittedFiles[file] = fv.Content
+			vm.addFileVersion(file, FileVersion{Timestamp: time.Now(), Content: fv.Content, Deleted: fv.Deleted})
+		}
+		var remaining []Commit
+		for _, commit := range vm.PendingCommits {
+			if commit.Branch != vm.CurrentBranch {
+				remaining = append(remaining, commit)
+			}
+		}
+		vm.PendingCommits = remaining
+	})
+	if err != nil {
+		return err
+	}
+	log.Info().Int("version", target.ID).Msg("Rolled back deployment")
+	return nil
+}
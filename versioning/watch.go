@@ -0,0 +1,40 @@
+package versioning
+
+import (
+	"os"
+
+	"github.com/oarkflow/log"
+
+	"github.com/oarkflow/router/watcher"
+)
+
+// watch records changes to the watched files until the returned function
+// is called.
+func (vm *VersionManager) watch() (func() error, error) {
+	w, err := watcher.New(vm.watchConfig, vm.recordEvents)
+	if err != nil {
+		return nil, err
+	}
+	return w.Close, nil
+}
+
+// recordEvents records a batch of changes reported by the watcher. Renamed
+// files keep their history, see RenameFile.
+func (vm *VersionManager) recordEvents(events []watcher.Event) {
+	for _, event := range events {
+		if event.Op == watcher.Remove {
+			vm.UpdateFile(event.Path, "", true)
+			continue
+		}
+		data, err := os.ReadFile(event.Path)
+		if err != nil {
+			log.Error().Err(err).Str("file", event.Path).Msg("Failed to read watched file")
+			continue
+		}
+		if event.Op == watcher.Rename {
+			vm.RenameFile(event.OldPath, event.Path, string(data))
+			continue
+		}
+		vm.UpdateFile(event.Path, string(data), false)
+	}
+}
@@ -0,0 +1,369 @@
+// Package watcher reports changes to the files below a set of directories.
+// Files are filtered by glob, bursts of writes are reported once they
+// settle, new subdirectories are watched as they appear and renamed files
+// are reported as renames rather than as a removal and a creation.
+package watcher
+
+import (
+	"errors"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/oarkflow/log"
+)
+
+// Op is the kind of change of an Event.
+type Op int
+
+const (
+	// Write reports a file created or modified.
+	Write Op = iota + 1
+	// Remove reports a file removed, or moved out of the watched files.
+	Remove
+	// Rename reports a file moved from OldPath to Path.
+	Rename
+)
+
+// String returns the name of the operation.
+func (op Op) String() string {
+	switch op {
+	case Write:
+		return "write"
+	case Remove:
+		return "remove"
+	case Rename:
+		return "rename"
+	}
+	return "unknown"
+}
+
+// Event is a change to a watched file.
+type Event struct {
+	Op   Op
+	Path string
+	// OldPath is the previous path of a renamed file.
+	OldPath string
+}
+
+// DefaultExclude ignores editor swap and backup files and version control
+// directories.
+var DefaultExclude = []string{
+	"*~", ".*.sw[a-p]", "*.tmp", ".#*", "#*#", "4913", ".DS_Store",
+	".git", ".hg", ".svn",
+}
+
+// Config configures a Watcher.
+//
+// Globs are matched against the path of a file relative to its root, with
+// "/" separators, as with filepath.Match. A glob without "/" matches the
+// name of the file or of any directory above it; "**" matches any number
+// of directories.
+type Config struct {
+	// Roots are the directories watched, with their subdirectories.
+	Roots []string
+
+	// Include restricts the files reported to those matching one of these
+	// globs.
+	//
+	// Optional. Default: every file
+	Include []string
+
+	// Exclude ignores the files and directories matching one of these
+	// globs. Extend DefaultExclude rather than replace it to keep ignoring
+	// editor files.
+	//
+	// Optional. Default: DefaultExclude
+	Exclude []string
+
+	// Debounce is how long changes must settle before they are reported,
+	// so that a burst of writes is reported once.
+	//
+	// Optional. Default: 100 * time.Millisecond
+	Debounce time.Duration
+
+	// MaxWait is the longest changes wait to be reported, so that files
+	// written continuously are still reported.
+	//
+	// Optional. Default: 10 * Debounce
+	MaxWait time.Duration
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Exclude == nil {
+		cfg.Exclude = DefaultExclude
+	}
+	if cfg.Debounce <= 0 {
+		cfg.Debounce = 100 * time.Millisecond
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = 10 * cfg.Debounce
+	}
+	return cfg
+}
+
+// rel returns the path of a file relative to the root it is below.
+func (cfg Config) rel(path string) (string, bool) {
+	for _, root := range cfg.Roots {
+		rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(path))
+		if err == nil && filepath.IsLocal(rel) {
+			return filepath.ToSlash(rel), true
+		}
+	}
+	return "", false
+}
+
+// excluded reports whether a file or directory is ignored.
+func (cfg Config) excluded(rel string) bool {
+	return slices.ContainsFunc(cfg.withDefaults().Exclude, func(glob string) bool { return match(glob, rel) })
+}
+
+// Matches reports whether a file is below a root and reported by the
+// watcher.
+func (cfg Config) Matches(path string) bool {
+	rel, ok := cfg.rel(path)
+	if !ok || cfg.excluded(rel) {
+		return false
+	}
+	return len(cfg.Include) == 0 || slices.ContainsFunc(cfg.Include, func(glob string) bool { return match(glob, rel) })
+}
+
+// match reports whether a slash separated relative path matches a glob.
+func match(glob, rel string) bool {
+	parts := strings.Split(rel, "/")
+	if !strings.Contains(glob, "/") {
+		return slices.ContainsFunc(parts, func(name string) bool {
+			ok, _ := filepath.Match(glob, name)
+			return ok
+		})
+	}
+	return matchParts(strings.Split(glob, "/"), parts)
+}
+
+// matchParts matches the segments of a path against those of a glob.
+func matchParts(glob, parts []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchParts(glob[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(glob[0], parts[0]); !ok {
+			return false
+		}
+		glob, parts = glob[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// Watcher watches the files below a set of directories.
+type Watcher struct {
+	cfg    Config
+	fsw    *fsnotify.Watcher
+	handle func([]Event)
+	// files holds the files reported, to tell creations from writes and to
+	// pair removals with creations into renames.
+	files map[string]os.FileInfo
+	// dirty holds the paths changed since the last report, with the
+	// operations seen on them.
+	dirty map[string]fsnotify.Op
+	done  chan struct{}
+}
+
+// New watches the roots of cfg and calls handle with the changes of every
+// burst once it settles. handle is called from a single goroutine, one
+// batch at a time.
+func New(cfg Config, handle func([]Event)) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		cfg:    cfg.withDefaults(),
+		fsw:    fsw,
+		handle: handle,
+		files:  make(map[string]os.FileInfo),
+		dirty:  make(map[string]fsnotify.Op),
+		done:   make(chan struct{}),
+	}
+	for _, root := range w.cfg.Roots {
+		if err := w.add(root, false); err != nil {
+			fsw.Close()
+			return nil, err
+		}
+	}
+	go w.run()
+	return w, nil
+}
+
+// Close stops watching. Changes seen but not reported yet are reported
+// before it returns.
+func (w *Watcher) Close() error {
+	err := w.fsw.Close()
+	<-w.done
+	return err
+}
+
+// add watches a directory and its subdirectories. Their files are marked
+// as changed when created is set, as they may have been written before
+// the directory was watched.
+func (w *Watcher) add(dir string, created bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if rel, ok := w.cfg.rel(path); ok && rel != "." && w.cfg.excluded(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return w.fsw.Add(path)
+		}
+		if !w.cfg.Matches(path) {
+			return nil
+		}
+		if created {
+			w.dirty[path] |= fsnotify.Create
+		} else if info, err := os.Stat(path); err == nil {
+			w.files[path] = info
+		}
+		return nil
+	})
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+	timer := time.NewTimer(w.cfg.Debounce)
+	timer.Stop()
+	// first is when the oldest change not reported yet was seen.
+	var first time.Time
+	errs := w.fsw.Errors
+	for {
+		select {
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				w.flush()
+				return
+			}
+			w.note(event)
+			if first.IsZero() {
+				first = time.Now()
+			}
+			timer.Reset(min(w.cfg.Debounce, time.Until(first.Add(w.cfg.MaxWait))))
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			log.Error().Err(err).Msg("File watcher error")
+		case <-timer.C:
+			first = time.Time{}
+			w.flush()
+		}
+	}
+}
+
+// note marks the path of an event as changed, watches the directories
+// created and unwatches those moved or removed. A moved directory is
+// watched again at its new path when its creation there is noted.
+func (w *Watcher) note(event fsnotify.Event) {
+	rel, ok := w.cfg.rel(event.Name)
+	if !ok || w.cfg.excluded(rel) {
+		return
+	}
+	if event.Has(fsnotify.Rename) || event.Has(fsnotify.Remove) {
+		prefix := event.Name + string(filepath.Separator)
+		for _, dir := range w.fsw.WatchList() {
+			if dir == event.Name || strings.HasPrefix(dir, prefix) {
+				_ = w.fsw.Remove(dir)
+			}
+		}
+	}
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := w.add(event.Name, true); err != nil {
+				log.Error().Err(err).Str("dir", event.Name).Msg("Failed to watch directory")
+			}
+			return
+		}
+	}
+	w.dirty[event.Name] |= event.Op
+}
+
+// flush reports the changes of the dirty paths. A file moved away and a
+// file created that are the same file are reported as a rename.
+func (w *Watcher) flush() {
+	if len(w.dirty) == 0 {
+		return
+	}
+	var created, written []string
+	var removed []string
+	moved := make(map[string]os.FileInfo)
+	for _, path := range slices.Sorted(maps.Keys(w.dirty)) {
+		info, err := os.Stat(path)
+		switch {
+		case err == nil && info.Mode().IsRegular():
+			if !w.cfg.Matches(path) {
+				continue
+			}
+			if _, ok := w.files[path]; ok {
+				written = append(written, path)
+			} else {
+				created = append(created, path)
+			}
+			w.files[path] = info
+		case errors.Is(err, fs.ErrNotExist):
+			// A removed directory removes the files below it.
+			prefix := path + string(filepath.Separator)
+			for file, info := range w.files {
+				if file != path && !strings.HasPrefix(file, prefix) {
+					continue
+				}
+				if w.dirty[path].Has(fsnotify.Rename) {
+					moved[file] = info
+				} else {
+					removed = append(removed, file)
+				}
+				delete(w.files, file)
+			}
+		}
+	}
+	clear(w.dirty)
+	var events []Event
+	for _, path := range created {
+		op := Event{Op: Write, Path: path}
+		for _, old := range slices.Sorted(maps.Keys(moved)) {
+			if os.SameFile(moved[old], w.files[path]) {
+				op = Event{Op: Rename, Path: path, OldPath: old}
+				delete(moved, old)
+				break
+			}
+		}
+		events = append(events, op)
+	}
+	for _, path := range written {
+		events = append(events, Event{Op: Write, Path: path})
+	}
+	// Files moved out of the watched files are removed.
+	removed = append(removed, slices.Collect(maps.Keys(moved))...)
+	slices.Sort(removed)
+	for _, path := range removed {
+		events = append(events, Event{Op: Remove, Path: path})
+	}
+	if len(events) > 0 {
+		w.handle(events)
+	}
+}
@@ -0,0 +1,116 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigMatches(t *testing.T) {
+	cfg := Config{Roots: []string{"/cfg"}, Include: []string{"*.json", "routes/**/*.yaml"}}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/cfg/api.json", true},
+		{"/cfg/a/b/api.json", true},
+		{"/cfg/api.yaml", false},
+		{"/cfg/routes/api.yaml", true},
+		{"/cfg/routes/v1/users/api.yaml", true},
+		{"/cfg/.git/config.json", false},
+		{"/cfg/.api.json.swp", false},
+		{"/other/api.json", false},
+	}
+	for _, tt := range tests {
+		if got := cfg.Matches(tt.path); got != tt.want {
+			t.Errorf("Matches(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// watch starts a watcher with cfg and returns the channel of its batches.
+func watch(t *testing.T, cfg Config) <-chan []Event {
+	t.Helper()
+	batches := make(chan []Event, 16)
+	w, err := New(cfg, func(events []Event) { batches <- events })
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return batches
+}
+
+func next(t *testing.T, batches <-chan []Event, timeout time.Duration) []Event {
+	t.Helper()
+	select {
+	case events := <-batches:
+		return events
+	case <-time.After(timeout):
+		t.Fatal("no events reported")
+		return nil
+	}
+}
+
+func TestWatcherRename(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "a.json")
+	if err := os.WriteFile(old, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	batches := watch(t, Config{Roots: []string{dir}, Debounce: 20 * time.Millisecond})
+	moved := filepath.Join(dir, "sub", "b.json")
+	if err := os.Rename(old, moved); err != nil {
+		t.Fatal(err)
+	}
+	events := next(t, batches, 2*time.Second)
+	if len(events) != 1 || events[0] != (Event{Op: Rename, Path: moved, OldPath: old}) {
+		t.Errorf("events = %+v, want a rename of %s to %s", events, old, moved)
+	}
+
+	// A file removed and another created are not paired.
+	if err := os.Remove(moved); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(dir, "c.json")
+	if err := os.WriteFile(created, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	events = next(t, batches, 2*time.Second)
+	want := []Event{{Op: Write, Path: created}, {Op: Remove, Path: moved}}
+	if len(events) != len(want) || events[0] != want[0] || events[1] != want[1] {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+}
+
+func TestWatcherMaxWait(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.log")
+	batches := watch(t, Config{Roots: []string{dir}, Debounce: 50 * time.Millisecond, MaxWait: 200 * time.Millisecond})
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+				if err != nil {
+					return
+				}
+				f.WriteString("x")
+				f.Close()
+			}
+		}
+	}()
+	// The file keeps being written, so it is only reported thanks to
+	// MaxWait.
+	events := next(t, batches, time.Second)
+	if len(events) != 1 || events[0].Path != path {
+		t.Errorf("events = %+v, want a write of %s", events, path)
+	}
+}